@@ -1,52 +1,188 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/goburrow/modbus"
+
+	"nexusapp/nexus_modbus"
 )
 
 type ModbusRequest struct {
-	Register int `json:"register"`
-	Value    int `json:"value"`
+	Transport    string    `json:"transport"` // RTU, ASCII, TCP, RTU over TCP or UDP, RTU when omitted
+	Address      string    `json:"address"`   // host:port of the network transports
+	Register     int       `json:"register"`
+	Value        int       `json:"value"`
+	FunctionCode int       `json:"functionCode"` // 5, 6, 15, 16, 22 or 23, defaults to 6
+	Values       []float64 `json:"values"`       // Typed values for FC16 and FC23
+	Coils        []bool    `json:"coils"`        // Coil states for FC5 and FC15
+	DataType     string    `json:"dataType"`
+	ByteOrder    string    `json:"byteOrder"`
+	AndMask      *uint16   `json:"andMask"` // Required for FC22
+	OrMask       *uint16   `json:"orMask"`  // Required for FC22
+	ReadRegister uint16    `json:"readRegister"`
+	ReadCount    uint16    `json:"readCount"`
+	TimeoutMs    int       `json:"timeoutMs"`    // Response timeout, 2000 when omitted
+	FrameDelayMs int       `json:"frameDelayMs"` // Silence before each request
+	Retries      int       `json:"retries"`
+}
+
+// requestTiming builds the request timing from millisecond values, a zero timeout keeps the 2 s default
+func requestTiming(timeoutMs, frameDelayMs, retries int) nexus_modbus.Timing {
+	return nexus_modbus.TimingFromMilliseconds(timeoutMs, frameDelayMs, retries, 2*time.Second)
+}
+
+// queryInt reads an optional non-negative integer query parameter
+func queryInt(c *gin.Context, name string) (int, error) {
+	text := c.Query(name)
+	if text == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, text)
+	}
+	return value, nil
+}
+
+// writeRequest converts the JSON body into a write for the selected function code
+func (req ModbusRequest) writeRequest() (nexus_modbus.WriteRequest, nexus_modbus.DataType, nexus_modbus.ByteOrder, error) {
+	var request nexus_modbus.WriteRequest
+
+	dataType, err := nexus_modbus.ParseDataType(req.DataType)
+	if err != nil {
+		return request, dataType, "", err
+	}
+	byteOrder, err := nexus_modbus.ParseByteOrder(req.ByteOrder)
+	if err != nil {
+		return request, dataType, byteOrder, err
+	}
+
+	values := req.Values
+	if len(values) == 0 {
+		values = []float64{float64(req.Value)}
+	}
+
+	switch req.FunctionCode {
+	case 5, 15:
+		if len(req.Coils) == 0 || (req.FunctionCode == 5 && len(req.Coils) != 1) {
+			return request, dataType, byteOrder, fmt.Errorf("invalid number of coils")
+		}
+		request = nexus_modbus.NewCoilWrite(uint16(req.Register), req.Coils, req.FunctionCode == 15)
+	case 0, 6, 16, 23:
+		data, err := nexus_modbus.EncodeValues(values, dataType, byteOrder)
+		if err != nil {
+			return request, dataType, byteOrder, err
+		}
+		if req.FunctionCode != 16 && req.FunctionCode != 23 && len(data) != 2 {
+			return request, dataType, byteOrder, fmt.Errorf("FC6 writes one 16-bit value, use FC16 for %s", dataType)
+		}
+		request = nexus_modbus.NewRegisterWrite(uint16(req.Register), data, req.FunctionCode == 16 || req.FunctionCode == 23)
+		if req.FunctionCode == 23 {
+			request.FunctionCode = 23
+			request.ReadAddress = req.ReadRegister
+			request.ReadQuantity = req.ReadCount
+		}
+	case 22:
+		// Zero masks would clear the register, so both have to be given
+		if req.AndMask == nil || req.OrMask == nil {
+			return request, dataType, byteOrder, fmt.Errorf("FC22 requires andMask and orMask")
+		}
+		request = nexus_modbus.WriteRequest{
+			FunctionCode: 22,
+			Address:      uint16(req.Register),
+			AndMask:      *req.AndMask,
+			OrMask:       *req.OrMask,
+		}
+	default:
+		return request, dataType, byteOrder, fmt.Errorf("unsupported function code %d", req.FunctionCode)
+	}
+	return request, dataType, byteOrder, request.Validate()
+}
+
+// connection returns the shared transport the handlers talk to. The serial transports
+// use the handlers' fixed port, the network ones need an address.
+func connection(transport, address string) (nexus_modbus.Transport, error) {
+	kind, ok := nexus_modbus.ParseTransport(transport)
+	if !ok {
+		return nil, fmt.Errorf("unknown transport %q", transport)
+	}
+	if !kind.IsSerial() && address == "" {
+		return nil, fmt.Errorf("address is required for %s", kind)
+	}
+	return nexus_modbus.GetTransport(nexus_modbus.TransportConfig{
+		Kind: kind,
+		Serial: nexus_modbus.RTUConfig{
+			Port:     "/dev/ttyUSB0",
+			BaudRate: 9600,
+			DataBits: 8,
+			Parity:   "N",
+			StopBits: 1,
+		},
+		Address: address,
+	}), nil
 }
 
-// ScanRegisters handles reading Modbus registers
+// ScanRegisters handles reading Modbus registers.
+// The optional dataType and byteOrder query parameters select how registers are decoded,
+// timeout and frameDelay (in ms) and retries set the request timing, transport and address
+// select the transport.
+// Communication failures are returned as a classified error object.
 func ScanRegisters(c *gin.Context) {
-	handler := modbus.NewRTUClientHandler("/dev/ttyUSB0")
-	handler.BaudRate = 9600
-	handler.DataBits = 8
-	handler.Parity = "N"
-	handler.StopBits = 1
-	handler.SlaveId = 1
-	handler.Timeout = 2 * time.Second
-
-	if err := handler.Connect(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	dataType, err := nexus_modbus.ParseDataType(c.Query("dataType"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	byteOrder, err := nexus_modbus.ParseByteOrder(c.Query("byteOrder"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var timingValues [3]int
+	for i, name := range []string{"timeout", "frameDelay", "retries"} {
+		if timingValues[i], err = queryInt(c, name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	timing := requestTiming(timingValues[0], timingValues[1], timingValues[2])
+	conn, err := connection(c.Query("transport"), c.Query("address"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer handler.Close()
 
-	client := modbus.NewClient(handler)
-	results, err := client.ReadHoldingRegisters(0, 10) // Read 10 registers starting at 0
+	var results []byte
+	err = conn.Do(context.Background(), 1, timing, func(handler modbus.ClientHandler) error {
+		var err error
+		results, err = modbus.NewClient(handler).ReadHoldingRegisters(0, 10) // Read 10 registers starting at 0
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": nexus_modbus.Classify(err)})
 		return
 	}
 
-	data := make(map[string]int)
-	for i := 0; i < len(results)/2; i++ {
-		value := int(results[2*i])<<8 | int(results[2*i+1])
-		data["Register "+strconv.Itoa(i)] = value
+	data := make(map[string]interface{})
+	for _, value := range nexus_modbus.Decode(results, dataType, byteOrder) {
+		if value.Numeric {
+			data["Register "+strconv.Itoa(value.Offset)] = value.Number
+		} else {
+			data["Register "+strconv.Itoa(value.Offset)] = value.Text
+		}
 	}
 
 	c.JSON(http.StatusOK, data)
 }
 
-// WriteRegister handles writing a value to a Modbus register
+// WriteRegister handles writing coils and registers with FC5, FC6, FC15, FC16, FC22 or FC23.
+// Communication failures are returned as a classified error object.
 func WriteRegister(c *gin.Context) {
 	var req ModbusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -54,24 +190,39 @@ func WriteRegister(c *gin.Context) {
 		return
 	}
 
-	handler := modbus.NewRTUClientHandler("/dev/ttyUSB0")
-	handler.BaudRate = 9600
-	handler.DataBits = 8
-	handler.Parity = "N"
-	handler.StopBits = 1
-	handler.SlaveId = 1
-	handler.Timeout = 2 * time.Second
-
-	if err := handler.Connect(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	request, dataType, byteOrder, err := req.writeRequest()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conn, err := connection(req.Transport, req.Address)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer handler.Close()
 
-	client := modbus.NewClient(handler)
-	_, err := client.WriteSingleRegister(uint16(req.Register), uint16(req.Value))
+	var results []byte
+	err = conn.Do(context.Background(), 1, requestTiming(req.TimeoutMs, req.FrameDelayMs, req.Retries), func(handler modbus.ClientHandler) error {
+		var err error
+		results, err = nexus_modbus.Write(modbus.NewClient(handler), request)
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": nexus_modbus.Classify(err)})
+		return
+	}
+
+	if request.FunctionCode == 23 {
+		data := make(map[string]interface{})
+		for _, value := range nexus_modbus.Decode(results, dataType, byteOrder) {
+			register := "Register " + strconv.Itoa(int(request.ReadAddress)+value.Offset)
+			if value.Numeric {
+				data[register] = value.Number
+			} else {
+				data[register] = value.Text
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Write successful", "read": data})
 		return
 	}
 
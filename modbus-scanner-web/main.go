@@ -1,72 +1,193 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
-	"runtime"
-	"strings"
 	"time"
 
 	"github.com/goburrow/modbus"
-)
-
-// listPorts returns a list of serial ports on both Windows and Linux/macOS.
-func listPorts() []string {
-	var cmd *exec.Cmd
 
-	if runtime.GOOS == "windows" {
-		// Use PowerShell to list COM ports on Windows
-		cmd = exec.Command("powershell", "Get-WmiObject Win32_SerialPort | Select-Object -ExpandProperty DeviceID")
-	} else {
-		// Use shell command to list /dev/tty* devices on Linux/macOS
-		cmd = exec.Command("sh", "-c", "ls /dev/tty*")
-	}
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_ports"
+)
 
-	output, err := cmd.Output()
+// portsHandler lists the serial ports present, with the USB adapter details where available
+func portsHandler(w http.ResponseWriter, r *http.Request) {
+	ports, err := nexus_ports.List()
 	if err != nil {
-		return []string{"Error detecting ports"}
+		http.Error(w, "Error detecting ports: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
-
-	ports := strings.Split(strings.TrimSpace(string(output)), "\n")
-	return ports
-}
-
-func portsHandler(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(listPorts())
+	if ports == nil {
+		ports = []nexus_ports.PortInfo{}
+	}
+	json.NewEncoder(w).Encode(ports)
 }
 
 type ModbusConfig struct {
+	Transport     string `json:"transport"` // RTU, ASCII, TCP, RTU over TCP or UDP, RTU when omitted
+	Address       string `json:"address"`   // host:port of the network transports
 	ComPort       string `json:"comPort"`
 	BaudRate      int    `json:"baudRate"`
 	Parity        string `json:"parity"`
 	SlaveId       byte   `json:"slaveId"`
 	StartRegister uint16 `json:"startRegister"`
 	NumRegisters  uint16 `json:"numRegisters"`
+	DataType      string `json:"dataType"`
+	ByteOrder     string `json:"byteOrder"`
+	TimeoutMs     int    `json:"timeoutMs"`    // Response timeout, 2000 when omitted
+	FrameDelayMs  int    `json:"frameDelayMs"` // Silence before each request
+	Retries       int    `json:"retries"`
+	Profile       string `json:"profile"`  // Device profile whose points are read instead of the registers
+	MaxBlock      int    `json:"maxBlock"` // Registers per request, 125 when omitted
+}
+
+// RegisterValue is one decoded value in a scan response
+type RegisterValue struct {
+	Register int         `json:"register"`
+	Value    interface{} `json:"value"`
+	Name     string      `json:"name,omitempty"` // Point name when read with a profile
+	Text     string      `json:"text,omitempty"` // Engineering value with its unit or label
+	Error    string      `json:"error,omitempty"`
+}
+
+// profilesHandler lists the device profiles of the library
+func profilesHandler(w http.ResponseWriter, r *http.Request) {
+	profiles := nexus_modbus.Profiles.List()
+	if profiles == nil {
+		profiles = []*nexus_modbus.Profile{}
+	}
+	json.NewEncoder(w).Encode(profiles)
 }
 
 func scanHandler(w http.ResponseWriter, r *http.Request) {
 	var config ModbusConfig
 	json.NewDecoder(r.Body).Decode(&config)
 
-	handler := modbus.NewRTUClientHandler(config.ComPort)
-	handler.BaudRate = config.BaudRate
-	handler.Parity = config.Parity
-	handler.SlaveId = config.SlaveId
-	handler.Timeout = 2 * time.Second
+	dataType, err := nexus_modbus.ParseDataType(config.DataType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	byteOrder, err := nexus_modbus.ParseByteOrder(config.ByteOrder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	client := modbus.NewClient(handler)
-	handler.Connect()
-	defer handler.Close()
+	var profile *nexus_modbus.Profile
+	if config.Profile != "" {
+		var ok bool
+		if profile, ok = nexus_modbus.Profiles.Get(config.Profile); !ok {
+			http.Error(w, fmt.Sprintf("unknown profile %q", config.Profile), http.StatusBadRequest)
+			return
+		}
+	}
+
+	kind, ok := nexus_modbus.ParseTransport(config.Transport)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown transport %q", config.Transport), http.StatusBadRequest)
+		return
+	}
+	if !kind.IsSerial() && config.Address == "" {
+		http.Error(w, "address is required for "+string(kind), http.StatusBadRequest)
+		return
+	}
+
+	conn := nexus_modbus.GetTransport(nexus_modbus.TransportConfig{
+		Kind: kind,
+		Serial: nexus_modbus.RTUConfig{
+			Port:     config.ComPort,
+			BaudRate: config.BaudRate,
+			DataBits: 8,
+			Parity:   config.Parity,
+			StopBits: 1,
+		},
+		Address: config.Address,
+	})
+	timing := nexus_modbus.TimingFromMilliseconds(config.TimeoutMs, config.FrameDelayMs, config.Retries, 2*time.Second)
+	planner := nexus_modbus.ReadPlanner{MaxRegisters: config.MaxBlock}
+	if profile != nil {
+		scanProfile(w, conn, config.SlaveId, timing, profile, planner)
+		return
+	}
+
+	// Ranges beyond one request are read in chunks, a failed chunk fails only its registers
+	var set *nexus_modbus.ReadSet
+	err = conn.Do(context.Background(), config.SlaveId, timing, func(handler modbus.ClientHandler) error {
+		chunks := planner.Plan([]nexus_modbus.ReadRange{{FunctionCode: 3, Address: int(config.StartRegister), Quantity: int(config.NumRegisters)}})
+		set = nexus_modbus.ReadPlan(modbus.NewClient(handler), chunks)
+		if set.Failed() {
+			return set.Err()
+		}
+		return nil
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": nexus_modbus.Classify(err)})
+		return
+	}
 
-	results, _ := client.ReadHoldingRegisters(config.StartRegister, config.NumRegisters)
-	json.NewEncoder(w).Encode(results)
+	values := []RegisterValue{}
+	for _, value := range set.Decode(3, int(config.StartRegister), int(config.NumRegisters), dataType, byteOrder) {
+		registerValue := RegisterValue{Register: value.Address, Value: value.Text}
+		if value.Err != nil {
+			registerValue.Value = nil
+			registerValue.Error = nexus_modbus.Classify(value.Err).Error()
+		} else if value.Numeric {
+			registerValue.Value = value.Number
+		}
+		values = append(values, registerValue)
+	}
+	json.NewEncoder(w).Encode(values)
+}
+
+// scanProfile reads the points of a device profile and writes their engineering values.
+// Points of a failed read carry the error, only a scan without any value fails as a whole.
+func scanProfile(w http.ResponseWriter, conn nexus_modbus.Transport, slaveId byte, timing nexus_modbus.Timing, profile *nexus_modbus.Profile, planner nexus_modbus.ReadPlanner) {
+	var pointValues []nexus_modbus.PointValue
+	err := conn.Do(context.Background(), slaveId, timing, func(handler modbus.ClientHandler) error {
+		var err error
+		pointValues, err = nexus_modbus.ReadProfile(modbus.NewClient(handler), profile, planner)
+		return err
+	})
+	if err != nil && pointValues == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": nexus_modbus.Classify(err)})
+		return
+	}
+
+	values := []RegisterValue{}
+	for _, pointValue := range pointValues {
+		value := RegisterValue{Register: pointValue.Point.Address, Name: pointValue.Point.Name, Value: pointValue.Text, Text: pointValue.Text}
+		if pointValue.Err != nil {
+			value.Value, value.Text = nil, ""
+			value.Error = nexus_modbus.Classify(pointValue.Err).Error()
+		} else if pointValue.Numeric {
+			value.Value = pointValue.Number
+		}
+		values = append(values, value)
+	}
+	json.NewEncoder(w).Encode(values)
 }
 
 func main() {
-	http.Handle("/", http.FileServer(http.Dir("./static")))
+	if err := nexus_modbus.Profiles.Load(nexus_modbus.DefaultProfileDir()); err != nil {
+		fmt.Println("Loading device profiles:", err)
+	}
+	for _, err := range nexus_modbus.Profiles.Errors() {
+		fmt.Println("Skipped device profile:", err)
+	}
+
+	static := http.FileServer(http.Dir("./static"))
+	http.Handle("/", static)
+	http.Handle("/static/", http.StripPrefix("/static/", static))
 	http.HandleFunc("/api/ports", portsHandler)
+	http.HandleFunc("/api/profiles", profilesHandler)
 	http.HandleFunc("/api/scan", scanHandler)
 
 	fmt.Println("Server running at http://localhost:8080")
@@ -11,31 +11,129 @@ particlesJS('particles-js', {
   },
 });
 
-// Fetch available COM ports on page load
-window.addEventListener('DOMContentLoaded', async () => {
+// Port list last shown, so the select is only rebuilt when it changed
+let shownPorts = null;
+
+// Fill the port list, keeping the selected port while it is still present
+async function loadPorts() {
   const response = await fetch('/api/ports');
+  if (!response.ok) {
+    return;
+  }
   const ports = await response.json();
-  const comPortSelect = document.getElementById('comPort');
+  const portsJSON = JSON.stringify(ports);
+  if (portsJSON === shownPorts) {
+    return;
+  }
+  shownPorts = portsJSON;
 
+  const comPortSelect = document.getElementById('comPort');
+  const selected = comPortSelect.value;
+  comPortSelect.innerHTML = '<option value="">Select a serial port</option>';
   ports.forEach(port => {
     const option = document.createElement('option');
-    option.value = port;
-    option.textContent = port;
+    option.value = port.path;
+    option.textContent = portDescription(port);
+    option.selected = port.path === selected;
     comPortSelect.appendChild(option);
   });
+}
+
+// Fill the device profile list from the server's profile library
+async function loadProfiles() {
+  const response = await fetch('/api/profiles');
+  if (!response.ok) {
+    return;
+  }
+  const profiles = await response.json();
+  const profileSelect = document.getElementById('profile');
+  profiles.forEach(profile => {
+    const option = document.createElement('option');
+    option.value = profile.name;
+    option.textContent = profile.model ? `${profile.name} (${profile.model})` : profile.name;
+    profileSelect.appendChild(option);
+  });
+}
+
+// Fetch the serial ports on page load and again as adapters are plugged in or removed
+window.addEventListener('DOMContentLoaded', () => {
+  loadPorts();
+  loadProfiles();
+  setInterval(loadPorts, 3000);
 });
 
-// Handle form submission and start scan
+// Name a port with its USB adapter details, e.g. "/dev/ttyUSB0 - FT232R USB UART (FTDI, 0403:6001)"
+function portDescription(port) {
+  if (!port.vid) {
+    return port.path;
+  }
+  let details = `${port.vid}:${port.pid}`;
+  if (port.manufacturer) {
+    details = `${port.manufacturer}, ${details}`;
+  }
+  return `${port.path} - ${port.product || 'USB serial'} (${details})`;
+}
+
+// Show the serial port or the network address, whichever the selected transport needs
+function updateTransport() {
+  const transport = document.getElementById('transport').value;
+  const serial = transport === 'RTU' || transport === 'ASCII';
+  document.getElementById('addressGroup').classList.toggle('d-none', serial);
+  document.getElementById('address').required = !serial;
+  document.getElementById('comPort').required = serial;
+}
+
+document.getElementById('transport').addEventListener('change', updateTransport);
+
+// Timer of the next poll while polling is running
+let pollTimer = null;
+
+// Handle form submission: scan once, or start and stop polling
 document.getElementById('configForm').addEventListener('submit', async (e) => {
   e.preventDefault();
 
+  const scanButton = document.getElementById('scanButton');
+  if (pollTimer !== null) {
+    clearTimeout(pollTimer);
+    pollTimer = null;
+    scanButton.textContent = 'Start Scan';
+    return;
+  }
+
+  const pollInterval = parseInt(document.getElementById('pollInterval').value);
+  if (pollInterval > 0) {
+    scanButton.textContent = 'Stop Scan';
+    const poll = async () => {
+      await scan();
+      if (pollTimer !== null) {
+        pollTimer = setTimeout(poll, pollInterval);
+      }
+    };
+    pollTimer = 0;
+    poll();
+    return;
+  }
+  await scan();
+});
+
+// Read the registers once and show the results
+async function scan() {
   const config = {
+    transport: document.getElementById('transport').value,
+    address: document.getElementById('address').value,
     comPort: document.getElementById('comPort').value,
     baudRate: parseInt(document.getElementById('baudRate').value),
     parity: document.getElementById('parity').value,
     slaveId: parseInt(document.getElementById('slaveId').value),
     startRegister: parseInt(document.getElementById('startRegister').value),
     numRegisters: parseInt(document.getElementById('numRegisters').value),
+    maxBlock: parseInt(document.getElementById('maxBlock').value) || 0,
+    dataType: document.getElementById('dataType').value,
+    byteOrder: document.getElementById('byteOrder').value,
+    timeoutMs: parseInt(document.getElementById('timeout').value),
+    frameDelayMs: parseInt(document.getElementById('frameDelay').value),
+    retries: parseInt(document.getElementById('retries').value),
+    profile: document.getElementById('profile').value,
   };
 
   const response = await fetch('/api/scan', {
@@ -48,10 +146,26 @@ document.getElementById('configForm').addEventListener('submit', async (e) => {
   const resultsDiv = document.getElementById('results');
   resultsDiv.innerHTML = '<h3 class="text-light">Scan Results:</h3>';
 
+  // Communication failures come back as a classified error
+  if (!response.ok) {
+    const error = data.error;
+    [error.title, error.explanation, 'Likely cause: ' + error.likelyCause].forEach(text => {
+      const p = document.createElement('p');
+      p.textContent = text;
+      p.classList.add('text-warning');
+      resultsDiv.appendChild(p);
+    });
+    return;
+  }
+
   data.forEach(result => {
     const p = document.createElement('p');
-    p.textContent = result;
+    if (result.name) {
+      p.textContent = `${result.name}: ${result.error || result.text}`;
+    } else {
+      p.textContent = `Register ${result.register}: ${result.error || result.value}`;
+    }
     p.classList.add('text-light');
     resultsDiv.appendChild(p);
   });
-});
+}
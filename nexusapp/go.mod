@@ -6,5 +6,6 @@ require (
 	fyne.io/fyne/v2 v2.3.1
 	github.com/fyne-io/examples v0.0.0-20230227213322-20bc35b41147
 	github.com/goburrow/modbus v0.1.0
-	github.com/goburrow/serial v0.1.0 // indirect
+	github.com/goburrow/serial v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -2,87 +2,166 @@ package modbus_scanner
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"github.com/goburrow/modbus"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
 )
 
 type ModbusScanner struct {
-	ipAddress   string
-	port        int
-	register    int
-	resultLabel *widget.Label
-	window      fyne.Window
-}
+	transport nexus_modbus.TransportKind
+	ipAddress string
+	port      int
+	unitId    byte                   // Slave ID behind a gateway, 0 addresses the gateway itself
+	read      nexus_widgets.ScanForm // Range or profile points, the range start is also the register the sweeps probe
+	timing    nexus_modbus.Timing    // Poll interval, response timeout, frame delay and retries
 
-func (ms *ModbusScanner) scan() {
-	handler := modbus.NewTCPClientHandler(fmt.Sprintf("%s:%d", ms.ipAddress, ms.port))
-	client := modbus.NewClient(handler)
-	defer handler.Close()
+	scanner *nexus_widgets.Scanner // Polls, writes and identifies the device one request at a time
+	window  fyne.Window
 
-	handler.Timeout = 5 * time.Second
-	err := handler.Connect()
-	if err != nil {
-		ms.resultLabel.SetText("Failed to connect: " + err.Error())
-		return
-	}
+	ipEntry     *widget.Entry // Kept so the network sweep can load a found host
+	portEntry   *widget.Entry
+	unitIdEntry *widget.Entry // Kept so the unit ID sweep can load a found device
+}
 
-	results, err := client.ReadHoldingRegisters(uint16(ms.register), 1)
-	if err != nil {
-		ms.resultLabel.SetText("Read error: " + err.Error())
-		return
-	}
+// formChanged copies the form to the scanner, the inputs call it on the UI thread after every edit
+func (ms *ModbusScanner) formChanged() {
+	address := net.JoinHostPort(ms.ipAddress, strconv.Itoa(ms.port))
+	ms.scanner.SetTarget(nexus_widgets.ScanTarget{
+		Transport: nexus_modbus.TransportConfig{Kind: ms.transport, Address: address},
+		UnitId:    ms.unitId,
+		Name:      fmt.Sprintf("%s unit %d", address, ms.unitId),
+		Timing:    ms.timing,
+		Scan:      ms.read.Config(),
+	})
+}
 
-	ms.resultLabel.SetText(fmt.Sprintf("Register %d: %v", ms.register, results))
+// connection returns the shared connection to the device over the selected transport
+func (ms *ModbusScanner) connection() nexus_modbus.Transport {
+	return ms.scanner.Connection()
 }
 
-func (ms *ModbusScanner) createUI() fyne.CanvasObject {
+func (ms *ModbusScanner) createUI(settings *nexus_widgets.Settings) fyne.CanvasObject {
+	transports := make([]string, len(nexus_modbus.NetworkTransports))
+	for i, kind := range nexus_modbus.NetworkTransports {
+		transports[i] = string(kind)
+	}
+	transportSelect := widget.NewSelect(transports, func(s string) {
+		ms.transport = nexus_modbus.TransportKind(s)
+		ms.formChanged()
+	})
+	transportSelect.SetSelected(string(ms.transport))
+	settings.Select("transport", transportSelect)
+
 	ipEntry := widget.NewEntry()
-	ipEntry.SetPlaceHolder("Enter IP Address")
+	ms.ipEntry = ipEntry
+	ipEntry.SetPlaceHolder("IP Address (e.g., 192.168.1.10)")
 	ipEntry.OnChanged = func(s string) {
 		ms.ipAddress = s
+		ms.formChanged()
 	}
+	settings.Entry("ipAddress", ipEntry)
 
 	portEntry := widget.NewEntry()
-	portEntry.SetPlaceHolder("Enter Port (e.g., 502)")
+	ms.portEntry = portEntry
+	portEntry.SetPlaceHolder("Port (e.g., 502)")
 	portEntry.OnChanged = func(s string) {
 		port, err := strconv.Atoi(s)
 		if err == nil {
 			ms.port = port
+			ms.formChanged()
 		}
 	}
+	settings.Entry("port", portEntry)
 
-	registerEntry := widget.NewEntry()
-	registerEntry.SetPlaceHolder("Enter Register Address (e.g., 1)")
-	registerEntry.OnChanged = func(s string) {
-		register, err := strconv.Atoi(s)
-		if err == nil {
-			ms.register = register
+	unitIdEntry := widget.NewEntry()
+	ms.unitIdEntry = unitIdEntry
+	unitIdEntry.SetPlaceHolder("0 for the device, slave ID behind a gateway")
+	unitIdEntry.OnChanged = func(s string) {
+		unitId, err := strconv.Atoi(s)
+		if err == nil && unitId >= 0 && unitId <= 255 {
+			ms.unitId = byte(unitId)
+			ms.formChanged()
 		}
 	}
+	settings.Entry("unitId", unitIdEntry)
+
+	readForm := nexus_widgets.NewScanForm(ms.window, &ms.read, "register", "count", settings, ms.formChanged)
+
+	connectionGrid := container.NewGridWithColumns(4,
+		container.NewVBox(widget.NewLabel("Transport"), transportSelect),
+		container.NewVBox(widget.NewLabel("IP Address"), ipEntry),
+		container.NewVBox(widget.NewLabel("Port"), portEntry),
+		container.NewVBox(widget.NewLabel("Unit ID"), unitIdEntry),
+	)
 
-	ms.resultLabel = widget.NewLabel("Result: ")
+	scanButton := widget.NewButtonWithIcon("Read Once", theme.ViewRefreshIcon(), ms.scanner.ReadOnce)
 
-	scanButton := widget.NewButton("Scan", func() {
-		ms.scan()
+	startButton := widget.NewButtonWithIcon("Start Scan", theme.MediaPlayIcon(), func() {
+		if !ms.scanner.Poller.Running() {
+			ms.scanner.Start()
+		}
+	})
+
+	stopButton := widget.NewButtonWithIcon("Stop Scan", theme.MediaStopIcon(), ms.scanner.Stop)
+
+	sweepButton := widget.NewButtonWithIcon("Sweep Network", theme.SearchIcon(), func() {
+		ms.showSweepDialog()
 	})
 
-	return container.NewVBox(
+	unitSweepButton := widget.NewButtonWithIcon("Sweep Unit IDs", theme.SearchIcon(), func() {
+		ms.showUnitSweepDialog()
+	})
+
+	deviceInfoButton := widget.NewButtonWithIcon("Device Info", theme.InfoIcon(), func() {
+		nexus_widgets.ShowDeviceInfoDialog(ms.window, fmt.Sprintf("Device Info (%s:%d)", ms.ipAddress, ms.port), ms.scanner.ReadDeviceIdentification)
+	})
+
+	statsButton := widget.NewButtonWithIcon("Stats", theme.InfoIcon(), func() {
+		nexus_widgets.ShowStatsDialog(ms.window, "Communication Statistics - IP Scanner", ms.scanner.Stats)
+	})
+
+	controls := container.NewVBox(
 		widget.NewLabel("Modbus Scanner"),
-		ipEntry,
-		portEntry,
-		registerEntry,
-		scanButton,
-		ms.resultLabel,
+		connectionGrid,
+		readForm,
+		nexus_widgets.NewTimingForm(&ms.timing, true, settings, ms.formChanged),
+		container.NewHBox(scanButton, startButton, stopButton, sweepButton, unitSweepButton, deviceInfoButton, statsButton),
+		widget.NewLabel("Write"),
+		nexus_widgets.NewWritePanel(settings, ms.scanner.ShowError, ms.scanner.Write),
+		ms.scanner.Spinner,
+		ms.scanner.TableButtons(),
 	)
+
+	ms.formChanged()
+
+	// The table takes the space left by the controls and scrolls through long ranges
+	return container.NewBorder(controls, ms.scanner.Messages(), nil, nil, ms.scanner.Table.Table)
 }
 
-// Show initializes the ModbusScanner and loads its UI into the given window
-func Show(win fyne.Window) fyne.CanvasObject {
-	scanner := &ModbusScanner{window: win}
-	return scanner.createUI()
+// Show initializes the ModbusScanner and loads its UI into the given window.
+// Its inputs are added to settings.
+func Show(win fyne.Window, settings *nexus_widgets.Settings) fyne.CanvasObject {
+	timing := nexus_modbus.DefaultTiming()
+	timing.Timeout = 5 * time.Second // The IP scanner has always waited 5 s for a response
+	scanner := &ModbusScanner{
+		window:    win,
+		transport: nexus_modbus.TransportTCP,
+		read: nexus_widgets.ScanForm{
+			FunctionCode: 3, // Read Holding Registers
+			Quantity:     1,
+			DataType:     nexus_modbus.TypeUint16,
+			ByteOrder:    nexus_modbus.OrderABCD,
+		},
+		timing:  timing,
+		scanner: nexus_widgets.NewScanner(win),
+	}
+	return scanner.createUI(settings)
 }
@@ -0,0 +1,145 @@
+package modbus_scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
+)
+
+// showSweepDialog opens the network sweep window. The probe reads the register of the form
+// with its unit ID and response timeout.
+func (ms *ModbusScanner) showSweepDialog() {
+	targetsEntry := widget.NewEntry()
+	targetsEntry.SetPlaceHolder("e.g. 192.168.1.0/24 or 10.0.0.5, 10.0.0.7")
+	if ms.ipAddress != "" {
+		targetsEntry.SetText(ms.ipAddress + "/24")
+	}
+	extraPortsEntry := widget.NewEntry()
+	extraPortsEntry.SetPlaceHolder("e.g. 1502, 5020")
+	workersEntry := widget.NewEntry()
+	workersEntry.SetText("64")
+	connectTimeoutEntry := widget.NewEntry()
+	connectTimeoutEntry.SetText("300")
+	identifyCheck := widget.NewCheck("Read device identification (FC43)", nil)
+	identifyCheck.SetChecked(true)
+
+	var sweepDialog *nexus_widgets.SweepDialog
+	exportButton := widget.NewButtonWithIcon("Export CSV", theme.DocumentSaveIcon(), func() {
+		var exported []nexus_modbus.SweepResult
+		for _, row := range sweepDialog.Rows() {
+			exported = append(exported, row.(nexus_modbus.SweepResult))
+		}
+		nexus_widgets.SaveToFile(ms.window, "modbus_sweep.csv", "sweep results", func(w io.Writer) error {
+			return nexus_modbus.WriteSweepCSV(w, exported)
+		})
+	})
+
+	optionsGrid := container.NewGridWithColumns(3,
+		container.NewVBox(widget.NewLabel("Extra Ports"), extraPortsEntry),
+		container.NewVBox(widget.NewLabel("Workers"), workersEntry),
+		container.NewVBox(widget.NewLabel("Connect Timeout (ms)"), connectTimeoutEntry),
+	)
+	form := container.NewVBox(
+		container.NewVBox(widget.NewLabel("Networks or Addresses (port 502 is always probed)"), targetsEntry),
+		optionsGrid,
+		identifyCheck,
+	)
+
+	sweepDialog = nexus_widgets.NewSweepDialog(ms.window, nexus_widgets.SweepConfig{
+		Title:     "Sweep Network",
+		Form:      form,
+		StartText: "Sweep",
+		Buttons:   []fyne.CanvasObject{exportButton},
+		Columns:   []string{"Address", "Latency", "Exception", "Vendor", "Product", "Revision"},
+		Widths:    []float32{180, 90, 90, 140, 140, 90},
+		Hint:      "Click a device to load its address into the scanner",
+		Size:      fyne.NewSize(820, 600),
+		Start: func() (nexus_widgets.SweepFunc, error) {
+			hosts, err := nexus_modbus.ParseSweepTargets(targetsEntry.Text)
+			if err != nil {
+				return nil, err
+			}
+			ports := []int{502}
+			extraPorts, err := nexus_modbus.ParsePorts(extraPortsEntry.Text)
+			if err != nil {
+				return nil, err
+			}
+			for _, port := range extraPorts {
+				if port != 502 {
+					ports = append(ports, port)
+				}
+			}
+			workers, err := strconv.Atoi(workersEntry.Text)
+			if err != nil || workers < 1 || workers > 1024 {
+				return nil, fmt.Errorf("Invalid number of workers (1-1024): %s", workersEntry.Text)
+			}
+			connectTimeout, err := nexus_modbus.ParseMilliseconds(connectTimeoutEntry.Text)
+			if err != nil || connectTimeout <= 0 {
+				return nil, fmt.Errorf("Invalid connect timeout: %s", connectTimeoutEntry.Text)
+			}
+
+			options := nexus_modbus.SweepOptions{
+				Hosts:          hosts,
+				Ports:          ports,
+				UnitId:         ms.unitId,
+				Register:       ms.read.Address,
+				Workers:        workers,
+				ConnectTimeout: connectTimeout,
+				Timeout:        ms.timing.Timeout,
+				Identify:       identifyCheck.Checked,
+			}
+			return func(ctx context.Context, run *nexus_widgets.SweepRun) string {
+				run.SetStatus(fmt.Sprintf("Probing %d host(s) on port(s) %v...", len(hosts), ports))
+				nexus_modbus.SweepNetwork(ctx, options, func(result nexus_modbus.SweepResult) { run.Add(result) }, run.Progress)
+				if ctx.Err() != nil {
+					return fmt.Sprintf("Sweep cancelled, %d device(s) found", run.Count())
+				}
+				return fmt.Sprintf("Sweep finished, %d device(s) found", run.Count())
+			}, nil
+		},
+		Cell: func(row interface{}, col int) string {
+			result := row.(nexus_modbus.SweepResult)
+			identity := result.Identity
+			if identity == nil {
+				identity = &nexus_modbus.DeviceIdentification{}
+			}
+			switch col {
+			case 0:
+				return result.Address
+			case 1:
+				return result.Latency.Round(time.Millisecond).String()
+			case 2:
+				if result.ExceptionCode == 0 {
+					return "-"
+				}
+				return fmt.Sprintf("0x%02X", result.ExceptionCode)
+			case 3:
+				return identity.Get("VendorName")
+			case 4:
+				return identity.Get("ProductCode")
+			}
+			return identity.Get("MajorMinorRevision")
+		},
+		OnSelect: func(row interface{}) {
+			// Load the selected host back into the scanner form
+			host, port, err := net.SplitHostPort(row.(nexus_modbus.SweepResult).Address)
+			if err != nil {
+				return
+			}
+			ms.ipEntry.SetText(host)
+			ms.portEntry.SetText(port)
+		},
+	})
+	sweepDialog.Show()
+}
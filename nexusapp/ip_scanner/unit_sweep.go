@@ -0,0 +1,115 @@
+package modbus_scanner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
+)
+
+// showUnitSweepDialog opens the unit ID sweep window. It probes the unit IDs behind the
+// address of the form over its open connection, e.g. the serial devices of a TCP-to-RTU gateway.
+func (ms *ModbusScanner) showUnitSweepDialog() {
+	firstEntry := widget.NewEntry()
+	firstEntry.SetText("1")
+	lastEntry := widget.NewEntry()
+	lastEntry.SetText("247")
+	timeoutEntry := widget.NewEntry()
+	timeoutEntry.SetText(strconv.Itoa(int(ms.timing.Timeout / time.Millisecond)))
+	identifyCheck := widget.NewCheck("Read device identification (FC43)", nil)
+
+	optionsGrid := container.NewGridWithColumns(3,
+		container.NewVBox(widget.NewLabel("First Unit ID"), firstEntry),
+		container.NewVBox(widget.NewLabel("Last Unit ID"), lastEntry),
+		container.NewVBox(widget.NewLabel("Response Timeout (ms)"), timeoutEntry),
+	)
+	form := container.NewVBox(
+		widget.NewLabel(fmt.Sprintf("Devices behind %s:%d, probed by reading holding register %d", ms.ipAddress, ms.port, ms.read.Address)),
+		optionsGrid,
+		identifyCheck,
+	)
+
+	nexus_widgets.NewSweepDialog(ms.window, nexus_widgets.SweepConfig{
+		Title:     "Sweep Unit IDs",
+		Form:      form,
+		StartText: "Sweep",
+		Columns:   []string{"Unit ID", "Latency", "Exception", "Vendor", "Product"},
+		Widths:    []float32{80, 90, 90, 160, 160},
+		Hint:      "Click a device to load its unit ID into the scanner",
+		Size:      fyne.NewSize(700, 600),
+		Start: func() (nexus_widgets.SweepFunc, error) {
+			first, err := strconv.Atoi(firstEntry.Text)
+			if err != nil || first < 1 || first > 247 {
+				return nil, fmt.Errorf("Invalid first unit ID (1-247): %s", firstEntry.Text)
+			}
+			last, err := strconv.Atoi(lastEntry.Text)
+			if err != nil || last < first || last > 247 {
+				return nil, fmt.Errorf("Invalid last unit ID (%d-247): %s", first, lastEntry.Text)
+			}
+			timeout, err := nexus_modbus.ParseMilliseconds(timeoutEntry.Text)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("Invalid response timeout: %s", timeoutEntry.Text)
+			}
+
+			options := nexus_modbus.UnitSweepOptions{
+				First:    first,
+				Last:     last,
+				Register: ms.read.Address,
+				Timeout:  timeout,
+				Identify: identifyCheck.Checked,
+			}
+			conn := ms.connection()
+
+			return func(ctx context.Context, run *nexus_widgets.SweepRun) string {
+				run.SetStatus(fmt.Sprintf("Probing unit IDs %d-%d over %s...", first, last, conn.Name()))
+				gatewayAnswers, err := nexus_modbus.SweepUnits(ctx, conn, options,
+					func(result nexus_modbus.UnitResult) { run.Add(result) }, run.Progress)
+
+				status := fmt.Sprintf("%d device(s) found", run.Count())
+				if gatewayAnswers > 0 {
+					// Exceptions 0x0A and 0x0B come from the gateway, not from a device on the unit ID
+					status += fmt.Sprintf(", the gateway reported %d unit ID(s) as absent (exception 0x0A or 0x0B)", gatewayAnswers)
+				}
+				switch {
+				case err != nil:
+					return "Sweep stopped: " + nexus_modbus.Classify(err).Error() + ", " + status
+				case ctx.Err() != nil:
+					return "Sweep cancelled, " + status
+				}
+				return "Sweep finished, " + status
+			}, nil
+		},
+		Cell: func(row interface{}, col int) string {
+			result := row.(nexus_modbus.UnitResult)
+			identity := result.Identity
+			if identity == nil {
+				identity = &nexus_modbus.DeviceIdentification{}
+			}
+			switch col {
+			case 0:
+				return strconv.Itoa(int(result.UnitId))
+			case 1:
+				return result.Latency.Round(time.Millisecond).String()
+			case 2:
+				if result.ExceptionCode == 0 {
+					return "-"
+				}
+				return fmt.Sprintf("0x%02X", result.ExceptionCode)
+			case 3:
+				return identity.Get("VendorName")
+			}
+			return identity.Get("ProductCode")
+		},
+		OnSelect: func(row interface{}) {
+			// Load the selected unit ID back into the scanner form
+			ms.unitIdEntry.SetText(strconv.Itoa(int(row.(nexus_modbus.UnitResult).UnitId)))
+		},
+	}).Show()
+}
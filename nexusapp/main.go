@@ -1,6 +1,8 @@
 package main
 
 import (
+	"log"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
@@ -8,7 +10,13 @@ import (
 
 	modbus_scanner "nexusapp/ip_scanner"
 	"nexusapp/nexus_about"
+	"nexusapp/nexus_modbus"
 	"nexusapp/nexus_modbus_bits"
+	"nexusapp/nexus_simulator"
+	"nexusapp/nexus_sniffer"
+	"nexusapp/nexus_traffic"
+	"nexusapp/nexus_widgets"
+	"nexusapp/nexus_workspace"
 	modbus_rtu_scanner "nexusapp/rtu_scanner"
 
 	"github.com/fyne-io/examples/img/icon"
@@ -18,18 +26,21 @@ type appInfo struct {
 	name string
 	icon fyne.Resource
 	canv bool
-	run  func(fyne.Window) fyne.CanvasObject
+	run  func(fyne.Window, *nexus_widgets.Settings) fyne.CanvasObject
 }
 
 var apps = []appInfo{
 	{"RTU Scanner", icon.BugBitmap, true, modbus_rtu_scanner.Show},
 	{"Bits", icon.BugBitmap, true, nexus_modbus_bits.Show},
 	{"IP Scanner", icon.BugBitmap, true, modbus_scanner.Show},
+	{"Traffic", icon.BugBitmap, true, nexus_traffic.Show},
+	{"Sniffer", icon.BugBitmap, true, nexus_sniffer.Show},
+	{"Simulator", icon.BugBitmap, true, nexus_simulator.Show},
 	{"About", icon.BugBitmap, true, nexus_about.Show},
 }
 
 func main() {
-	a := app.New()
+	a := app.NewWithID("com.nexusscanner.app") // The ID in FyneApp.toml, which keeps the preferences
 	resourceIconPng, err := fyne.LoadResourceFromPath("NEXUS.ico")
 	if err != nil {
 		panic(err)
@@ -38,12 +49,19 @@ func main() {
 
 	w := a.NewWindow("Nexus Scanner")
 
+	// Device profiles are picked in the scanner tabs, load them before the tabs are built
+	if err := nexus_modbus.Profiles.Load(nexus_modbus.DefaultProfileDir()); err != nil {
+		log.Printf("Loading device profiles: %v", err)
+	}
+
 	apps[0].icon = theme.RadioButtonIcon() // lazy load Fyne resource to avoid error
 
 	// Create a slice to hold pointers to TabItem
 	var tabItems []*container.TabItem
+	settings := make(map[string]*nexus_widgets.Settings) // Inputs of each tab, saved with the workspace
 	for _, app := range apps {
-		tab := container.NewTabItem(app.name, container.NewMax(app.run(w)))
+		settings[app.name] = nexus_widgets.NewSettings()
+		tab := container.NewTabItem(app.name, container.NewMax(app.run(w, settings[app.name])))
 		tabItems = append(tabItems, tab) // Append the pointer to TabItem
 	}
 
@@ -57,10 +75,25 @@ func main() {
 	)
 
 	w.SetContent(topBar)
+
+	// Restore the last session and keep it when the window closes
+	workspace := nexus_workspace.NewManager(a, w, tabs, settings)
+	w.SetMainMenu(workspace.MainMenu())
+	workspace.RestoreSession()
+	w.SetCloseIntercept(func() {
+		workspace.SaveSession()
+		w.Close()
+	})
+	if errs := nexus_modbus.Profiles.Errors(); len(errs) > 0 {
+		nexus_widgets.ShowProfileErrors(w, errs)
+	}
 	//w.Resize(fyne.NewSize(1100, 710)) // Adjust the window size as needed
 	w.SetFullScreen(false) // Ensure the window is not full-screen on launch
 	// Listen for changes in window size and prevent full-screen
 	//w.SetFixedSize(true)
 
 	w.ShowAndRun()
+	nexus_widgets.StopRefreshing()   // End the refresh loops of the tabs
+	nexus_modbus.RTUPorts.CloseAll() // Release the serial ports held open between requests
+	nexus_modbus.NetPorts.CloseAll()
 }
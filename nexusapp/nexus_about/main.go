@@ -15,6 +15,8 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_widgets"
 )
 
 // Current version of the app
@@ -57,7 +59,7 @@ func AboutPage(win fyne.Window) fyne.CanvasObject {
 }
 
 // Show initializes the About page and loads it into the given window
-func Show(win fyne.Window) fyne.CanvasObject {
+func Show(win fyne.Window, _ *nexus_widgets.Settings) fyne.CanvasObject {
 	return AboutPage(win)
 }
 
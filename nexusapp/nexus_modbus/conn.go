@@ -0,0 +1,421 @@
+package nexus_modbus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+const (
+	portReadTimeout = 20 * time.Millisecond // Bounds each read, request timeouts are handled per request
+	minBackoff      = 500 * time.Millisecond
+	maxBackoff      = 30 * time.Second
+	asciiMaxFrame   = 513 // Colon, 2 hex digits for each of 255 bytes and CR LF
+)
+
+// RTUConfig is the serial line setup a connection is opened with
+type RTUConfig struct {
+	Port     string
+	BaudRate int
+	DataBits int
+	Parity   string
+	StopBits int
+	ASCII    bool // Modbus ASCII framing instead of RTU
+}
+
+// PortError reports that the serial port could not be opened or stopped working
+// during a request, as opposed to a device that did not answer
+type PortError struct {
+	Port string
+	Err  error
+}
+
+func (e *PortError) Error() string {
+	return fmt.Sprintf("port %s: %v", e.Port, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *PortError) Unwrap() error {
+	return e.Err
+}
+
+// RTUConnections keeps one open connection per serial port, so polls and writes
+// reuse the port instead of opening and closing it for every request
+type RTUConnections struct {
+	mu    sync.Mutex
+	conns map[string]*RTUConnection // By port name
+}
+
+// RTUPorts is the connection manager shared by every tool in the application
+var RTUPorts = NewRTUConnections()
+
+// NewRTUConnections creates an empty connection manager
+func NewRTUConnections() *RTUConnections {
+	return &RTUConnections{conns: make(map[string]*RTUConnection)}
+}
+
+// Get returns the connection for config. A port can only be open once, so a connection
+// to the same port with other settings is closed and replaced.
+func (m *RTUConnections) Get(config RTUConfig) *RTUConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conn, ok := m.conns[config.Port]; ok {
+		if conn.config == config {
+			return conn
+		}
+		conn.Close()
+	}
+	conn := &RTUConnection{config: config}
+	m.conns[config.Port] = conn
+	return conn
+}
+
+// Release closes the managed connection to port, if any, so another user can open the port.
+// The next Get for the port opens a new connection.
+func (m *RTUConnections) Release(port string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conn, ok := m.conns[port]; ok {
+		conn.Close()
+		delete(m.conns, port)
+	}
+}
+
+// CloseAll closes every managed port
+func (m *RTUConnections) CloseAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, conn := range m.conns {
+		conn.Close()
+		delete(m.conns, name)
+	}
+}
+
+// backoff schedules reopening a failed port or connection, doubling the wait after each failure
+type backoff struct {
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// wait returns an error while the next attempt to open is not due yet
+func (b *backoff) wait() error {
+	if wait := time.Until(b.retryAt); wait > 0 {
+		return fmt.Errorf("reconnecting in %v: %w", wait.Round(100*time.Millisecond), b.lastErr)
+	}
+	return nil
+}
+
+// fail schedules the next attempt after a failure
+func (b *backoff) fail(err error) {
+	delay := maxBackoff
+	if b.failures < 16 {
+		delay = minBackoff << uint(b.failures)
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+	b.failures++
+	b.retryAt = time.Now().Add(delay)
+	b.lastErr = err
+}
+
+// RTUConnection is a serial port kept open across requests, speaking RTU or ASCII. Requests are
+// serialized, a port that fails is closed and reopened on a later request with exponential backoff.
+type RTUConnection struct {
+	config RTUConfig
+
+	mu        sync.Mutex
+	port      serial.Port
+	closed    bool // Replaced by a connection with other settings
+	stale     bool // A response may still arrive for a request that timed out
+	lastFrame time.Time
+	backoff
+}
+
+// Config returns the line settings of the connection
+func (c *RTUConnection) Config() RTUConfig {
+	return c.config
+}
+
+// Name names the framing and port, e.g. "RTU /dev/ttyUSB0"
+func (c *RTUConnection) Name() string {
+	return c.framing() + " " + c.config.Port
+}
+
+func (c *RTUConnection) framing() string {
+	if c.config.ASCII {
+		return string(TransportASCII)
+	}
+	return string(TransportRTU)
+}
+
+// Do runs fn with exclusive use of the port. The handler passed to fn addresses slaveId and
+// sends with the given timing, fn is repeated for timing.Retries when it gets no valid response.
+// Failures of the port itself are returned as *PortError, the port is then reopened by a later call.
+// Cancelling ctx abandons the request in flight and returns the context error.
+func (c *RTUConnection) Do(ctx context.Context, slaveId byte, timing Timing, fn func(handler modbus.ClientHandler) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.closed {
+		return &PortError{Port: c.config.Port, Err: fmt.Errorf("reopened with other settings")}
+	}
+	if c.port == nil {
+		if err := c.backoff.wait(); err != nil {
+			return &PortError{Port: c.config.Port, Err: err}
+		}
+		if err := c.open(); err != nil {
+			c.fail(err)
+			return &PortError{Port: c.config.Port, Err: err}
+		}
+	}
+
+	exchange := &serialExchange{ctx: ctx, conn: c, timing: timing}
+	var handler modbus.ClientHandler
+	if c.config.ASCII {
+		ascii := &asciiConnHandler{ASCIIClientHandler: modbus.NewASCIIClientHandler(c.config.Port), serialExchange: exchange}
+		ascii.SlaveId = slaveId
+		handler = ascii
+	} else {
+		rtu := &rtuConnHandler{RTUClientHandler: modbus.NewRTUClientHandler(c.config.Port), serialExchange: exchange}
+		rtu.SlaveId = slaveId
+		handler = rtu
+	}
+	err := timing.Run(ctx, func() error {
+		if exchange.broken != nil {
+			return &PortError{Port: c.config.Port, Err: exchange.broken}
+		}
+		return fn(handler)
+	})
+	if exchange.broken != nil {
+		c.fail(exchange.broken)
+		return &PortError{Port: c.config.Port, Err: exchange.broken}
+	}
+	c.failures = 0
+	return err
+}
+
+// Close closes the port. A closed connection refuses further requests.
+func (c *RTUConnection) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.port != nil {
+		c.port.Close()
+		c.port = nil
+	}
+	c.closed = true
+}
+
+func (c *RTUConnection) open() error {
+	port, err := serial.Open(&serial.Config{
+		Address:  c.config.Port,
+		BaudRate: c.config.BaudRate,
+		DataBits: c.config.DataBits,
+		StopBits: c.config.StopBits,
+		Parity:   c.config.Parity,
+		Timeout:  portReadTimeout,
+	})
+	if err != nil {
+		return err
+	}
+	c.port = port
+	c.stale = false
+	return nil
+}
+
+// fail closes a broken port and schedules the next attempt to open it
+func (c *RTUConnection) fail(err error) {
+	if c.port != nil {
+		c.port.Close()
+		c.port = nil
+	}
+	c.backoff.fail(err)
+}
+
+// drain discards bytes left over from an earlier request, such as a late response
+func (c *RTUConnection) drain() error {
+	buf := make([]byte, rtuMaxFrame)
+	for i := 0; i < 16; i++ {
+		n, err := c.port.Read(buf)
+		if err == serial.ErrTimeout {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.EOF
+		}
+	}
+	c.stale = false
+	return nil
+}
+
+// frameGap is the 3.5 character silence that separates RTU frames
+func frameGap(baudRate int) time.Duration {
+	if baudRate <= 0 || baudRate > 19200 {
+		return 1750 * time.Microsecond
+	}
+	return time.Duration(38500000/baudRate) * time.Microsecond
+}
+
+// serialExchange sends the requests of one RTUConnection.Do call and reads their responses
+type serialExchange struct {
+	ctx    context.Context
+	conn   *RTUConnection
+	timing Timing
+	broken error // Set when the port failed, which ends the call
+}
+
+// send writes a request after the silence the bus needs and reads the response with read
+func (e *serialExchange) send(aduRequest []byte, gap time.Duration, read func(ctx context.Context, port io.Reader, timeout time.Duration) ([]byte, error)) ([]byte, error) {
+	c := e.conn
+	if e.broken != nil {
+		return nil, &PortError{Port: c.config.Port, Err: e.broken}
+	}
+	if c.stale {
+		if err := c.drain(); err != nil {
+			e.broken = err
+			return nil, &PortError{Port: c.config.Port, Err: err}
+		}
+	}
+	if e.timing.FrameDelay > gap {
+		gap = e.timing.FrameDelay
+	}
+	if wait := time.Until(c.lastFrame.Add(gap)); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-e.ctx.Done():
+			timer.Stop()
+			return nil, e.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if _, err := c.port.Write(aduRequest); err != nil {
+		e.broken = err
+		return nil, &PortError{Port: c.config.Port, Err: err}
+	}
+	Traffic.Capture(DirectionTX, c.framing(), c.config.Port, aduRequest)
+	frame, err := read(e.ctx, c.port, e.timing.Timeout)
+	c.lastFrame = time.Now()
+	if len(frame) > 0 {
+		Traffic.Capture(DirectionRX, c.framing(), c.config.Port, frame)
+	}
+	if err != nil {
+		if err != serial.ErrTimeout && err != e.ctx.Err() {
+			e.broken = err
+			return nil, &PortError{Port: c.config.Port, Err: err}
+		}
+		c.stale = true
+		return nil, err
+	}
+	return frame, nil
+}
+
+// rtuConnHandler sends requests over an open RTUConnection. It reads complete frames itself,
+// since goburrow/modbus only knows the response length of its own function codes.
+type rtuConnHandler struct {
+	*modbus.RTUClientHandler
+	*serialExchange
+}
+
+// Send writes the request and reads until a complete response frame arrived
+func (h *rtuConnHandler) Send(aduRequest []byte) ([]byte, error) {
+	return h.send(aduRequest, frameGap(h.conn.config.BaudRate), readRTUFrame)
+}
+
+// asciiConnHandler sends Modbus ASCII requests over an open RTUConnection
+type asciiConnHandler struct {
+	*modbus.ASCIIClientHandler
+	*serialExchange
+}
+
+// Send writes the request and reads until a line ending in CR LF arrived. ASCII frames
+// carry their own start and end, so there is no silent interval to keep.
+func (h *asciiConnHandler) Send(aduRequest []byte) ([]byte, error) {
+	return h.send(aduRequest, 0, readASCIIFrame)
+}
+
+// readRTUFrame reads one response frame, returning what arrived before the timeout when
+// its length is not known so the CRC check can decide about it. A timeout error comes
+// with the bytes received before it, if any. Cancelling ctx stops the read within one port read timeout.
+func readRTUFrame(ctx context.Context, port io.Reader, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	var frame []byte
+	chunk := make([]byte, rtuMaxFrame)
+	for {
+		if length, ok := RTUFrameLength(frame); ok && len(frame) >= length {
+			return frame[:length], nil
+		}
+		if len(frame) >= rtuMaxFrame || !time.Now().Before(deadline) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return frame, err
+		}
+		n, err := port.Read(chunk)
+		if err == serial.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			// A readable port without data has been disconnected
+			return nil, io.EOF
+		}
+		frame = append(frame, chunk[:n]...)
+	}
+	if len(frame) < 4 {
+		return frame, serial.ErrTimeout
+	}
+	return frame, nil
+}
+
+// readASCIIFrame reads one ASCII frame, from the colon up to and including CR LF.
+// Anything before the colon is dropped. A timeout error comes with the bytes received before it.
+func readASCIIFrame(ctx context.Context, port io.Reader, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	var frame []byte
+	chunk := make([]byte, asciiMaxFrame)
+	for {
+		if start := bytes.IndexByte(frame, ':'); start >= 0 {
+			frame = frame[start:]
+			if end := bytes.Index(frame, []byte("\r\n")); end >= 0 {
+				return frame[:end+2], nil
+			}
+		}
+		if len(frame) >= asciiMaxFrame || !time.Now().Before(deadline) {
+			return frame, serial.ErrTimeout
+		}
+		if err := ctx.Err(); err != nil {
+			return frame, err
+		}
+		n, err := port.Read(chunk)
+		if err == serial.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, io.EOF
+		}
+		frame = append(frame, chunk[:n]...)
+	}
+}
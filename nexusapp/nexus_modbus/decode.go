@@ -0,0 +1,268 @@
+package nexus_modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DataType selects how register contents are interpreted
+type DataType string
+
+const (
+	TypeInt16   DataType = "int16"
+	TypeUint16  DataType = "uint16"
+	TypeInt32   DataType = "int32"
+	TypeUint32  DataType = "uint32"
+	TypeInt64   DataType = "int64"
+	TypeFloat32 DataType = "float32"
+	TypeFloat64 DataType = "float64"
+	TypeString  DataType = "string"
+	TypeBCD     DataType = "bcd"
+	TypeHex     DataType = "hex"
+	TypeBinary  DataType = "binary"
+)
+
+// DataTypes lists the data types in the order the UI offers them
+var DataTypes = []DataType{
+	TypeUint16, TypeInt16, TypeUint32, TypeInt32, TypeInt64,
+	TypeFloat32, TypeFloat64, TypeString, TypeBCD, TypeHex, TypeBinary,
+}
+
+// ByteOrder names the position of bytes A (most significant) to D within a 32-bit value.
+// Longer values repeat the pattern, so CDAB swaps the word order and BADC swaps the
+// bytes inside every word.
+type ByteOrder string
+
+const (
+	OrderABCD ByteOrder = "ABCD" // Big endian
+	OrderCDAB ByteOrder = "CDAB" // Word swapped
+	OrderBADC ByteOrder = "BADC" // Byte swapped
+	OrderDCBA ByteOrder = "DCBA" // Little endian
+)
+
+// ByteOrders lists the byte orders in the order the UI offers them
+var ByteOrders = []ByteOrder{OrderABCD, OrderCDAB, OrderBADC, OrderDCBA}
+
+// DecodedValue is one value taken from a block of registers
+type DecodedValue struct {
+	Offset    int     // Register offset from the start of the read
+	Registers int     // Number of registers the value spans
+	Text      string  // Formatted value
+	Number    float64 // Numeric value, valid when Numeric is set
+	Numeric   bool
+}
+
+// ParseDataType accepts the names in DataTypes, an empty string selects uint16
+func ParseDataType(s string) (DataType, error) {
+	if s == "" {
+		return TypeUint16, nil
+	}
+	for _, dataType := range DataTypes {
+		if string(dataType) == strings.ToLower(s) {
+			return dataType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown data type %q", s)
+}
+
+// ParseByteOrder accepts the names in ByteOrders, an empty string selects ABCD
+func ParseByteOrder(s string) (ByteOrder, error) {
+	if s == "" {
+		return OrderABCD, nil
+	}
+	for _, order := range ByteOrders {
+		if string(order) == strings.ToUpper(s) {
+			return order, nil
+		}
+	}
+	return "", fmt.Errorf("unknown byte order %q", s)
+}
+
+// Registers returns how many registers one value of this type spans.
+// Strings span the whole read and return 0.
+func (t DataType) Registers() int {
+	switch t {
+	case TypeInt32, TypeUint32, TypeFloat32:
+		return 2
+	case TypeInt64, TypeFloat64:
+		return 4
+	case TypeString:
+		return 0
+	}
+	return 1
+}
+
+// reorder returns the value bytes in big endian order
+func reorder(raw []byte, order ByteOrder) []byte {
+	b := make([]byte, len(raw))
+	copy(b, raw)
+
+	swapWords := order == OrderCDAB || order == OrderDCBA
+	swapBytes := order == OrderBADC || order == OrderDCBA
+	if swapWords {
+		for i, j := 0, len(b)-2; i < j; i, j = i+2, j-2 {
+			b[i], b[j] = b[j], b[i]
+			b[i+1], b[j+1] = b[j+1], b[i+1]
+		}
+	}
+	if swapBytes {
+		for i := 0; i+1 < len(b); i += 2 {
+			b[i], b[i+1] = b[i+1], b[i]
+		}
+	}
+	return b
+}
+
+// Decode interprets register data as returned by FC3/FC4. Registers that do not
+// complete a value at the end of the block are left out.
+func Decode(data []byte, dataType DataType, order ByteOrder) []DecodedValue {
+	if dataType == TypeString {
+		return []DecodedValue{decodeString(data, order)}
+	}
+
+	size := dataType.Registers()
+	var values []DecodedValue
+	for offset := 0; 2*(offset+size) <= len(data); offset += size {
+		value := DecodeValue(data[2*offset:2*(offset+size)], dataType, order)
+		value.Offset = offset
+		values = append(values, value)
+	}
+	return values
+}
+
+// DecodeValue interprets the raw bytes of a single value
+func DecodeValue(raw []byte, dataType DataType, order ByteOrder) DecodedValue {
+	if dataType == TypeString {
+		return decodeString(raw, order)
+	}
+
+	b := reorder(raw, order)
+	value := DecodedValue{Registers: len(raw) / 2, Numeric: true}
+	switch dataType {
+	case TypeInt16:
+		value.Number = float64(int16(binary.BigEndian.Uint16(b)))
+	case TypeUint16:
+		value.Number = float64(binary.BigEndian.Uint16(b))
+	case TypeInt32:
+		value.Number = float64(int32(binary.BigEndian.Uint32(b)))
+	case TypeUint32:
+		value.Number = float64(binary.BigEndian.Uint32(b))
+	case TypeInt64:
+		n := int64(binary.BigEndian.Uint64(b))
+		value.Number = float64(n)
+		value.Text = fmt.Sprintf("%d", n) // Keep full precision in the text
+		return value
+	case TypeFloat32:
+		value.Number = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		value.Text = fmt.Sprintf("%g", math.Float32frombits(binary.BigEndian.Uint32(b)))
+		return value
+	case TypeFloat64:
+		value.Number = math.Float64frombits(binary.BigEndian.Uint64(b))
+		value.Text = fmt.Sprintf("%g", value.Number)
+		return value
+	case TypeBCD:
+		return decodeBCD(b)
+	case TypeHex:
+		value.Number = float64(binary.BigEndian.Uint16(b))
+		value.Text = fmt.Sprintf("0x%04X", binary.BigEndian.Uint16(b))
+		return value
+	case TypeBinary:
+		value.Number = float64(binary.BigEndian.Uint16(b))
+		value.Text = fmt.Sprintf("%016b", binary.BigEndian.Uint16(b))
+		return value
+	}
+	value.Text = fmt.Sprintf("%.0f", value.Number)
+	return value
+}
+
+// decodeBCD reads four packed decimal digits from one register
+func decodeBCD(b []byte) DecodedValue {
+	value := DecodedValue{Registers: 1}
+	n := 0
+	for _, c := range b[:2] {
+		for _, digit := range []byte{c >> 4, c & 0x0F} {
+			if digit > 9 {
+				value.Text = fmt.Sprintf("invalid BCD 0x%02X%02X", b[0], b[1])
+				return value
+			}
+			n = n*10 + int(digit)
+		}
+	}
+	value.Number = float64(n)
+	value.Numeric = true
+	value.Text = fmt.Sprintf("%04d", n)
+	return value
+}
+
+// decodeString reads two ASCII characters per register, dropping padding
+func decodeString(data []byte, order ByteOrder) DecodedValue {
+	b := make([]byte, len(data)-len(data)%2)
+	copy(b, data)
+	if order == OrderBADC || order == OrderDCBA {
+		// Character order inside registers is swapped, word order is kept for strings
+		b = reorder(b, OrderBADC)
+	}
+
+	text := strings.TrimRight(string(b), "\x00 ")
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7E {
+			return '.'
+		}
+		return r
+	}, text)
+	return DecodedValue{Registers: len(b) / 2, Text: text}
+}
+
+// EncodeValue converts a typed value into register bytes, the inverse of DecodeValue
+func EncodeValue(number float64, dataType DataType, order ByteOrder) ([]byte, error) {
+	var b []byte
+	switch dataType {
+	case TypeInt16, TypeUint16, TypeHex, TypeBinary:
+		if (dataType == TypeInt16 && (number < math.MinInt16 || number > math.MaxInt16)) ||
+			(dataType != TypeInt16 && (number < 0 || number > math.MaxUint16)) {
+			return nil, fmt.Errorf("value %g out of range for %s", number, dataType)
+		}
+		b = make([]byte, 2)
+		binary.BigEndian.PutUint16(b, uint16(int64(number)))
+	case TypeInt32, TypeUint32:
+		if (dataType == TypeInt32 && (number < math.MinInt32 || number > math.MaxInt32)) ||
+			(dataType == TypeUint32 && (number < 0 || number > math.MaxUint32)) {
+			return nil, fmt.Errorf("value %g out of range for %s", number, dataType)
+		}
+		b = make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int64(number)))
+	case TypeInt64:
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(int64(number)))
+	case TypeFloat32:
+		b = make([]byte, 4)
+		binary.BigEndian.PutUint32(b, math.Float32bits(float32(number)))
+	case TypeFloat64:
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(number))
+	case TypeBCD:
+		if number < 0 || number > 9999 {
+			return nil, fmt.Errorf("value %g out of range for %s", number, dataType)
+		}
+		n := int(number)
+		b = []byte{byte((n/1000)<<4 | (n/100)%10), byte(((n/10)%10)<<4 | n%10)}
+	default:
+		return nil, fmt.Errorf("cannot encode %s values", dataType)
+	}
+	// The reorder is its own inverse for every supported order
+	return reorder(b, order), nil
+}
+
+// EncodeString packs text into registers, two characters per register, padded with a NUL
+func EncodeString(text string, order ByteOrder) []byte {
+	b := []byte(text)
+	if len(b)%2 != 0 {
+		b = append(b, 0)
+	}
+	if order == OrderBADC || order == OrderDCBA {
+		b = reorder(b, OrderBADC)
+	}
+	return b
+}
@@ -0,0 +1,156 @@
+package nexus_modbus
+
+import (
+	"fmt"
+
+	"github.com/goburrow/modbus"
+)
+
+const (
+	funcCodeEncapsulatedInterface = 43
+	meiReadDeviceIdentification   = 14
+)
+
+// Read device ID codes, each category includes the ones before it
+const (
+	DeviceIdBasic    byte = 1
+	DeviceIdRegular  byte = 2
+	DeviceIdExtended byte = 3
+)
+
+var deviceObjectNames = map[byte]string{
+	0x00: "VendorName",
+	0x01: "ProductCode",
+	0x02: "MajorMinorRevision",
+	0x03: "VendorUrl",
+	0x04: "ProductName",
+	0x05: "ModelName",
+	0x06: "UserApplicationName",
+}
+
+// DeviceObject is one object returned by Read Device Identification
+type DeviceObject struct {
+	Id    byte   `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DeviceIdentification is the answer to FC43 / MEI 14
+type DeviceIdentification struct {
+	ConformityLevel byte           `json:"conformityLevel"`
+	Objects         []DeviceObject `json:"objects"`
+}
+
+// Get returns the value of an object by name, or an empty string
+func (d *DeviceIdentification) Get(name string) string {
+	for _, object := range d.Objects {
+		if object.Name == name {
+			return object.Value
+		}
+	}
+	return ""
+}
+
+// DeviceObjectName returns the standard name of an object ID
+func DeviceObjectName(id byte) string {
+	if name, ok := deviceObjectNames[id]; ok {
+		return name
+	}
+	if id >= 0x80 {
+		return fmt.Sprintf("Private 0x%02X", id)
+	}
+	return fmt.Sprintf("Reserved 0x%02X", id)
+}
+
+// ReadDeviceIdentification walks the basic, regular and extended object categories up to
+// the level the device reports, following "more follows" continuations.
+// A category the device rejects ends the walk with what was read so far.
+func ReadDeviceIdentification(handler modbus.ClientHandler) (*DeviceIdentification, error) {
+	identification := &DeviceIdentification{}
+	seen := make(map[byte]bool)
+
+	categories := []struct {
+		code  byte
+		first byte
+	}{
+		{DeviceIdBasic, 0x00},
+		{DeviceIdRegular, 0x03},
+		{DeviceIdExtended, 0x80},
+	}
+
+	for _, category := range categories {
+		if category.code > DeviceIdBasic && identification.ConformityLevel&0x7F < category.code {
+			break
+		}
+
+		objectId := category.first
+		for requests := 0; requests < 256; requests++ {
+			response, err := readDeviceIdPage(handler, category.code, objectId)
+			if err != nil {
+				if category.code == DeviceIdBasic {
+					return nil, err
+				}
+				return identification, nil
+			}
+
+			identification.ConformityLevel = response.conformity
+			for _, object := range response.objects {
+				if !seen[object.Id] {
+					seen[object.Id] = true
+					identification.Objects = append(identification.Objects, object)
+				}
+			}
+
+			if !response.moreFollows || response.nextObjectId <= objectId {
+				break
+			}
+			objectId = response.nextObjectId
+		}
+	}
+	return identification, nil
+}
+
+type deviceIdPage struct {
+	conformity   byte
+	moreFollows  bool
+	nextObjectId byte
+	objects      []DeviceObject
+}
+
+// readDeviceIdPage sends one Read Device Identification request and parses the response
+func readDeviceIdPage(handler modbus.ClientHandler, readCode, objectId byte) (*deviceIdPage, error) {
+	response, err := SendPDU(handler, &modbus.ProtocolDataUnit{
+		FunctionCode: funcCodeEncapsulatedInterface,
+		Data:         []byte{meiReadDeviceIdentification, readCode, objectId},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := response.Data
+	if len(data) < 6 || data[0] != meiReadDeviceIdentification {
+		return nil, fmt.Errorf("modbus: invalid device identification response % x", data)
+	}
+
+	page := &deviceIdPage{
+		conformity:   data[2],
+		moreFollows:  data[3] == 0xFF,
+		nextObjectId: data[4],
+	}
+	count := int(data[5])
+	pos := 6
+	for i := 0; i < count; i++ {
+		if pos+2 > len(data) || pos+2+int(data[pos+1]) > len(data) {
+			return nil, fmt.Errorf("modbus: truncated device identification object %d", i)
+		}
+		id := data[pos]
+		length := int(data[pos+1])
+		page.objects = append(page.objects, DeviceObject{
+			Id:    id,
+			Name:  DeviceObjectName(id),
+			Value: string(data[pos+2 : pos+2+length]),
+		})
+		pos += 2 + length
+	}
+	return page, nil
+}
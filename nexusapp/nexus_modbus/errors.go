@@ -0,0 +1,177 @@
+package nexus_modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// ErrorCode identifies a class of communication failure
+type ErrorCode string
+
+const (
+	CodePortBusy          ErrorCode = "port_busy"
+	CodePortMissing       ErrorCode = "port_missing"
+	CodePortFailed        ErrorCode = "port_failed"
+	CodeTimeout           ErrorCode = "timeout"
+	CodeCRCMismatch       ErrorCode = "crc_mismatch"
+	CodeBadResponse       ErrorCode = "bad_response"
+	CodeConnectionRefused ErrorCode = "connection_refused"
+	CodeHostUnreachable   ErrorCode = "host_unreachable"
+	CodeConnectionClosed  ErrorCode = "connection_closed"
+	CodeException         ErrorCode = "exception"
+	CodeCancelled         ErrorCode = "cancelled"
+	CodeUnknown           ErrorCode = "unknown"
+)
+
+// Error is a classified communication failure with a plain-language explanation
+type Error struct {
+	Code          ErrorCode `json:"code"`
+	ExceptionCode byte      `json:"exceptionCode,omitempty"`
+	Title         string    `json:"title"`
+	Explanation   string    `json:"explanation"`
+	LikelyCause   string    `json:"likelyCause"`
+	Detail        string    `json:"detail"` // The original error text
+	err           error
+}
+
+func (e *Error) Error() string {
+	if e.Code == CodeException {
+		return fmt.Sprintf("%s (exception %02X)", e.Title, e.ExceptionCode)
+	}
+	return e.Title
+}
+
+// Unwrap returns the classified error
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Describe formats the error for display, one line each for the title, explanation and likely cause
+func (e *Error) Describe() string {
+	return fmt.Sprintf("%s\n%s\nLikely cause: %s", e.Error(), e.Explanation, e.LikelyCause)
+}
+
+// IsPortFailure reports whether the port or connection failed, as opposed to the device
+func (e *Error) IsPortFailure() bool {
+	switch e.Code {
+	case CodePortBusy, CodePortMissing, CodePortFailed, CodeConnectionRefused, CodeHostUnreachable, CodeConnectionClosed:
+		return true
+	}
+	return false
+}
+
+// exceptionInfo holds the title, explanation and likely cause of each exception code
+var exceptionInfo = map[byte][3]string{
+	0x01: {"Illegal function", "The device does not support this function code.", "wrong function code for this device or register type"},
+	0x02: {"Illegal data address", "The device has no data at the requested address or range.", "address out of range, check the register map and whether addresses are 0- or 1-based"},
+	0x03: {"Illegal data value", "The device rejected a value or quantity in the request.", "quantity too large or value outside the allowed range"},
+	0x04: {"Server device failure", "The device failed while executing the request.", "internal device fault, check the device itself"},
+	0x05: {"Acknowledge", "The device accepted the request but needs more time to complete it.", "long-running operation, poll again later"},
+	0x06: {"Server device busy", "The device is busy with another request.", "another master is talking to the device, or the poll interval is too short"},
+	0x07: {"Negative acknowledge", "The device cannot perform the requested program function.", "request not supported in the device's current state"},
+	0x08: {"Memory parity error", "The device detected a parity error reading its extended memory.", "device memory fault"},
+	0x0A: {"Gateway path unavailable", "The gateway could not route the request to the target.", "gateway misconfigured or overloaded, check its routing for this unit ID"},
+	0x0B: {"Gateway target failed to respond", "The gateway forwarded the request but the target device did not answer.", "gateway target not responding, check the slave ID and the serial side of the gateway"},
+}
+
+// Classify maps an error from any transport to a structured Error. nil stays nil.
+func Classify(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	e := &Error{Detail: err.Error(), err: err}
+	var exception *modbus.ModbusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	text := strings.ToLower(err.Error())
+	switch {
+	case errors.As(err, &exception):
+		e.Code = CodeException
+		e.ExceptionCode = exception.ExceptionCode
+		if info, ok := exceptionInfo[exception.ExceptionCode]; ok {
+			e.Title, e.Explanation, e.LikelyCause = info[0], info[1], info[2]
+		} else {
+			e.Title = "Unknown exception"
+			e.Explanation = "The device answered with an exception code the protocol does not define."
+			e.LikelyCause = "vendor specific exception, check the device manual"
+		}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// Before the timeout case, context.DeadlineExceeded is a net.Error timing out
+		e.Code = CodeCancelled
+		e.Title = "Cancelled"
+		e.Explanation = "The request was abandoned before the device answered."
+		e.LikelyCause = "the scan was stopped or paused"
+	case errors.Is(err, serial.ErrTimeout), errors.As(err, &netErr) && netErr.Timeout():
+		e.Code = CodeTimeout
+		e.Title = "Timeout"
+		e.Explanation = "No response arrived before the timeout."
+		e.LikelyCause = "check slave ID, line settings and wiring, or increase the timeout"
+	case strings.Contains(text, "crc"):
+		e.Code = CodeCRCMismatch
+		e.Title = "CRC mismatch"
+		e.Explanation = "A response arrived but its checksum was wrong."
+		e.LikelyCause = "noise or reflections on the bus, check termination, shielding and baud rate"
+	case strings.HasPrefix(text, "modbus: response"):
+		e.Code = CodeBadResponse
+		e.Title = "Invalid response"
+		e.Explanation = "A response arrived that does not match the request."
+		e.LikelyCause = "another device answered, or two masters share the bus"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		e.Code = CodeConnectionRefused
+		e.Title = "Connection refused"
+		e.Explanation = "The host is reachable but nothing accepts connections on this port."
+		e.LikelyCause = "wrong TCP port, or the Modbus server is not running"
+	case errors.As(err, &dnsErr), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		e.Code = CodeHostUnreachable
+		e.Title = "Host unreachable"
+		e.Explanation = "The device's address could not be reached."
+		e.LikelyCause = "wrong IP address, or the device is on another network"
+	case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+		e.Code = CodeConnectionClosed
+		e.Title = "Connection closed"
+		e.Explanation = "The connection was closed during the request."
+		e.LikelyCause = "the server limits connections, or the serial adapter was unplugged"
+	case os.IsNotExist(err):
+		e.Code = CodePortMissing
+		e.Title = "Port not found"
+		e.Explanation = "The serial port does not exist."
+		e.LikelyCause = "wrong port name, or the USB adapter is unplugged"
+	case os.IsPermission(err), errors.Is(err, syscall.EBUSY):
+		e.Code = CodePortBusy
+		e.Title = "Port busy"
+		e.Explanation = "The serial port could not be opened."
+		e.LikelyCause = "another program has the port open, or the user may not access it (dialout group on Linux)"
+	case isPortFailure(err):
+		e.Code = CodePortFailed
+		e.Title = "Port failure"
+		e.Explanation = "The serial port or connection stopped working."
+		e.LikelyCause = "adapter unplugged or driver error, the port is reopened automatically"
+	default:
+		e.Code = CodeUnknown
+		e.Title = "Communication error"
+		e.Explanation = err.Error()
+		e.LikelyCause = "see the error detail"
+	}
+	return e
+}
+
+// isPortFailure reports errors of the port or connection that have no specific class
+func isPortFailure(err error) bool {
+	var portErr *PortError
+	var opErr *net.OpError
+	return errors.As(err, &portErr) || errors.As(err, &opErr)
+}
@@ -0,0 +1,128 @@
+package nexus_modbus
+
+import (
+	"sync"
+	"time"
+)
+
+// Sample is one polled value
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// sampleRing is a fixed-capacity ring buffer, the oldest sample is overwritten when full
+type sampleRing struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func (r *sampleRing) add(sample Sample) {
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns the samples newer than t, oldest first
+func (r *sampleRing) since(t time.Time) []Sample {
+	var ordered []Sample
+	if r.full {
+		ordered = append(ordered, r.samples[r.next:]...)
+	}
+	ordered = append(ordered, r.samples[:r.next]...)
+
+	var samples []Sample
+	for _, sample := range ordered {
+		if !sample.Time.Before(t) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// resize keeps the newest samples that fit the new capacity
+func (r *sampleRing) resize(capacity int) {
+	kept := r.since(time.Time{})
+	if len(kept) > capacity {
+		kept = kept[len(kept)-capacity:]
+	}
+	r.samples = make([]Sample, capacity)
+	r.next = copy(r.samples, kept) % capacity
+	r.full = len(kept) == capacity
+}
+
+// History keeps the most recent samples of every polled point in bounded ring buffers,
+// so memory use does not grow with the length of a session
+type History struct {
+	mu       sync.Mutex
+	capacity int
+	series   map[string]*sampleRing
+	order    []string
+}
+
+// NewHistory creates a history holding up to capacity samples per point
+func NewHistory(capacity int) *History {
+	return &History{capacity: capacity, series: make(map[string]*sampleRing)}
+}
+
+// Add records a value for the named point
+func (h *History) Add(name string, t time.Time, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.series[name]
+	if !ok {
+		ring = &sampleRing{samples: make([]Sample, h.capacity)}
+		h.series[name] = ring
+		h.order = append(h.order, name)
+	}
+	ring.add(Sample{Time: t, Value: value})
+}
+
+// Names returns the recorded points in the order they first appeared
+func (h *History) Names() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := make([]string, len(h.order))
+	copy(names, h.order)
+	return names
+}
+
+// Samples returns a copy of the samples of a point newer than since, oldest first
+func (h *History) Samples(name string, since time.Time) []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ring, ok := h.series[name]
+	if !ok {
+		return nil
+	}
+	return ring.since(since)
+}
+
+// SetCapacity changes the samples kept per point, dropping the oldest ones that no longer fit
+func (h *History) SetCapacity(capacity int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if capacity < 1 || capacity == h.capacity {
+		return
+	}
+	h.capacity = capacity
+	for _, ring := range h.series {
+		ring.resize(capacity)
+	}
+}
+
+// Clear drops all recorded samples
+func (h *History) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.series = make(map[string]*sampleRing)
+	h.order = nil
+}
@@ -0,0 +1,339 @@
+package nexus_modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+const (
+	mbapHeaderSize = 7
+	udpMaxFrame    = 260 // MBAP header and the largest PDU
+)
+
+// NetConnections keeps one open connection per network transport and address
+type NetConnections struct {
+	mu    sync.Mutex
+	conns map[string]*NetConnection // By transport and address
+}
+
+// NetPorts is the network connection manager shared by every tool in the application
+var NetPorts = NewNetConnections()
+
+// NewNetConnections creates an empty connection manager
+func NewNetConnections() *NetConnections {
+	return &NetConnections{conns: make(map[string]*NetConnection)}
+}
+
+// Get returns the connection to address over a network transport
+func (m *NetConnections) Get(kind TransportKind, address string) *NetConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := string(kind) + " " + address
+	conn, ok := m.conns[key]
+	if !ok {
+		conn = &NetConnection{kind: kind, address: address}
+		m.conns[key] = conn
+	}
+	return conn
+}
+
+// CloseAll closes every managed connection
+func (m *NetConnections) CloseAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, conn := range m.conns {
+		conn.Close()
+		delete(m.conns, key)
+	}
+}
+
+// NetConnection is a TCP or UDP connection kept open across requests. Requests are serialized,
+// a connection that fails is closed and reopened on a later request with exponential backoff.
+type NetConnection struct {
+	kind    TransportKind
+	address string
+
+	mu            sync.Mutex
+	conn          net.Conn
+	stale         bool   // A response may still arrive for a request that timed out
+	transactionId uint16 // Last MBAP transaction ID, kept across calls to spot late responses
+	backoff
+}
+
+// Name names the transport and address, e.g. "TCP 10.0.0.5:502"
+func (c *NetConnection) Name() string {
+	return string(c.kind) + " " + c.address
+}
+
+// Do runs fn with exclusive use of the connection, see Transport
+func (c *NetConnection) Do(ctx context.Context, slaveId byte, timing Timing, fn func(handler modbus.ClientHandler) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.conn == nil {
+		if err := c.backoff.wait(); err != nil {
+			return &PortError{Port: c.address, Err: err}
+		}
+		if err := c.open(timing.Timeout); err != nil {
+			c.backoff.fail(err)
+			return &PortError{Port: c.address, Err: err}
+		}
+	}
+
+	exchange := &netExchange{ctx: ctx, conn: c, timing: timing}
+	var handler modbus.ClientHandler
+	if c.kind == TransportRTUOverTCP {
+		rtu := &rtuNetHandler{RTUClientHandler: modbus.NewRTUClientHandler(c.address), netExchange: exchange}
+		rtu.SlaveId = slaveId
+		handler = rtu
+	} else {
+		mbap := &mbapNetHandler{TCPClientHandler: modbus.NewTCPClientHandler(c.address), netExchange: exchange}
+		mbap.SlaveId = slaveId
+		handler = mbap
+	}
+	err := timing.Run(ctx, func() error {
+		if exchange.broken != nil {
+			return &PortError{Port: c.address, Err: exchange.broken}
+		}
+		return fn(handler)
+	})
+	if exchange.broken != nil {
+		c.fail(exchange.broken)
+		return &PortError{Port: c.address, Err: exchange.broken}
+	}
+	c.failures = 0
+	return err
+}
+
+// Close closes the connection, a later request opens it again
+func (c *NetConnection) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *NetConnection) open(timeout time.Duration) error {
+	network := "tcp"
+	if c.kind == TransportUDP {
+		network = "udp"
+	}
+	conn, err := net.DialTimeout(network, c.address, timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.stale = false
+	return nil
+}
+
+// fail closes a broken connection and schedules the next attempt to open it
+func (c *NetConnection) fail(err error) {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.backoff.fail(err)
+}
+
+// drain discards data left over from an earlier request, such as a late response
+func (c *NetConnection) drain() error {
+	buf := make([]byte, udpMaxFrame)
+	for i := 0; i < 16; i++ {
+		c.conn.SetReadDeadline(time.Now().Add(portReadTimeout))
+		if _, err := c.conn.Read(buf); err != nil {
+			if isNetTimeout(err) {
+				break
+			}
+			return err
+		}
+	}
+	c.stale = false
+	return nil
+}
+
+// netExchange sends the requests of one NetConnection.Do call and reads their responses
+type netExchange struct {
+	ctx    context.Context
+	conn   *NetConnection
+	timing Timing
+	broken error // Set when the connection failed, which ends the call
+}
+
+// send writes a request and reads the response with read. Cancelling the context
+// interrupts the read by moving the deadline.
+func (e *netExchange) send(aduRequest []byte, read func(conn net.Conn) ([]byte, error)) ([]byte, error) {
+	c := e.conn
+	if e.broken != nil {
+		return nil, &PortError{Port: c.address, Err: e.broken}
+	}
+	if c.stale {
+		if err := c.drain(); err != nil {
+			e.broken = err
+			return nil, &PortError{Port: c.address, Err: err}
+		}
+	}
+	if e.timing.FrameDelay > 0 {
+		timer := time.NewTimer(e.timing.FrameDelay)
+		select {
+		case <-e.ctx.Done():
+			timer.Stop()
+			return nil, e.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	c.conn.SetDeadline(time.Now().Add(e.timing.Timeout))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-e.ctx.Done():
+			c.conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, err := c.conn.Write(aduRequest); err != nil {
+		e.broken = err
+		return nil, &PortError{Port: c.address, Err: err}
+	}
+	Traffic.Capture(DirectionTX, string(c.kind), c.address, aduRequest)
+	frame, err := read(c.conn)
+	if len(frame) > 0 {
+		Traffic.Capture(DirectionRX, string(c.kind), c.address, frame)
+	}
+	switch {
+	case err == nil:
+		return frame, nil
+	case e.ctx.Err() != nil:
+		c.stale = true
+		return nil, e.ctx.Err()
+	case err == serial.ErrTimeout || isNetTimeout(err):
+		c.stale = true
+		return nil, serial.ErrTimeout
+	default:
+		e.broken = err
+		return nil, &PortError{Port: c.address, Err: err}
+	}
+}
+
+// mbapNetHandler sends MBAP framed requests over TCP or UDP
+type mbapNetHandler struct {
+	*modbus.TCPClientHandler
+	*netExchange
+}
+
+// Send numbers the request with the connection's next transaction ID, so late responses to
+// earlier calls can be told apart, and reads until the response with that ID arrived.
+// The request is numbered in place, which is the ADU Verify later compares the response to.
+func (h *mbapNetHandler) Send(aduRequest []byte) ([]byte, error) {
+	if len(aduRequest) < mbapHeaderSize {
+		return nil, fmt.Errorf("modbus: request length '%v' does not meet minimum '%v'", len(aduRequest), mbapHeaderSize)
+	}
+	c := h.conn
+	c.transactionId++
+	binary.BigEndian.PutUint16(aduRequest, c.transactionId)
+
+	return h.send(aduRequest, func(conn net.Conn) ([]byte, error) {
+		for {
+			var frame []byte
+			var err error
+			if c.kind == TransportUDP {
+				frame, err = readDatagram(conn)
+			} else {
+				frame, err = readMBAPFrame(conn)
+			}
+			if err != nil || binary.BigEndian.Uint16(frame) == c.transactionId {
+				return frame, err
+			}
+			// A late response to an earlier request
+			Traffic.Capture(DirectionRX, string(c.kind), c.address, frame)
+		}
+	})
+}
+
+// rtuNetHandler sends raw RTU frames over TCP, as serial to Ethernet converters pass them
+type rtuNetHandler struct {
+	*modbus.RTUClientHandler
+	*netExchange
+}
+
+// Send writes the request and reads until a complete RTU response frame arrived
+func (h *rtuNetHandler) Send(aduRequest []byte) ([]byte, error) {
+	return h.send(aduRequest, func(conn net.Conn) ([]byte, error) {
+		return readRTUFrame(h.ctx, &pollingReader{conn: conn}, h.timing.Timeout)
+	})
+}
+
+// readMBAPFrame reads one MBAP frame from a stream
+func readMBAPFrame(conn io.Reader) ([]byte, error) {
+	header := make([]byte, mbapHeaderSize)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 1 || length > udpMaxFrame-mbapHeaderSize+1 {
+		return header, fmt.Errorf("modbus: length in response header '%v' must not be zero or greater than '%v'", length, udpMaxFrame-mbapHeaderSize+1)
+	}
+	frame := make([]byte, mbapHeaderSize+length-1)
+	copy(frame, header)
+	if _, err := io.ReadFull(conn, frame[mbapHeaderSize:]); err != nil {
+		return frame, err
+	}
+	return frame, nil
+}
+
+// readDatagram reads one UDP datagram holding an MBAP frame
+func readDatagram(conn io.Reader) ([]byte, error) {
+	buf := make([]byte, udpMaxFrame)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n < mbapHeaderSize {
+		return buf[:n], fmt.Errorf("modbus: response length '%v' does not meet minimum '%v'", n, mbapHeaderSize)
+	}
+	return buf[:n], nil
+}
+
+// pollingReader reads a network connection in short slices like the serial ports do,
+// reporting an empty slice as serial.ErrTimeout, so RTU frames are read the same on both
+type pollingReader struct {
+	conn net.Conn
+}
+
+func (r *pollingReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(portReadTimeout))
+	n, err := r.conn.Read(p)
+	if err != nil && isNetTimeout(err) {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, serial.ErrTimeout
+	}
+	return n, err
+}
+
+// isNetTimeout reports whether err is a network deadline expiring
+func isNetTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,288 @@
+package nexus_modbus
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/goburrow/modbus"
+)
+
+// Protocol limits of one read request
+const (
+	MaxReadRegisters = 125  // FC3 and FC4
+	MaxReadBits      = 2000 // FC1 and FC2
+)
+
+// ReadRange is a span of coils or registers of one table, also one request of a read plan
+type ReadRange struct {
+	FunctionCode int
+	Address      int
+	Quantity     int
+}
+
+// end returns the address after the range
+func (r ReadRange) end() int {
+	return r.Address + r.Quantity
+}
+
+// ReadPlanner splits reads into protocol-legal requests
+type ReadPlanner struct {
+	MaxRegisters int         // Registers per request, MaxReadRegisters when 0 or above
+	MaxBits      int         // Coils or inputs per request, MaxReadBits when 0 or above
+	Holes        []ReadRange // Addresses the device does not implement, never read
+}
+
+// limit returns the items one request of the function code may read
+func (p ReadPlanner) limit(functionCode int) int {
+	if functionCode == 1 || functionCode == 2 {
+		if p.MaxBits > 0 && p.MaxBits < MaxReadBits {
+			return p.MaxBits
+		}
+		return MaxReadBits
+	}
+	if p.MaxRegisters > 0 && p.MaxRegisters < MaxReadRegisters {
+		return p.MaxRegisters
+	}
+	return MaxReadRegisters
+}
+
+// holeBetween reports whether a hole of the table lies in [from, to)
+func (p ReadPlanner) holeBetween(functionCode, from, to int) bool {
+	for _, hole := range p.Holes {
+		if hole.FunctionCode == functionCode && hole.Address < to && hole.end() > from {
+			return true
+		}
+	}
+	return false
+}
+
+// cutHoles returns the parts of a range outside the holes
+func (p ReadPlanner) cutHoles(r ReadRange) []ReadRange {
+	pieces := []ReadRange{r}
+	for _, hole := range p.Holes {
+		if hole.FunctionCode != r.FunctionCode {
+			continue
+		}
+		var kept []ReadRange
+		for _, piece := range pieces {
+			if hole.end() <= piece.Address || hole.Address >= piece.end() {
+				kept = append(kept, piece)
+				continue
+			}
+			if hole.Address > piece.Address {
+				kept = append(kept, ReadRange{r.FunctionCode, piece.Address, hole.Address - piece.Address})
+			}
+			if hole.end() < piece.end() {
+				kept = append(kept, ReadRange{r.FunctionCode, hole.end(), piece.end() - hole.end()})
+			}
+		}
+		pieces = kept
+	}
+	return pieces
+}
+
+// Plan returns the requests that read all ranges, skipping the holes. Ranges of a table share a
+// request while they fit in it and no hole lies between them. A range longer than one request
+// is split, shorter ones, such as the points of a profile, are never split.
+func (p ReadPlanner) Plan(ranges []ReadRange) []ReadRange {
+	var pieces []ReadRange
+	for _, r := range ranges {
+		if r.Quantity > 0 {
+			pieces = append(pieces, p.cutHoles(r)...)
+		}
+	}
+	sort.SliceStable(pieces, func(i, j int) bool {
+		if pieces[i].FunctionCode != pieces[j].FunctionCode {
+			return pieces[i].FunctionCode < pieces[j].FunctionCode
+		}
+		return pieces[i].Address < pieces[j].Address
+	})
+
+	var chunks []ReadRange
+	for _, r := range pieces {
+		limit := p.limit(r.FunctionCode)
+		if n := len(chunks); n > 0 && chunks[n-1].FunctionCode == r.FunctionCode {
+			last := &chunks[n-1]
+			if r.end() <= last.end() {
+				continue
+			}
+			if r.Address < last.end() {
+				// Overlapping ranges, only the rest is left to read
+				r.Quantity, r.Address = r.end()-last.end(), last.end()
+			}
+			switch {
+			case !p.holeBetween(r.FunctionCode, last.end(), r.Address) && r.end()-last.Address <= limit:
+				last.Quantity = r.end() - last.Address
+				continue
+			case r.Quantity > limit && r.Address == last.end() && last.Quantity < limit:
+				// Fill the last request before splitting the rest
+				take := limit - last.Quantity
+				last.Quantity += take
+				r.Address, r.Quantity = r.Address+take, r.Quantity-take
+			}
+		}
+		for r.Quantity > 0 {
+			chunk := r
+			if chunk.Quantity > limit {
+				chunk.Quantity = limit
+			}
+			chunks = append(chunks, chunk)
+			r.Address, r.Quantity = r.Address+chunk.Quantity, r.Quantity-chunk.Quantity
+		}
+	}
+	return chunks
+}
+
+// ChunkResult is the outcome of one request of a read plan
+type ChunkResult struct {
+	ReadRange
+	Err error
+}
+
+// readAddress identifies one coil or register of a read set
+type readAddress struct {
+	functionCode int
+	address      int
+}
+
+// ReadSet holds the results of a read plan by table and address
+type ReadSet struct {
+	Chunks []ChunkResult
+
+	values map[readAddress]uint16 // Register values, or 0 or 1 for coils and inputs
+	errors map[readAddress]error  // Error of the request covering a failed address
+}
+
+// ReadPlan performs the requests of a plan in order. A failed request fails only the
+// addresses it covers.
+func ReadPlan(client modbus.Client, chunks []ReadRange) *ReadSet {
+	set := &ReadSet{values: make(map[readAddress]uint16), errors: make(map[readAddress]error)}
+	for _, chunk := range chunks {
+		results, err := ReadItems(client, chunk.FunctionCode, uint16(chunk.Address), uint16(chunk.Quantity))
+		bits := chunk.FunctionCode == 1 || chunk.FunctionCode == 2
+		size := 2 * chunk.Quantity
+		if bits {
+			size = (chunk.Quantity + 7) / 8
+		}
+		if err == nil && len(results) < size {
+			err = fmt.Errorf("short response: %d bytes for %d items", len(results), chunk.Quantity)
+		}
+		set.Chunks = append(set.Chunks, ChunkResult{ReadRange: chunk, Err: err})
+
+		for i := 0; i < chunk.Quantity; i++ {
+			key := readAddress{chunk.FunctionCode, chunk.Address + i}
+			switch {
+			case err != nil:
+				set.errors[key] = err
+			case bits:
+				set.values[key] = uint16(results[i/8] >> uint(i%8) & 1)
+			default:
+				set.values[key] = uint16(results[2*i])<<8 | uint16(results[2*i+1])
+			}
+		}
+	}
+	return set
+}
+
+// Err returns the error of the first failed request, nil when all succeeded
+func (s *ReadSet) Err() error {
+	for _, chunk := range s.Chunks {
+		if chunk.Err != nil {
+			return chunk.Err
+		}
+	}
+	return nil
+}
+
+// Failed reports whether every request failed
+func (s *ReadSet) Failed() bool {
+	for _, chunk := range s.Chunks {
+		if chunk.Err == nil {
+			return false
+		}
+	}
+	return len(s.Chunks) > 0
+}
+
+// Data returns quantity items at address in the response format of the function code:
+// register bytes for FC3 and FC4, bits packed LSB first for FC1 and FC2
+func (s *ReadSet) Data(functionCode, address, quantity int) ([]byte, error) {
+	bits := functionCode == 1 || functionCode == 2
+	var data []byte
+	if bits {
+		data = make([]byte, (quantity+7)/8)
+	}
+	for i := 0; i < quantity; i++ {
+		key := readAddress{functionCode, address + i}
+		if err, ok := s.errors[key]; ok {
+			return nil, err
+		}
+		value, ok := s.values[key]
+		if !ok {
+			return nil, fmt.Errorf("address %d was not read", address+i)
+		}
+		if bits {
+			data[i/8] |= byte(value) << uint(i%8)
+		} else {
+			data = append(data, byte(value>>8), byte(value))
+		}
+	}
+	return data, nil
+}
+
+// RangeValue is one decoded value of a range with the raw data it came from
+type RangeValue struct {
+	DecodedValue
+	Address int
+	Raw     []byte // Register bytes, or 0 or 1 for a coil or input
+	Err     error  // The read of the value failed
+}
+
+// Decode returns the values of count items at address. Coils and inputs read as ON or OFF,
+// registers with the data type. Registers left over at the end carry an error.
+func (s *ReadSet) Decode(functionCode, address, count int, dataType DataType, order ByteOrder) []RangeValue {
+	var values []RangeValue
+	if functionCode == 1 || functionCode == 2 {
+		for i := 0; i < count; i++ {
+			value := RangeValue{Address: address + i, DecodedValue: DecodedValue{Offset: i, Registers: 1, Numeric: true}}
+			data, err := s.Data(functionCode, address+i, 1)
+			if err != nil {
+				value.Err = err
+			} else {
+				value.Raw = data
+				value.Number, value.Text = float64(data[0]), "OFF"
+				if data[0] != 0 {
+					value.Text = "ON"
+				}
+			}
+			values = append(values, value)
+		}
+		return values
+	}
+
+	size := dataType.Registers()
+	if size == 0 {
+		// A string spans the whole range
+		size = count
+	}
+	offset := 0
+	for ; size > 0 && offset+size <= count; offset += size {
+		value := RangeValue{Address: address + offset, DecodedValue: DecodedValue{Offset: offset, Registers: size}}
+		data, err := s.Data(functionCode, address+offset, size)
+		if err != nil {
+			value.Err = err
+		} else {
+			value.DecodedValue = DecodeValue(data, dataType, order)
+			value.Offset, value.Registers, value.Raw = offset, size, data
+		}
+		values = append(values, value)
+	}
+	for ; offset < count; offset++ {
+		values = append(values, RangeValue{
+			Address:      address + offset,
+			DecodedValue: DecodedValue{Offset: offset, Registers: 1},
+			Err:          fmt.Errorf("not enough registers to decode %s", dataType),
+		})
+	}
+	return values
+}
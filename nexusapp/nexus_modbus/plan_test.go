@@ -0,0 +1,96 @@
+package nexus_modbus
+
+import (
+	"fmt"
+	"testing"
+)
+
+// plan formats requests for comparison, an empty plan matches nil
+func plan(requests ...ReadRange) string {
+	return fmt.Sprint(requests)
+}
+
+func TestReadPlannerPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		planner ReadPlanner
+		ranges  []ReadRange
+		want    []ReadRange
+	}{
+		{
+			name:   "500 registers",
+			ranges: []ReadRange{{3, 0, 500}},
+			want:   []ReadRange{{3, 0, 125}, {3, 125, 125}, {3, 250, 125}, {3, 375, 125}},
+		},
+		{
+			name:    "hole inside the range",
+			planner: ReadPlanner{Holes: []ReadRange{{3, 100, 10}}},
+			ranges:  []ReadRange{{3, 0, 200}},
+			want:    []ReadRange{{3, 0, 100}, {3, 110, 90}},
+		},
+		{
+			name:    "hole of another table",
+			planner: ReadPlanner{Holes: []ReadRange{{4, 100, 10}}},
+			ranges:  []ReadRange{{3, 0, 200}},
+			want:    []ReadRange{{3, 0, 125}, {3, 125, 75}},
+		},
+		{
+			name:    "range inside a hole",
+			planner: ReadPlanner{Holes: []ReadRange{{3, 100, 10}}},
+			ranges:  []ReadRange{{3, 102, 4}, {3, 0, 0}},
+			want:    nil,
+		},
+		{
+			name:    "points on both sides of a hole",
+			planner: ReadPlanner{Holes: []ReadRange{{3, 20, 1}}},
+			ranges:  []ReadRange{{3, 10, 2}, {3, 30, 2}},
+			want:    []ReadRange{{3, 10, 2}, {3, 30, 2}},
+		},
+		{
+			name:   "overlapping profile points",
+			ranges: []ReadRange{{3, 40, 4}, {3, 11, 2}, {3, 10, 2}, {3, 12, 1}, {3, 200, 2}},
+			want:   []ReadRange{{3, 10, 34}, {3, 200, 2}},
+		},
+		{
+			name:   "points are not split across requests",
+			ranges: []ReadRange{{3, 0, 2}, {3, 124, 2}},
+			want:   []ReadRange{{3, 0, 2}, {3, 124, 2}},
+		},
+		{
+			name:   "fill the last request before splitting",
+			ranges: []ReadRange{{3, 0, 100}, {3, 100, 200}},
+			want:   []ReadRange{{3, 0, 125}, {3, 125, 125}, {3, 250, 50}},
+		},
+		{
+			name:    "MaxRegisters below 125",
+			planner: ReadPlanner{MaxRegisters: 50},
+			ranges:  []ReadRange{{4, 0, 120}},
+			want:    []ReadRange{{4, 0, 50}, {4, 50, 50}, {4, 100, 20}},
+		},
+		{
+			name:    "MaxRegisters above 125",
+			planner: ReadPlanner{MaxRegisters: 200},
+			ranges:  []ReadRange{{3, 0, 130}},
+			want:    []ReadRange{{3, 0, 125}, {3, 125, 5}},
+		},
+		{
+			name:    "bits keep their own limit",
+			planner: ReadPlanner{MaxRegisters: 10},
+			ranges:  []ReadRange{{3, 0, 20}, {1, 0, 2500}},
+			want:    []ReadRange{{1, 0, 2000}, {1, 2000, 500}, {3, 0, 10}, {3, 10, 10}},
+		},
+		{
+			name:    "MaxBits below 2000",
+			planner: ReadPlanner{MaxBits: 100},
+			ranges:  []ReadRange{{2, 0, 250}, {3, 0, 130}},
+			want:    []ReadRange{{2, 0, 100}, {2, 100, 100}, {2, 200, 50}, {3, 0, 125}, {3, 125, 5}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.planner.Plan(test.ranges); plan(got...) != plan(test.want...) {
+				t.Fatalf("Plan(%v) = %v, want %v", test.ranges, got, test.want)
+			}
+		})
+	}
+}
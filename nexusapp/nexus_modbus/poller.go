@@ -0,0 +1,209 @@
+package nexus_modbus
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// queuedRequest is a request waiting for its turn on the poller queue
+type queuedRequest struct {
+	ctx  context.Context
+	fn   func(ctx context.Context) error
+	done chan error
+}
+
+// Poller repeats a poll at an interval and runs it on one queue with all other requests
+// of a tool, so a write never overlaps a poll. Start, Stop, Pause and Resume are safe to
+// call from any goroutine and cancel a poll in flight instead of waiting for it.
+type Poller struct {
+	queue chan *queuedRequest
+
+	mu          sync.Mutex
+	stop        context.CancelFunc // Ends the running poll loop, nil when stopped
+	cancelCycle context.CancelFunc // Cancels the poll in flight
+	paused      bool
+	resume      chan struct{} // Closed when a pause ends
+}
+
+// NewPoller creates a stopped poller and starts its request queue
+func NewPoller() *Poller {
+	p := &Poller{queue: make(chan *queuedRequest)}
+	go p.work()
+	return p
+}
+
+// work runs the queued requests one after another
+func (p *Poller) work() {
+	for request := range p.queue {
+		if err := request.ctx.Err(); err != nil {
+			request.done <- err
+			continue
+		}
+		request.done <- request.fn(request.ctx)
+	}
+}
+
+// Do runs fn on the queue after the requests queued before it and returns its error.
+// It returns early with the context error when ctx is done, fn then sees the same ctx.
+func (p *Poller) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	request := &queuedRequest{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	select {
+	case p.queue <- request:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-request.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Start begins polling, calling poll on the queue and waiting interval() between polls.
+// poll must check its context before showing results, a stopped poll may still return.
+func (p *Poller) Start(interval func() time.Duration, poll func(ctx context.Context)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop != nil {
+		return
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	p.stop = stop
+	p.paused = false
+	p.resume = make(chan struct{})
+	go p.loop(ctx, interval, poll)
+}
+
+// Stop ends polling and cancels the poll in flight
+func (p *Poller) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop != nil {
+		p.stop()
+		p.stop = nil
+	}
+	p.paused = false
+}
+
+// Pause suspends polling until Resume, cancelling the poll in flight
+func (p *Poller) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stop == nil || p.paused {
+		return
+	}
+	p.paused = true
+	if p.cancelCycle != nil {
+		p.cancelCycle()
+	}
+}
+
+// Resume continues a paused poller with an immediate poll
+func (p *Poller) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		return
+	}
+	p.paused = false
+	close(p.resume)
+	p.resume = make(chan struct{})
+}
+
+// Running reports whether the poller has been started and not stopped
+func (p *Poller) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stop != nil
+}
+
+// Paused reports whether a running poller is paused
+func (p *Poller) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused
+}
+
+func (p *Poller) loop(ctx context.Context, interval func() time.Duration, poll func(ctx context.Context)) {
+	for {
+		if !p.waitWhilePaused(ctx) {
+			return
+		}
+
+		cycle, ok := p.startCycle(ctx)
+		if ok {
+			p.Do(cycle, func(ctx context.Context) error {
+				poll(ctx)
+				return nil
+			})
+			p.endCycle()
+		}
+
+		timer := time.NewTimer(interval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-p.resumed():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// waitWhilePaused blocks while the poller is paused and reports whether polling goes on
+func (p *Poller) waitWhilePaused(ctx context.Context) bool {
+	for {
+		p.mu.Lock()
+		paused, resume := p.paused, p.resume
+		p.mu.Unlock()
+
+		if !paused {
+			return ctx.Err() == nil
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-resume:
+		}
+	}
+}
+
+// resumed returns a channel closed when the current or next pause ends
+func (p *Poller) resumed() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.resume
+}
+
+// startCycle derives the context of one poll, unless a pause came in meanwhile
+func (p *Poller) startCycle(ctx context.Context) (context.Context, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		return nil, false
+	}
+	cycle, cancel := context.WithCancel(ctx)
+	p.cancelCycle = cancel
+	return cycle, true
+}
+
+func (p *Poller) endCycle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancelCycle != nil {
+		p.cancelCycle()
+		p.cancelCycle = nil
+	}
+}
@@ -0,0 +1,265 @@
+package nexus_modbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitTimeout bounds every wait in the poller tests, a poller that hangs fails instead of blocking
+const waitTimeout = 5 * time.Second
+
+func fixedInterval(d time.Duration) func() time.Duration {
+	return func() time.Duration { return d }
+}
+
+// receive waits for a value on ch or fails the test
+func receive(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(waitTimeout):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestPollerStartStop(t *testing.T) {
+	p := NewPoller()
+	polled := make(chan struct{}, 100)
+	p.Start(fixedInterval(time.Millisecond), func(ctx context.Context) {
+		polled <- struct{}{}
+	})
+	if !p.Running() {
+		t.Fatal("poller not running after Start")
+	}
+	for i := 0; i < 3; i++ {
+		receive(t, polled, "a poll")
+	}
+
+	p.Stop()
+	if p.Running() {
+		t.Fatal("poller still running after Stop")
+	}
+	// A poll that had already started may still report, nothing after it
+	time.Sleep(20 * time.Millisecond)
+	for len(polled) > 0 {
+		<-polled
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(polled); n != 0 {
+		t.Fatalf("%d poll(s) after Stop", n)
+	}
+
+	// A stopped poller starts again
+	p.Start(fixedInterval(time.Millisecond), func(ctx context.Context) {
+		polled <- struct{}{}
+	})
+	receive(t, polled, "a poll after restarting")
+	p.Stop()
+}
+
+func TestPollerStartTwice(t *testing.T) {
+	p := NewPoller()
+	defer p.Stop()
+
+	first := make(chan struct{}, 100)
+	second := make(chan struct{}, 100)
+	p.Start(fixedInterval(time.Millisecond), func(ctx context.Context) { first <- struct{}{} })
+	p.Start(fixedInterval(time.Millisecond), func(ctx context.Context) { second <- struct{}{} })
+	receive(t, first, "a poll of the first Start")
+	receive(t, first, "a second poll of the first Start")
+	if len(second) != 0 {
+		t.Fatal("a second Start replaced the running poll")
+	}
+}
+
+func TestPollerPauseResume(t *testing.T) {
+	p := NewPoller()
+	defer p.Stop()
+
+	polled := make(chan struct{}, 100)
+	// The interval is far longer than the test, only Start and Resume trigger a poll
+	p.Start(fixedInterval(time.Hour), func(ctx context.Context) {
+		polled <- struct{}{}
+	})
+	receive(t, polled, "the first poll")
+
+	p.Pause()
+	if !p.Paused() || !p.Running() {
+		t.Fatalf("after Pause: paused %v, running %v", p.Paused(), p.Running())
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(polled); n != 0 {
+		t.Fatalf("%d poll(s) while paused", n)
+	}
+
+	p.Resume()
+	if p.Paused() {
+		t.Fatal("still paused after Resume")
+	}
+	receive(t, polled, "the poll on Resume")
+
+	// Stop ends a pause
+	p.Pause()
+	p.Stop()
+	if p.Paused() || p.Running() {
+		t.Fatalf("after Stop: paused %v, running %v", p.Paused(), p.Running())
+	}
+}
+
+func TestPollerDoBetweenPolls(t *testing.T) {
+	p := NewPoller()
+	defer p.Stop()
+
+	var mu sync.Mutex
+	active := 0
+	overlapped := false
+	enter := func() {
+		mu.Lock()
+		active++
+		if active > 1 {
+			overlapped = true
+		}
+		mu.Unlock()
+	}
+	leave := func() {
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}
+
+	pollStarted := make(chan struct{}, 100)
+	release := make(chan struct{})
+	p.Start(fixedInterval(time.Millisecond), func(ctx context.Context) {
+		enter()
+		defer leave()
+		pollStarted <- struct{}{}
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+	})
+	receive(t, pollStarted, "the first poll")
+
+	// The request waits for the poll in flight
+	done := make(chan error, 1)
+	ran := make(chan struct{})
+	go func() {
+		done <- p.Do(context.Background(), func(ctx context.Context) error {
+			enter()
+			defer leave()
+			close(ran)
+			return errors.New("write failed")
+		})
+	}()
+	select {
+	case <-ran:
+		t.Fatal("request ran while a poll was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	receive(t, ran, "the queued request")
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "write failed" {
+			t.Fatalf("Do returned %v, want the request's error", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("timed out waiting for Do to return")
+	}
+
+	// Polling goes on after the request
+	receive(t, pollStarted, "a poll after the request")
+	mu.Lock()
+	defer mu.Unlock()
+	if overlapped {
+		t.Fatal("a request overlapped a poll")
+	}
+}
+
+func TestPollerDoCancelled(t *testing.T) {
+	p := NewPoller()
+	defer p.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go p.Do(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	receive(t, started, "the blocking request")
+
+	// A request cancelled while it waits returns early and never runs
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Do(ctx, func(ctx context.Context) error {
+			t.Error("cancelled request ran")
+			return nil
+		})
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("Do returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("cancelled Do did not return")
+	}
+	close(release)
+
+	// The queue still works afterwards
+	if err := p.Do(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Do after a cancelled request: %v", err)
+	}
+}
+
+func TestPollerCancelsPollInFlight(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		cancel func(p *Poller)
+	}{
+		{"Pause", (*Poller).Pause},
+		{"Stop", (*Poller).Stop},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPoller()
+			defer p.Stop()
+
+			started := make(chan struct{}, 100)
+			cancelled := make(chan error, 100)
+			p.Start(fixedInterval(time.Hour), func(ctx context.Context) {
+				started <- struct{}{}
+				select {
+				case <-ctx.Done():
+					cancelled <- ctx.Err()
+				case <-time.After(waitTimeout):
+					cancelled <- nil
+				}
+			})
+			receive(t, started, "the poll")
+
+			test.cancel(p)
+			select {
+			case err := <-cancelled:
+				if err != context.Canceled {
+					t.Fatalf("poll ended with %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(waitTimeout):
+				t.Fatal("poll in flight was not cancelled")
+			}
+
+			// The queue is free again at once, not after the poll's own timeout
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := p.Do(ctx, func(ctx context.Context) error { return nil }); err != nil {
+				t.Fatalf("Do after %s: %v", test.name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package nexus_modbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goburrow/modbus"
+	"gopkg.in/yaml.v3"
+)
+
+// Point access modes of a device profile
+const (
+	AccessReadOnly  = "read-only"
+	AccessReadWrite = "read-write"
+)
+
+// ProfilePoint is one named value of a device profile
+type ProfilePoint struct {
+	Name    string         `json:"name" yaml:"name"`
+	Table   string         `json:"table" yaml:"table"` // coil, discrete, holding or input, or function code 1-4
+	Address int            `json:"address" yaml:"address"`
+	Type    DataType       `json:"type,omitempty" yaml:"type,omitempty"`
+	Order   ByteOrder      `json:"order,omitempty" yaml:"order,omitempty"`   // The profile's order when omitted
+	Length  int            `json:"length,omitempty" yaml:"length,omitempty"` // Registers of a string
+	Scale   float64        `json:"scale,omitempty" yaml:"scale,omitempty"`   // 1 when omitted
+	Offset  float64        `json:"offset,omitempty" yaml:"offset,omitempty"`
+	Unit    string         `json:"unit,omitempty" yaml:"unit,omitempty"`
+	Access  string         `json:"access,omitempty" yaml:"access,omitempty"` // read-only when omitted
+	Enum    map[int]string `json:"enum,omitempty" yaml:"enum,omitempty"`     // Labels of whole values
+	Bits    map[int]string `json:"bits,omitempty" yaml:"bits,omitempty"`     // Labels of the set bits, 0 is the LSB
+
+	functionCode int
+}
+
+// Profile is a named register map of a device model
+type Profile struct {
+	Name         string         `json:"name" yaml:"name"`
+	Manufacturer string         `json:"manufacturer,omitempty" yaml:"manufacturer,omitempty"`
+	Model        string         `json:"model,omitempty" yaml:"model,omitempty"`
+	Description  string         `json:"description,omitempty" yaml:"description,omitempty"`
+	Order        ByteOrder      `json:"order,omitempty" yaml:"order,omitempty"` // ABCD when omitted
+	Points       []ProfilePoint `json:"points" yaml:"points"`
+	Source       string         `json:"-" yaml:"-"` // File the profile was loaded from
+
+	// Read limits of the device, the protocol limits when omitted
+	MaxRegisters int           `json:"maxRegisters,omitempty" yaml:"maxRegisters,omitempty"`
+	MaxBits      int           `json:"maxBits,omitempty" yaml:"maxBits,omitempty"`
+	Holes        []ProfileHole `json:"holes,omitempty" yaml:"holes,omitempty"` // Addresses never read
+}
+
+// ProfileHole is a span of addresses a device does not implement, reading it fails the whole request
+type ProfileHole struct {
+	Table    string `json:"table" yaml:"table"`
+	Address  int    `json:"address" yaml:"address"`
+	Quantity int    `json:"quantity,omitempty" yaml:"quantity,omitempty"` // 1 when omitted
+
+	functionCode int
+}
+
+// profileTables maps the table names accepted in profiles to function codes
+var profileTables = map[string]int{
+	"1": 1, "coil": 1, "coils": 1,
+	"2": 2, "discrete": 2, "discrete input": 2, "discrete inputs": 2,
+	"3": 3, "holding": 3, "holding register": 3, "holding registers": 3,
+	"4": 4, "input": 4, "input register": 4, "input registers": 4,
+}
+
+// FunctionCode returns the read function code of the point's table
+func (p ProfilePoint) FunctionCode() int {
+	return p.functionCode
+}
+
+// Writable reports whether the point may be written
+func (p ProfilePoint) Writable() bool {
+	return p.Access == AccessReadWrite && (p.functionCode == 1 || p.functionCode == 3)
+}
+
+// Quantity returns the number of coils or registers the point spans
+func (p ProfilePoint) Quantity() int {
+	if p.functionCode == 1 || p.functionCode == 2 {
+		return 1
+	}
+	if p.Type == TypeString {
+		return p.Length
+	}
+	return p.Type.Registers()
+}
+
+// normalize fills in the defaults of a point and checks it
+func (p *ProfilePoint) normalize(order ByteOrder) error {
+	if p.Name == "" {
+		return fmt.Errorf("point at address %d has no name", p.Address)
+	}
+	functionCode, ok := profileTables[strings.ToLower(strings.TrimSpace(p.Table))]
+	if !ok {
+		return fmt.Errorf("point %q: unknown table %q, use coil, discrete, holding or input", p.Name, p.Table)
+	}
+	p.functionCode = functionCode
+	if p.Address < 0 || p.Address > 65535 {
+		return fmt.Errorf("point %q: address %d is outside 0-65535", p.Name, p.Address)
+	}
+
+	var err error
+	if p.Type, err = ParseDataType(string(p.Type)); err != nil {
+		return fmt.Errorf("point %q: %v", p.Name, err)
+	}
+	if p.Order == "" {
+		p.Order = order
+	}
+	if p.Order, err = ParseByteOrder(string(p.Order)); err != nil {
+		return fmt.Errorf("point %q: %v", p.Name, err)
+	}
+	if p.Type == TypeString && functionCode >= 3 && (p.Length < 1 || p.Length > 125) {
+		return fmt.Errorf("point %q: a string needs a length of 1 to 125 registers", p.Name)
+	}
+	if p.Address+p.Quantity() > 65536 {
+		return fmt.Errorf("point %q runs past address 65535", p.Name)
+	}
+	if p.Scale == 0 {
+		p.Scale = 1
+	}
+
+	switch strings.ToLower(p.Access) {
+	case "", "ro", AccessReadOnly:
+		p.Access = AccessReadOnly
+	case "rw", AccessReadWrite:
+		p.Access = AccessReadWrite
+	default:
+		return fmt.Errorf("point %q: unknown access %q, use read-only or read-write", p.Name, p.Access)
+	}
+	for bit := range p.Bits {
+		if bit < 0 || bit >= 16*p.Quantity() {
+			return fmt.Errorf("point %q: bit %d is outside the value", p.Name, bit)
+		}
+	}
+	return nil
+}
+
+// normalize fills in the defaults of every point and checks the profile
+func (p *Profile) normalize() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile has no name")
+	}
+	order, err := ParseByteOrder(string(p.Order))
+	if err != nil {
+		return err
+	}
+	p.Order = order
+	if len(p.Points) == 0 {
+		return fmt.Errorf("profile %q has no points", p.Name)
+	}
+	if p.MaxRegisters < 0 || p.MaxBits < 0 {
+		return fmt.Errorf("profile %q: read limits cannot be negative", p.Name)
+	}
+	for i := range p.Holes {
+		hole := &p.Holes[i]
+		functionCode, ok := profileTables[strings.ToLower(strings.TrimSpace(hole.Table))]
+		if !ok {
+			return fmt.Errorf("hole at address %d: unknown table %q, use coil, discrete, holding or input", hole.Address, hole.Table)
+		}
+		hole.functionCode = functionCode
+		if hole.Quantity == 0 {
+			hole.Quantity = 1
+		}
+		if hole.Address < 0 || hole.Quantity < 0 || hole.Address+hole.Quantity > 65536 {
+			return fmt.Errorf("hole at address %d is outside 0-65535", hole.Address)
+		}
+	}
+	names := make(map[string]bool)
+	for i := range p.Points {
+		if err := p.Points[i].normalize(order); err != nil {
+			return err
+		}
+		if names[p.Points[i].Name] {
+			return fmt.Errorf("point %q is listed twice", p.Points[i].Name)
+		}
+		names[p.Points[i].Name] = true
+	}
+	return nil
+}
+
+// Point returns the point with the given name
+func (p *Profile) Point(name string) (ProfilePoint, bool) {
+	for _, point := range p.Points {
+		if point.Name == name {
+			return point, true
+		}
+	}
+	return ProfilePoint{}, false
+}
+
+// ParseProfile reads a profile from YAML, or JSON when the data starts with a brace
+func ParseProfile(data []byte) (*Profile, error) {
+	profile := &Profile{}
+	var err error
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		err = json.Unmarshal(data, profile)
+	} else {
+		err = yaml.Unmarshal(data, profile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := profile.normalize(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// LoadProfile reads a profile file
+func LoadProfile(path string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := ParseProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	profile.Source = path
+	return profile, nil
+}
+
+// isProfileFile reports whether a file name has a profile extension
+func isProfileFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// DefaultProfileDir is the profile library directory in the user's configuration folder
+func DefaultProfileDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "profiles"
+	}
+	return filepath.Join(dir, "NexusScanner", "profiles")
+}
+
+// ProfileLibrary holds the profiles loaded from a directory
+type ProfileLibrary struct {
+	mu       sync.Mutex
+	dir      string
+	profiles []*Profile
+	errors   []error // Files that could not be loaded
+}
+
+// Profiles is the library shared by the tools, loaded at startup
+var Profiles = &ProfileLibrary{}
+
+// Load replaces the library with the profiles in dir, sorted by name. A missing directory
+// is an empty library, a file that fails to load is skipped and reported by Errors.
+func (l *ProfileLibrary) Load(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var profiles []*Profile
+	var errors []error
+	names := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !isProfileFile(entry.Name()) {
+			continue
+		}
+		profile, err := LoadProfile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if other, ok := names[profile.Name]; ok {
+			errors = append(errors, fmt.Errorf("%s: profile %q is already defined in %s", entry.Name(), profile.Name, other))
+			continue
+		}
+		names[profile.Name] = entry.Name()
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dir, l.profiles, l.errors = dir, profiles, errors
+	return nil
+}
+
+// Dir returns the directory the library was loaded from
+func (l *ProfileLibrary) Dir() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.dir
+}
+
+// List returns the loaded profiles
+func (l *ProfileLibrary) List() []*Profile {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]*Profile(nil), l.profiles...)
+}
+
+// Names returns the names of the loaded profiles
+func (l *ProfileLibrary) Names() []string {
+	var names []string
+	for _, profile := range l.List() {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// Get returns the profile with the given name
+func (l *ProfileLibrary) Get(name string) (*Profile, bool) {
+	for _, profile := range l.List() {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+// Errors returns the errors of the files that failed to load
+func (l *ProfileLibrary) Errors() []error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]error(nil), l.errors...)
+}
+
+// PointValue is the engineering value of one profile point
+type PointValue struct {
+	Point   ProfilePoint
+	Raw     []byte  // Register bytes, or 0 or 1 for a coil or input
+	Text    string  // Scaled value with its unit, enum label or set bit labels
+	Number  float64 // Scaled value, valid when Numeric is set
+	Numeric bool
+	Err     error // The read of the point failed
+}
+
+// FormatPoint turns the raw data of a point into its engineering value
+func FormatPoint(point ProfilePoint, raw []byte) PointValue {
+	value := PointValue{Point: point, Raw: raw}
+	if point.functionCode == 1 || point.functionCode == 2 {
+		value.Number, value.Numeric = float64(raw[0]&1), true
+		value.Text = "OFF"
+		if raw[0]&1 != 0 {
+			value.Text = "ON"
+		}
+		if label, ok := point.Enum[int(raw[0]&1)]; ok {
+			value.Text = label
+		}
+		return value
+	}
+
+	decoded := DecodeValue(raw, point.Type, point.Order)
+	if !decoded.Numeric {
+		value.Text = decoded.Text
+		return value
+	}
+	if label, ok := point.Enum[int(decoded.Number)]; ok {
+		value.Number, value.Numeric = decoded.Number, true
+		value.Text = label
+		return value
+	}
+	if len(point.Bits) > 0 {
+		value.Number, value.Numeric = decoded.Number, true
+		value.Text = bitLabels(point.Bits, reorder(raw, point.Order))
+		return value
+	}
+
+	value.Number = decoded.Number*point.Scale + point.Offset
+	value.Numeric = true
+	if point.Scale == 1 && point.Offset == 0 {
+		value.Text = decoded.Text
+	} else {
+		value.Text = strconv.FormatFloat(value.Number, 'f', scaleDecimals(point.Scale), 64)
+	}
+	if point.Unit != "" {
+		value.Text += " " + point.Unit
+	}
+	return value
+}
+
+// EncodePoint turns a value typed by the user into a write of the point, the inverse of FormatPoint.
+// Enum labels, coil states and engineering values with or without the unit are accepted.
+// One register is written with FC6, longer types with FC16 and coils with FC5.
+func EncodePoint(point ProfilePoint, text string) (WriteRequest, error) {
+	var request WriteRequest
+	if !point.Writable() {
+		return request, fmt.Errorf("point %q is read-only", point.Name)
+	}
+	text = strings.TrimSpace(text)
+	if point.Unit != "" {
+		text = strings.TrimSpace(strings.TrimSuffix(text, point.Unit))
+	}
+
+	number, labelled := 0.0, false
+	for n, label := range point.Enum {
+		if strings.EqualFold(label, text) {
+			number, labelled = float64(n), true
+		}
+	}
+
+	if point.functionCode == 1 {
+		if labelled {
+			return NewCoilWrite(uint16(point.Address), []bool{number != 0}, false), nil
+		}
+		coils, err := ParseCoils(text)
+		if err != nil {
+			return request, err
+		}
+		if len(coils) != 1 {
+			return request, fmt.Errorf("point %q takes one coil state", point.Name)
+		}
+		return NewCoilWrite(uint16(point.Address), coils, false), nil
+	}
+
+	if point.Type == TypeString {
+		data := EncodeString(text, point.Order)
+		if len(data) > 2*point.Length {
+			return request, fmt.Errorf("point %q holds at most %d characters", point.Name, 2*point.Length)
+		}
+		// Pad with NULs so the old text does not show through
+		data = append(data, make([]byte, 2*point.Length-len(data))...)
+		return NewRegisterWrite(uint16(point.Address), data, false), nil
+	}
+
+	if !labelled {
+		var err error
+		if number, err = ParseNumber(text); err != nil {
+			return request, err
+		}
+		if len(point.Bits) == 0 {
+			number = (number - point.Offset) / point.Scale
+		}
+		if point.Type != TypeFloat32 && point.Type != TypeFloat64 {
+			number = math.Round(number)
+		}
+	}
+	data, err := EncodeValue(number, point.Type, point.Order)
+	if err != nil {
+		return request, err
+	}
+	return NewRegisterWrite(uint16(point.Address), data, false), nil
+}
+
+// scaleDecimals returns the decimals a scale factor gives a value, e.g. 2 for 0.01
+func scaleDecimals(scale float64) int {
+	decimals := 0
+	for scale = math.Abs(scale); decimals < 6 && math.Abs(scale-math.Round(scale)) > 1e-9; decimals++ {
+		scale *= 10
+	}
+	return decimals
+}
+
+// bitLabels lists the labels of the bits set in a big endian value, "none" if no labelled bit is set
+func bitLabels(labels map[int]string, b []byte) string {
+	var bits []int
+	for bit := range labels {
+		byteIndex := len(b) - 1 - bit/8
+		if byteIndex >= 0 && b[byteIndex]&(1<<uint(bit%8)) != 0 {
+			bits = append(bits, bit)
+		}
+	}
+	if len(bits) == 0 {
+		return "none"
+	}
+	sort.Ints(bits)
+	names := make([]string, len(bits))
+	for i, bit := range bits {
+		names[i] = labels[bit]
+	}
+	return strings.Join(names, ", ")
+}
+
+// Planner applies the read limits and holes of the profile to a planner. The smaller of
+// the two limits is kept.
+func (p *Profile) Planner(planner ReadPlanner) ReadPlanner {
+	if p.MaxRegisters > 0 && (planner.MaxRegisters == 0 || p.MaxRegisters < planner.MaxRegisters) {
+		planner.MaxRegisters = p.MaxRegisters
+	}
+	if p.MaxBits > 0 && (planner.MaxBits == 0 || p.MaxBits < planner.MaxBits) {
+		planner.MaxBits = p.MaxBits
+	}
+	holes := append([]ReadRange(nil), planner.Holes...)
+	for _, hole := range p.Holes {
+		holes = append(holes, ReadRange{FunctionCode: hole.functionCode, Address: hole.Address, Quantity: hole.Quantity})
+	}
+	planner.Holes = holes
+	return planner
+}
+
+// ReadProfile reads every point of a profile and returns their values in profile order.
+// Points share requests where the planner and the profile's limits allow. A failed request
+// fails only the points it covers, the error of the first is also returned. When every
+// request fails only the error is returned.
+func ReadProfile(client modbus.Client, profile *Profile, planner ReadPlanner) ([]PointValue, error) {
+	ranges := make([]ReadRange, len(profile.Points))
+	for i, point := range profile.Points {
+		ranges[i] = ReadRange{FunctionCode: point.functionCode, Address: point.Address, Quantity: point.Quantity()}
+	}
+	set := ReadPlan(client, profile.Planner(planner).Plan(ranges))
+	if set.Failed() {
+		return nil, set.Err()
+	}
+
+	values := make([]PointValue, len(profile.Points))
+	for i, point := range profile.Points {
+		raw, err := set.Data(point.functionCode, point.Address, point.Quantity())
+		if err != nil {
+			values[i] = PointValue{Point: point, Err: err}
+			continue
+		}
+		values[i] = FormatPoint(point, raw)
+	}
+	return values, set.Err()
+}
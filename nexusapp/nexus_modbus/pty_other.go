@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package nexus_modbus
+
+import (
+	"errors"
+	"os"
+)
+
+// OpenPseudoTerminal is only available on Linux, elsewhere use a virtual COM port pair
+func OpenPseudoTerminal() (*os.File, string, error) {
+	return nil, "", errors.New("virtual serial ports are only available on Linux, use a com0com pair on Windows")
+}
@@ -0,0 +1,90 @@
+package nexus_modbus
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+const rtuMaxFrame = 256
+
+// SendPDU sends a request that goburrow/modbus has no client method for and returns
+// the response PDU. Exception responses are returned as *modbus.ModbusError.
+func SendPDU(handler modbus.ClientHandler, request *modbus.ProtocolDataUnit) (response *modbus.ProtocolDataUnit, err error) {
+	if counted, ok := handler.(*statsHandler); ok {
+		// Counted with the outcome of every check below
+		start := time.Now()
+		defer func() { counted.stats.Record(counted.device, time.Since(start), err) }()
+		handler = counted.ClientHandler
+	}
+
+	aduRequest, err := handler.Encode(request)
+	if err != nil {
+		return nil, err
+	}
+	aduResponse, err := handler.Send(aduRequest)
+	if err != nil {
+		return nil, err
+	}
+	if err = handler.Verify(aduRequest, aduResponse); err != nil {
+		return nil, err
+	}
+	response, err = handler.Decode(aduResponse)
+	if err != nil {
+		return nil, err
+	}
+	if response.FunctionCode == request.FunctionCode|0x80 {
+		mbErr := &modbus.ModbusError{FunctionCode: response.FunctionCode}
+		if len(response.Data) > 0 {
+			mbErr.ExceptionCode = response.Data[0]
+		}
+		return nil, mbErr
+	}
+	if response.FunctionCode != request.FunctionCode {
+		return nil, fmt.Errorf("modbus: response function code '%v' does not match request '%v'", response.FunctionCode, request.FunctionCode)
+	}
+	return response, nil
+}
+
+// RTUFrameLength returns the total length of a response frame, including slave ID and CRC,
+// once enough of the frame has been received to know it
+func RTUFrameLength(frame []byte) (int, bool) {
+	if len(frame) < 2 {
+		return 0, false
+	}
+	functionCode := frame[1]
+	if functionCode&0x80 != 0 {
+		return 5, true
+	}
+	switch functionCode {
+	case 1, 2, 3, 4, 23:
+		if len(frame) < 3 {
+			return 0, false
+		}
+		return 3 + int(frame[2]) + 2, true
+	case 5, 6, 15, 16:
+		return 8, true
+	case 22:
+		return 10, true
+	case 24:
+		if len(frame) < 4 {
+			return 0, false
+		}
+		return 4 + (int(frame[2])<<8 | int(frame[3])) + 2, true
+	case 43:
+		// MEI header: type, read code, conformity, more follows, next object, object count
+		if len(frame) < 8 {
+			return 0, false
+		}
+		pos := 8
+		for i := 0; i < int(frame[7]); i++ {
+			if len(frame) < pos+2 {
+				return 0, false
+			}
+			pos += 2 + int(frame[pos+1])
+		}
+		return pos + 2, true
+	}
+	return 0, false
+}
@@ -0,0 +1,22 @@
+package nexus_modbus
+
+import (
+	"fmt"
+
+	"github.com/goburrow/modbus"
+)
+
+// ReadItems issues the read for functionCode (1-4) and returns the raw response bytes
+func ReadItems(client modbus.Client, functionCode int, address, quantity uint16) ([]byte, error) {
+	switch functionCode {
+	case 1:
+		return client.ReadCoils(address, quantity)
+	case 2:
+		return client.ReadDiscreteInputs(address, quantity)
+	case 3:
+		return client.ReadHoldingRegisters(address, quantity)
+	case 4:
+		return client.ReadInputRegisters(address, quantity)
+	}
+	return nil, fmt.Errorf("invalid function code %d", functionCode)
+}
@@ -0,0 +1,205 @@
+package nexus_modbus
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RecordFormat selects the file format written by a Recorder
+type RecordFormat string
+
+const (
+	FormatCSV   RecordFormat = "csv"
+	FormatJSONL RecordFormat = "jsonl"
+)
+
+// Record is one logged point of a poll cycle. Failed polls are logged with Error set.
+type Record struct {
+	Time         time.Time `json:"time"`
+	Port         string    `json:"port"`
+	SlaveId      byte      `json:"slaveId"`
+	FunctionCode int       `json:"functionCode"`
+	Address      int       `json:"address"`
+	Raw          string    `json:"raw"`
+	Value        string    `json:"value"`
+	Error        string    `json:"error,omitempty"`
+}
+
+var recordHeader = []string{"time", "port", "slave_id", "function_code", "address", "raw", "value", "error"}
+
+// Recorder appends poll records to files in a directory, starting a new file when the
+// current one exceeds MaxSize bytes or is older than MaxAge. Zero disables a limit.
+type Recorder struct {
+	Dir     string
+	Prefix  string
+	Format  RecordFormat
+	MaxSize int64
+	MaxAge  time.Duration
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	opened time.Time
+	closed bool // Set by Close, later writes fail instead of starting a new file
+}
+
+// NewRecorder creates the output directory and returns a recorder writing into it
+func NewRecorder(dir, prefix string, format RecordFormat, maxSize int64, maxAge time.Duration) (*Recorder, error) {
+	if format != FormatCSV && format != FormatJSONL {
+		return nil, fmt.Errorf("unknown record format %q", format)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create output directory: %v", err)
+	}
+	return &Recorder{Dir: dir, Prefix: prefix, Format: format, MaxSize: maxSize, MaxAge: maxAge}, nil
+}
+
+// Write appends the records of one poll cycle, rotating the file first when a limit is reached
+func (r *Recorder) Write(records []Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return fmt.Errorf("recorder is closed")
+	}
+	if r.file != nil && ((r.MaxSize > 0 && r.size >= r.MaxSize) || (r.MaxAge > 0 && time.Since(r.opened) >= r.MaxAge)) {
+		if err := r.close(); err != nil {
+			return err
+		}
+	}
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	for _, record := range records {
+		line, err := r.encode(record)
+		if err != nil {
+			return err
+		}
+		n, err := r.writer.Write(line)
+		r.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	// Flush every cycle so a crash or power loss keeps everything up to the last poll
+	return r.writer.Flush()
+}
+
+// encode formats one record as a CSV or JSON line
+func (r *Recorder) encode(record Record) ([]byte, error) {
+	if r.Format == FormatJSONL {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	}
+	return csvLine([]string{
+		record.Time.Format(time.RFC3339Nano),
+		record.Port,
+		strconv.Itoa(int(record.SlaveId)),
+		strconv.Itoa(record.FunctionCode),
+		strconv.Itoa(record.Address),
+		record.Raw,
+		record.Value,
+		record.Error,
+	})
+}
+
+// csvLine quotes fields the same way encoding/csv does
+func csvLine(fields []string) ([]byte, error) {
+	var line lineBuffer
+	writer := csv.NewWriter(&line)
+	if err := writer.Write(fields); err != nil {
+		return nil, err
+	}
+	writer.Flush()
+	return line, writer.Error()
+}
+
+type lineBuffer []byte
+
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
+
+// open starts a new file named after the prefix and the current time
+func (r *Recorder) open() error {
+	now := time.Now()
+	base := fmt.Sprintf("%s_%s", r.Prefix, now.Format("20060102_150405"))
+	path := filepath.Join(r.Dir, base+"."+string(r.Format))
+	for i := 1; fileExists(path); i++ {
+		path = filepath.Join(r.Dir, fmt.Sprintf("%s_%d.%s", base, i, r.Format))
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not create log file: %v", err)
+	}
+	r.file = file
+	r.writer = bufio.NewWriter(file)
+	r.size = 0
+	r.opened = now
+
+	if r.Format == FormatCSV {
+		header, err := csvLine(recordHeader)
+		if err != nil {
+			return err
+		}
+		n, err := r.writer.Write(header)
+		r.size += int64(n)
+		return err
+	}
+	return nil
+}
+
+// Path returns the file currently written to, or an empty string before the first write
+func (r *Recorder) Path() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return ""
+	}
+	return r.file.Name()
+}
+
+// Close flushes and closes the current file, the recorder cannot be written to afterwards
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	return r.close()
+}
+
+func (r *Recorder) close() error {
+	if r.file == nil {
+		return nil
+	}
+	flushErr := r.writer.Flush()
+	closeErr := r.file.Close()
+	r.file = nil
+	r.writer = nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,329 @@
+package nexus_modbus
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/goburrow/modbus"
+)
+
+// RegisterRange is a contiguous block of addresses that a device answered for
+type RegisterRange struct {
+	FunctionCode int `json:"functionCode"`
+	Start        int `json:"start"`
+	Count        int `json:"count"`
+}
+
+// End returns the last address of the range
+func (r RegisterRange) End() int {
+	return r.Start + r.Count - 1
+}
+
+// RangeFailure records a block that failed with something other than an address exception
+type RangeFailure struct {
+	FunctionCode int    `json:"functionCode"`
+	Start        int    `json:"start"`
+	Count        int    `json:"count"`
+	Error        string `json:"error"`
+}
+
+// RegisterMap is the result of a register map sweep
+type RegisterMap struct {
+	Ranges               []RegisterRange `json:"ranges"`
+	UnsupportedFunctions []int           `json:"unsupportedFunctions"`
+	Failures             []RangeFailure  `json:"failures"`
+}
+
+// MapOptions controls a register map sweep
+type MapOptions struct {
+	FunctionCodes []int // Function codes to sweep, 1-4
+	Start         int   // First address to probe
+	End           int   // Last address to probe
+	RegisterBlock int   // Largest read for FC3/FC4, at most 125
+	BitBlock      int   // Largest read for FC1/FC2, at most 2000
+	MinBlock      int   // Rejected blocks this small are skipped, also the spacing of sampled addresses
+}
+
+// maxMapSamples bounds the single addresses read to tell an empty block from a mixed one
+const maxMapSamples = 8
+
+// Outcomes of mapping one block
+const (
+	blockRead            = iota // Read in one request
+	blockEmpty                  // Rejected, and no sampled address answered
+	blockSplit                  // Rejected as a whole, its parts were mapped separately
+	blockFailed                 // Failed with something other than an exception
+	blockIllegalFunction        // Rejected with an illegal function exception, a hole like an empty block
+)
+
+// DefaultMapOptions sweeps the whole address space of all four read functions
+func DefaultMapOptions() MapOptions {
+	return MapOptions{
+		FunctionCodes: []int{1, 2, 3, 4},
+		Start:         0,
+		End:           65535,
+		RegisterBlock: 125,
+		BitBlock:      2000,
+		MinBlock:      8,
+	}
+}
+
+type registerMapper struct {
+	client   modbus.Client
+	options  MapOptions
+	ctx      context.Context
+	result   *RegisterMap
+	done     int
+	total    int
+	progress func(done, total int)
+}
+
+// MapRegisters walks the configured address space for each function code. The block size
+// adapts: it grows after blocks that were read or found empty and shrinks after blocks that
+// had to be split. A block rejected with an illegal data address (or value) exception is
+// sampled at a few addresses first. When none answers the block is skipped as empty, else it
+// is bisected until the valid addresses are isolated. Runs of valid addresses shorter than
+// MinBlock may be missed. The readable addresses are merged into ranges.
+// Some devices reject unmapped blocks with an illegal function exception, so such a block is a
+// hole, and a function code is only unsupported when the device rejected every block of it.
+// The sweep returns the partial map when ctx is cancelled. Pass the ctx of the Transport.Do
+// that created client, so the cancel also abandons the read in flight.
+func MapRegisters(ctx context.Context, client modbus.Client, options MapOptions, progress func(done, total int)) *RegisterMap {
+	if options.RegisterBlock <= 0 || options.RegisterBlock > 125 {
+		options.RegisterBlock = 125
+	}
+	if options.BitBlock <= 0 || options.BitBlock > 2000 {
+		options.BitBlock = 2000
+	}
+	if options.MinBlock <= 0 {
+		options.MinBlock = DefaultMapOptions().MinBlock
+	}
+
+	span := options.End - options.Start + 1
+	mp := &registerMapper{
+		client:   client,
+		options:  options,
+		ctx:      ctx,
+		result:   &RegisterMap{},
+		total:    len(options.FunctionCodes) * span,
+		progress: progress,
+	}
+
+	for _, functionCode := range options.FunctionCodes {
+		maxBlock := options.RegisterBlock
+		if functionCode == 1 || functionCode == 2 {
+			maxBlock = options.BitBlock
+		}
+
+		blockSize := maxBlock
+		supported := false
+		for address := options.Start; address <= options.End && !mp.stopped(); {
+			count := blockSize
+			if address+count-1 > options.End {
+				count = options.End - address + 1
+			}
+			outcome := mp.mapBlock(functionCode, address, count)
+			if outcome != blockIllegalFunction && !mp.stopped() {
+				supported = true
+			}
+			address += count
+
+			if outcome == blockSplit {
+				// Valid and invalid addresses are mixed here, smaller blocks waste fewer requests
+				blockSize = count / 2
+				if blockSize < options.MinBlock {
+					blockSize = options.MinBlock
+				}
+			} else if blockSize *= 2; blockSize > maxBlock {
+				blockSize = maxBlock
+			}
+		}
+		if !supported && !mp.stopped() {
+			mp.result.UnsupportedFunctions = append(mp.result.UnsupportedFunctions, functionCode)
+		}
+		mp.refineEdges(functionCode)
+	}
+	return mp.result
+}
+
+// mapBlock reads one block, and samples and bisects it on address exceptions
+func (mp *registerMapper) mapBlock(functionCode, address, count int) int {
+	if mp.stopped() {
+		return blockFailed
+	}
+
+	_, err := ReadItems(mp.client, functionCode, uint16(address), uint16(count))
+	if err == nil {
+		mp.addRange(functionCode, address, count)
+		mp.advance(count)
+		return blockRead
+	}
+	if mp.stopped() {
+		// The read was abandoned, it says nothing about the block
+		return blockFailed
+	}
+
+	if mbErr, ok := err.(*modbus.ModbusError); ok {
+		switch mbErr.ExceptionCode {
+		case modbus.ExceptionCodeIllegalFunction:
+			mp.advance(count)
+			return blockIllegalFunction
+		case modbus.ExceptionCodeIllegalDataAddress, modbus.ExceptionCodeIllegalDataValue:
+			if count <= mp.options.MinBlock {
+				mp.advance(count)
+				return blockEmpty
+			}
+			// Halves of a small block end the bisection anyway, sampling would cost more
+			if count > 2*mp.options.MinBlock && !mp.sample(functionCode, address, count) {
+				mp.advance(count)
+				return blockEmpty
+			}
+			half := count / 2
+			mp.mapBlock(functionCode, address, half)
+			mp.mapBlock(functionCode, address+half, count-half)
+			return blockSplit
+		}
+	}
+
+	mp.result.Failures = append(mp.result.Failures, RangeFailure{
+		FunctionCode: functionCode,
+		Start:        address,
+		Count:        count,
+		Error:        err.Error(),
+	})
+	mp.advance(count)
+	return blockFailed
+}
+
+// sample reads single addresses spread over a rejected block, at least MinBlock apart and
+// always the last one. It reports whether any of them may be valid.
+func (mp *registerMapper) sample(functionCode, address, count int) bool {
+	step := (count + maxMapSamples - 1) / maxMapSamples
+	if step < mp.options.MinBlock {
+		step = mp.options.MinBlock
+	}
+	last := address + count - 1
+	for probe := address; !mp.stopped(); probe += step {
+		if probe > last {
+			probe = last
+		}
+		_, err := ReadItems(mp.client, functionCode, uint16(probe), 1)
+		if mbErr, ok := err.(*modbus.ModbusError); !ok || (mbErr.ExceptionCode != modbus.ExceptionCodeIllegalDataAddress &&
+			mbErr.ExceptionCode != modbus.ExceptionCodeIllegalDataValue && mbErr.ExceptionCode != modbus.ExceptionCodeIllegalFunction) {
+			// Data, a timeout or another exception, the block needs a closer look
+			return true
+		}
+		if probe == last {
+			break
+		}
+	}
+	return false
+}
+
+// refineEdges grows the ranges of a function code one address at a time. Valid addresses next
+// to a range may sit in a rejected block that was too small to bisect.
+func (mp *registerMapper) refineEdges(functionCode int) {
+	var ranges []RegisterRange
+	for _, r := range mp.result.Ranges {
+		if r.FunctionCode != functionCode {
+			ranges = append(ranges, r)
+			continue
+		}
+		low := mp.options.Start
+		if n := len(ranges); n > 0 && ranges[n-1].FunctionCode == functionCode {
+			low = ranges[n-1].End() + 1
+		}
+		for r.Start > low && mp.readable(functionCode, r.Start-1) {
+			r.Start--
+			r.Count++
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].FunctionCode == functionCode && ranges[n-1].End()+1 == r.Start {
+			// The ranges met, merge them
+			ranges[n-1].Count += r.Count
+		} else {
+			ranges = append(ranges, r)
+		}
+
+		last := &ranges[len(ranges)-1]
+		for last.End() < mp.options.End && mp.readable(functionCode, last.End()+1) {
+			last.Count++
+		}
+	}
+
+	// A range grown forward may now touch the next one
+	var merged []RegisterRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && merged[n-1].FunctionCode == r.FunctionCode && merged[n-1].End() >= r.Start-1 {
+			if r.End() > merged[n-1].End() {
+				merged[n-1].Count = r.End() - merged[n-1].Start + 1
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	mp.result.Ranges = merged
+}
+
+// readable reports whether a single address can be read
+func (mp *registerMapper) readable(functionCode, address int) bool {
+	if mp.stopped() {
+		return false
+	}
+	_, err := ReadItems(mp.client, functionCode, uint16(address), 1)
+	return err == nil
+}
+
+// addRange extends the last range when the new block directly follows it
+func (mp *registerMapper) addRange(functionCode, address, count int) {
+	ranges := mp.result.Ranges
+	if n := len(ranges); n > 0 {
+		last := &ranges[n-1]
+		if last.FunctionCode == functionCode && last.End()+1 == address {
+			last.Count += count
+			return
+		}
+	}
+	mp.result.Ranges = append(ranges, RegisterRange{FunctionCode: functionCode, Start: address, Count: count})
+}
+
+func (mp *registerMapper) advance(count int) {
+	mp.done += count
+	if mp.progress != nil {
+		mp.progress(mp.done, mp.total)
+	}
+}
+
+func (mp *registerMapper) stopped() bool {
+	return mp.ctx.Err() != nil
+}
+
+// WriteCSV writes one line per valid range
+func (m *RegisterMap) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"function_code", "start", "end", "count"}); err != nil {
+		return err
+	}
+	for _, r := range m.Ranges {
+		record := []string{
+			strconv.Itoa(r.FunctionCode),
+			strconv.Itoa(r.Start),
+			strconv.Itoa(r.End()),
+			strconv.Itoa(r.Count),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes the complete map, including unsupported functions and failures
+func (m *RegisterMap) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m)
+}
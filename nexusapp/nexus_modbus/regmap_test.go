@@ -0,0 +1,97 @@
+package nexus_modbus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+// mapDevice answers holding register reads inside its ranges, rejects reads touching its holes
+// with an illegal function exception and the others with an illegal data address exception.
+// Input registers are not supported at all.
+type mapDevice struct {
+	modbus.Client // Nil, the mapper only reads registers
+	ranges        []RegisterRange
+	holes         []RegisterRange
+	requests      int
+	onRead        func() // Called before each read, nil when unused
+}
+
+func (d *mapDevice) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	d.requests++
+	if d.onRead != nil {
+		d.onRead()
+	}
+	first, last := int(address), int(address)+int(quantity)-1
+	for _, hole := range d.holes {
+		if first <= hole.End() && last >= hole.Start {
+			return nil, &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+		}
+	}
+	for _, r := range d.ranges {
+		if first >= r.Start && last <= r.End() {
+			return make([]byte, 2*int(quantity)), nil
+		}
+	}
+	return nil, &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+}
+
+func (d *mapDevice) ReadInputRegisters(address, quantity uint16) ([]byte, error) {
+	d.requests++
+	return nil, &modbus.ModbusError{FunctionCode: 0x84, ExceptionCode: modbus.ExceptionCodeIllegalFunction}
+}
+
+func TestMapRegisters(t *testing.T) {
+	device := &mapDevice{
+		ranges: []RegisterRange{{Start: 0, Count: 100}, {Start: 300, Count: 40}},
+		holes:  []RegisterRange{{Start: 100, Count: 150}},
+	}
+	options := MapOptions{FunctionCodes: []int{3, 4}, Start: 0, End: 499, RegisterBlock: 50, MinBlock: 8}
+	lastDone, total := 0, 0
+	result := MapRegisters(context.Background(), device, options, func(done, n int) { lastDone, total = done, n })
+
+	want := []RegisterRange{{FunctionCode: 3, Start: 0, Count: 100}, {FunctionCode: 3, Start: 300, Count: 40}}
+	if len(result.Ranges) != len(want) {
+		t.Fatalf("ranges %+v, want %+v", result.Ranges, want)
+	}
+	for i := range want {
+		if result.Ranges[i] != want[i] {
+			t.Fatalf("ranges %+v, want %+v", result.Ranges, want)
+		}
+	}
+	// The hole rejected with exception 01 does not end FC3, FC4 rejected every block
+	if len(result.UnsupportedFunctions) != 1 || result.UnsupportedFunctions[0] != 4 {
+		t.Errorf("unsupported functions %v, want [4]", result.UnsupportedFunctions)
+	}
+	if len(result.Failures) != 0 {
+		t.Errorf("failures %+v, want none", result.Failures)
+	}
+	if lastDone != 1000 || total != 1000 {
+		t.Errorf("progress ended at %d of %d, want 1000 of 1000", lastDone, total)
+	}
+}
+
+func TestMapRegistersCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	device := &mapDevice{ranges: []RegisterRange{{Start: 0, Count: 100}}}
+	device.onRead = func() {
+		if device.requests == 3 {
+			cancel()
+		}
+	}
+	options := MapOptions{FunctionCodes: []int{3, 4}, Start: 0, End: 65535, RegisterBlock: 50, MinBlock: 8}
+	result := MapRegisters(ctx, device, options, nil)
+
+	if device.requests != 3 {
+		t.Errorf("%d reads, want none after the cancel", device.requests)
+	}
+	// The third read was rejected as the cancel arrived, it is neither a hole nor a failure
+	if len(result.Ranges) != 1 || result.Ranges[0] != (RegisterRange{FunctionCode: 3, Start: 0, Count: 100}) {
+		t.Errorf("ranges %+v after the cancel, want FC3 0-99", result.Ranges)
+	}
+	if len(result.UnsupportedFunctions) != 0 || len(result.Failures) != 0 {
+		t.Errorf("cancelled map reports unsupported functions %v and failures %+v", result.UnsupportedFunctions, result.Failures)
+	}
+}
@@ -0,0 +1,139 @@
+package nexus_modbus
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goburrow/modbus"
+)
+
+// ScanConfig selects what one poll of a scanner reads
+type ScanConfig struct {
+	FunctionCode int // 1-4, the table of the range
+	Address      int
+	Quantity     int
+	DataType     DataType // Decodes the registers of the range
+	ByteOrder    ByteOrder
+	Profile      *Profile // Named points read instead of the range, nil for none
+	Planner      ReadPlanner
+}
+
+// ScanValue is one decoded coil, register range or profile point of a poll
+type ScanValue struct {
+	FunctionCode int
+	Address      int
+	Point        *ProfilePoint // Profile point of the value, nil for a register range
+	Raw          string        // Register bytes in hex, or 0 or 1 for a coil or input
+	Text         string        // Decoded value, with the unit of a point
+	Number       float64       // Valid when Numeric is set
+	Numeric      bool
+	Err          error // The read of the value failed
+}
+
+// Name returns the point name, or the table and address of a plain value, e.g. "HR 500"
+func (v ScanValue) Name() string {
+	if v.Point != nil {
+		return v.Point.Name
+	}
+	return AddressName(v.FunctionCode, v.Address)
+}
+
+// Writable reports whether the value can be written back, coils and holding registers
+func (v ScanValue) Writable() bool {
+	if v.Point != nil {
+		return v.Point.Writable()
+	}
+	return v.FunctionCode == 1 || v.FunctionCode == 3
+}
+
+// ScanResult holds the values of one poll
+type ScanResult struct {
+	Values []ScanValue
+	Err    error // Requests that failed while others succeeded, nil when all succeeded
+}
+
+// ChunkError lists the failed requests of a read plan of which others succeeded
+type ChunkError struct {
+	Chunks []ChunkResult
+}
+
+func (e *ChunkError) Error() string {
+	var failed []string
+	for _, chunk := range e.Chunks {
+		if chunk.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s to %d: %s", AddressName(chunk.FunctionCode, chunk.Address), chunk.end()-1, Classify(chunk.Err)))
+		}
+	}
+	return fmt.Sprintf("%d of %d requests failed: %s", len(failed), len(e.Chunks), strings.Join(failed, "; "))
+}
+
+// AddressName names a coil or register by its table, e.g. "Coil 3" or "HR 500"
+func AddressName(functionCode, address int) string {
+	switch functionCode {
+	case 1:
+		return fmt.Sprintf("Coil %d", address)
+	case 2:
+		return fmt.Sprintf("Input %d", address)
+	case 4:
+		return fmt.Sprintf("IR %d", address)
+	}
+	return fmt.Sprintf("HR %d", address)
+}
+
+// Scan reads the range or profile of a scanner once. A failed request fails only the values it
+// covers and is reported in the result, only when nothing could be read an error is returned.
+func Scan(client modbus.Client, config ScanConfig) (*ScanResult, error) {
+	if config.Profile != nil {
+		return scanProfile(client, config)
+	}
+	if config.FunctionCode < 1 || config.FunctionCode > 4 {
+		return nil, fmt.Errorf("invalid function code %d, the scanners read FC1 to FC4", config.FunctionCode)
+	}
+	if config.Quantity < 1 || config.Address < 0 || config.Address+config.Quantity > 65536 {
+		return nil, fmt.Errorf("invalid range: %d items at address %d", config.Quantity, config.Address)
+	}
+
+	chunks := config.Planner.Plan([]ReadRange{{FunctionCode: config.FunctionCode, Address: config.Address, Quantity: config.Quantity}})
+	set := ReadPlan(client, chunks)
+	if set.Failed() {
+		return nil, set.Err()
+	}
+
+	result := &ScanResult{}
+	if set.Err() != nil {
+		result.Err = &ChunkError{Chunks: set.Chunks}
+	}
+	for _, value := range set.Decode(config.FunctionCode, config.Address, config.Quantity, config.DataType, config.ByteOrder) {
+		scanValue := ScanValue{FunctionCode: config.FunctionCode, Address: value.Address, Err: value.Err}
+		if value.Err == nil {
+			if config.FunctionCode == 1 || config.FunctionCode == 2 {
+				scanValue.Raw = fmt.Sprintf("%d", value.Raw[0])
+			} else {
+				scanValue.Raw = fmt.Sprintf("%X", value.Raw)
+			}
+			scanValue.Text, scanValue.Number, scanValue.Numeric = value.Text, value.Number, value.Numeric
+		}
+		result.Values = append(result.Values, scanValue)
+	}
+	return result, nil
+}
+
+// scanProfile reads the points of the profile once
+func scanProfile(client modbus.Client, config ScanConfig) (*ScanResult, error) {
+	values, err := ReadProfile(client, config.Profile, config.Planner)
+	if values == nil {
+		return nil, err
+	}
+
+	result := &ScanResult{Err: err}
+	for _, value := range values {
+		point := value.Point
+		scanValue := ScanValue{FunctionCode: point.FunctionCode(), Address: point.Address, Point: &point, Err: value.Err}
+		if value.Err == nil {
+			scanValue.Raw = fmt.Sprintf("%X", value.Raw)
+			scanValue.Text, scanValue.Number, scanValue.Numeric = value.Text, value.Number, value.Numeric
+		}
+		result.Values = append(result.Values, scanValue)
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package nexus_modbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// BaudRates lists the baud rates offered by the serial tabs
+var BaudRates = []int{1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200}
+
+// Parities lists the parity settings as used by the serial driver
+var Parities = []string{"N", "E", "O"}
+
+// StopBits lists the stop bit settings tried during detection
+var StopBits = []int{1, 2}
+
+// SerialSettings holds the line settings of an RTU link
+type SerialSettings struct {
+	BaudRate int
+	DataBits int
+	Parity   string
+	StopBits int
+}
+
+func (s SerialSettings) String() string {
+	return fmt.Sprintf("%d %d%s%d", s.BaudRate, s.DataBits, s.Parity, s.StopBits)
+}
+
+// DetectedSettings describes a combination that produced a valid response
+type DetectedSettings struct {
+	SerialSettings
+	ResponseTime  time.Duration
+	ExceptionCode byte // 0 when the probe read succeeded
+}
+
+// DetectSerialSettings tries every baud rate, parity and stop bit combination on the
+// given port and reads one holding register from slaveId with each of them. Any reply
+// that passes the CRC check, including a Modbus exception, is passed to found.
+// Detection returns early when ctx is cancelled, abandoning the probe in flight.
+func DetectSerialSettings(ctx context.Context, port string, dataBits int, slaveId byte, register uint16, timeout time.Duration,
+	found func(DetectedSettings), progress func(done, total int)) error {
+	if dataBits == 0 {
+		dataBits = 8 // Same default as the serial driver
+	}
+
+	total := len(BaudRates) * len(Parities) * len(StopBits)
+	done := 0
+	for _, baudRate := range BaudRates {
+		for _, parity := range Parities {
+			for _, stopBits := range StopBits {
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				settings := SerialSettings{BaudRate: baudRate, DataBits: dataBits, Parity: parity, StopBits: stopBits}
+				responseTime, exceptionCode, ok, err := probeSerialSettings(ctx, port, settings, slaveId, register, timeout)
+				if ctx.Err() != nil {
+					// The probe was abandoned, its result says nothing about the settings or the port
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if ok {
+					found(DetectedSettings{SerialSettings: settings, ResponseTime: responseTime, ExceptionCode: exceptionCode})
+				}
+
+				done++
+				progress(done, total)
+			}
+		}
+	}
+	return nil
+}
+
+// probeSerialSettings opens the port with the given settings and sends a single read.
+// Only a failure of the port itself is returned as an error, since a wrong guess is expected to time out.
+func probeSerialSettings(ctx context.Context, port string, settings SerialSettings, slaveId byte, register uint16,
+	timeout time.Duration) (time.Duration, byte, bool, error) {
+	conn := RTUPorts.Get(RTUConfig{
+		Port:     port,
+		BaudRate: settings.BaudRate,
+		DataBits: settings.DataBits,
+		Parity:   settings.Parity,
+		StopBits: settings.StopBits,
+	})
+
+	var elapsed time.Duration
+	err := conn.Do(ctx, slaveId, Timing{Timeout: timeout}, func(handler modbus.ClientHandler) error {
+		start := time.Now()
+		_, err := modbus.NewClient(handler).ReadHoldingRegisters(register, 1)
+		elapsed = time.Since(start)
+		return err
+	})
+
+	if err == nil {
+		return elapsed, 0, true, nil
+	}
+	if mbErr, ok := err.(*modbus.ModbusError); ok {
+		return elapsed, mbErr.ExceptionCode, true, nil
+	}
+	if _, ok := err.(*PortError); ok {
+		return 0, 0, false, err
+	}
+	return 0, 0, false, nil
+}
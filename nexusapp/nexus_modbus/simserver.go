@@ -0,0 +1,207 @@
+package nexus_modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// simSerialGap is the silence after which the RTU server treats received bytes as a frame
+// whose length it cannot tell from the function code
+const simSerialGap = 50 * time.Millisecond
+
+// RunGenerators updates the generated registers every interval until ctx is done
+func (s *Simulator) RunGenerators(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Generate(now)
+		}
+	}
+}
+
+// ServeTCP answers MBAP requests on every connection accepted by listener until ctx is
+// done. Unit 0 and 255 address the lowest unit, an unknown unit gets exception 0x0B
+// (gateway target failed to respond) as a gateway would send.
+func (s *Simulator) ServeTCP(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// serveConn answers the requests of one TCP client until it disconnects or ctx is done
+func (s *Simulator) serveConn(ctx context.Context, conn net.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	for {
+		request, err := readMBAPFrame(conn)
+		if err != nil {
+			return
+		}
+		unitId := request[6]
+		if unitId == 0 || unitId == 255 {
+			if unitIds := s.UnitIds(); len(unitIds) > 0 {
+				unitId = unitIds[0]
+			}
+		}
+		fault := s.nextFault()
+		pdu := s.respond(unitId, request[mbapHeaderSize:], fault)
+		if pdu == nil {
+			pdu = exceptionPDU(request[mbapHeaderSize], 0x0B)
+		}
+
+		if !s.delay(ctx, fault) {
+			return
+		}
+		if fault.drop {
+			continue
+		}
+		response := make([]byte, mbapHeaderSize, mbapHeaderSize+len(pdu))
+		copy(response, request[:4])
+		binary.BigEndian.PutUint16(response[4:], uint16(len(pdu)+1))
+		response[6] = request[6]
+		if _, err := conn.Write(append(response, pdu...)); err != nil {
+			return
+		}
+	}
+}
+
+// ServeRTU answers RTU requests read from port until ctx is done or port fails. A request
+// with a bad CRC or for an unknown unit is ignored, a broadcast is executed without a reply.
+func (s *Simulator) ServeRTU(ctx context.Context, port io.ReadWriter) error {
+	chunks := make(chan []byte)
+	failed := make(chan error, 1)
+	go func() {
+		buf := make([]byte, rtuMaxFrame)
+		for {
+			n, err := port.Read(buf)
+			if err != nil {
+				failed <- err
+				return
+			}
+			chunk := append([]byte(nil), buf[:n]...)
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var pending []byte
+	gap := time.NewTimer(simSerialGap)
+	defer gap.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-failed:
+			return err
+		case chunk := <-chunks:
+			pending = append(pending, chunk...)
+			for {
+				length, ok := rtuRequestLength(pending)
+				if !ok || len(pending) < length {
+					break
+				}
+				if !crcOK(pending[:length]) {
+					// Lost sync, wait for the line to go quiet
+					pending = nil
+					break
+				}
+				if err := s.answerRTU(ctx, port, pending[:length]); err != nil {
+					return err
+				}
+				pending = pending[length:]
+			}
+			if len(pending) > rtuMaxFrame {
+				pending = nil
+			}
+			if !gap.Stop() {
+				select {
+				case <-gap.C:
+				default:
+				}
+			}
+			gap.Reset(simSerialGap)
+		case <-gap.C:
+			// Frames of function codes without a known length end with the silence
+			if crcOK(pending) {
+				if err := s.answerRTU(ctx, port, pending); err != nil {
+					return err
+				}
+			}
+			pending = nil
+		}
+	}
+}
+
+// answerRTU executes one RTU request frame and writes its response with the injected faults
+func (s *Simulator) answerRTU(ctx context.Context, port io.Writer, request []byte) error {
+	unitId := request[0]
+	fault := s.nextFault()
+	pdu := s.respond(unitId, request[1:len(request)-2], fault)
+	if pdu == nil || unitId == 0 {
+		return nil
+	}
+
+	if !s.delay(ctx, fault) || fault.drop {
+		return nil
+	}
+	response := append([]byte{unitId}, pdu...)
+	crc := CRC16(response)
+	if fault.badCRC {
+		crc ^= 0xFFFF
+	}
+	response = append(response, byte(crc), byte(crc>>8))
+	_, err := port.Write(response)
+	return err
+}
+
+// delay waits out the injected response delay and reports whether ctx is still live
+func (s *Simulator) delay(ctx context.Context, fault simFault) bool {
+	if fault.delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(fault.delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,131 @@
+package nexus_modbus
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// serveSimulator serves sim over TCP on a local port until the test ends and returns its address
+func serveSimulator(t *testing.T, sim *Simulator) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- sim.ServeTCP(ctx, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeTCP: %v", err)
+		}
+	})
+	return listener.Addr().String()
+}
+
+// tcpClient connects a Modbus TCP client for unitId to address until the test ends
+func tcpClient(t *testing.T, address string, unitId byte) modbus.Client {
+	t.Helper()
+	handler := modbus.NewTCPClientHandler(address)
+	handler.SlaveId = unitId
+	handler.Timeout = waitTimeout
+	if err := handler.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { handler.Close() })
+	return modbus.NewClient(handler)
+}
+
+// exceptionCode returns the exception code of a Modbus error, 0 for any other result
+func exceptionCode(err error) byte {
+	if modbusErr, ok := err.(*modbus.ModbusError); ok {
+		return modbusErr.ExceptionCode
+	}
+	return 0
+}
+
+func TestSimulatorServeTCP(t *testing.T) {
+	sim := NewSimulator([]byte{1, 2}, SimSizes{Coils: 16, DiscreteInputs: 16, HoldingRegisters: 16, InputRegisters: 16})
+	if err := sim.SetValue(1, TableInputRegisters, 3, 1234); err != nil {
+		t.Fatal(err)
+	}
+	address := serveSimulator(t, sim)
+	client := tcpClient(t, address, 1)
+
+	results, err := client.ReadInputRegisters(3, 1)
+	if err != nil {
+		t.Fatalf("ReadInputRegisters: %v", err)
+	}
+	if len(results) != 2 || results[0] != 0x04 || results[1] != 0xD2 {
+		t.Fatalf("ReadInputRegisters = % X, want 04 D2", results)
+	}
+
+	if _, err := client.WriteMultipleRegisters(5, 2, []byte{0x00, 0x2A, 0xFF, 0xFF}); err != nil {
+		t.Fatalf("WriteMultipleRegisters: %v", err)
+	}
+	if values := sim.Values(1, TableHoldingRegisters); values[5] != 42 || values[6] != 0xFFFF {
+		t.Fatalf("holding registers 5-6 = %d, %d after the write, want 42, 65535", values[5], values[6])
+	}
+	results, err = client.ReadHoldingRegisters(5, 2)
+	if err != nil {
+		t.Fatalf("ReadHoldingRegisters: %v", err)
+	}
+	if len(results) != 4 || results[1] != 0x2A || results[2] != 0xFF {
+		t.Fatalf("ReadHoldingRegisters = % X, want 00 2A FF FF", results)
+	}
+	// Unit 2 keeps its own tables
+	if values := sim.Values(2, TableHoldingRegisters); values[5] != 0 {
+		t.Fatalf("unit 2 holding register 5 = %d, want 0", values[5])
+	}
+
+	if _, err := client.ReadHoldingRegisters(15, 2); exceptionCode(err) != 0x02 {
+		t.Fatalf("read past the table returned %v, want exception 0x02", err)
+	}
+	if _, err := tcpClient(t, address, 9).ReadHoldingRegisters(0, 1); exceptionCode(err) != 0x0B {
+		t.Fatalf("read of an unknown unit returned %v, want exception 0x0B", err)
+	}
+	if n := sim.Requests(); n != 5 {
+		t.Fatalf("%d requests counted, want 5", n)
+	}
+}
+
+func TestSimulatorInjectedException(t *testing.T) {
+	sim := NewSimulator([]byte{1}, SimSizes{HoldingRegisters: 8})
+	sim.SetFaults(SimFaults{ExceptionRate: 1, ExceptionCode: 0x04})
+	client := tcpClient(t, serveSimulator(t, sim), 1)
+
+	// A write answered with an exception is not executed
+	if _, err := client.WriteSingleRegister(2, 7); exceptionCode(err) != 0x04 {
+		t.Fatalf("write returned %v, want exception 0x04", err)
+	}
+	if values := sim.Values(1, TableHoldingRegisters); values[2] != 0 {
+		t.Fatalf("holding register 2 = %d after a failed write, want 0", values[2])
+	}
+
+	sim.SetFaults(SimFaults{})
+	if _, err := client.WriteSingleRegister(2, 7); err != nil {
+		t.Fatalf("write without faults: %v", err)
+	}
+	if values := sim.Values(1, TableHoldingRegisters); values[2] != 7 {
+		t.Fatalf("holding register 2 = %d, want 7", values[2])
+	}
+}
+
+func TestSimulatorDroppedResponse(t *testing.T) {
+	sim := NewSimulator([]byte{1}, SimSizes{HoldingRegisters: 8})
+	sim.SetFaults(SimFaults{DropRate: 1})
+	address := serveSimulator(t, sim)
+
+	handler := modbus.NewTCPClientHandler(address)
+	handler.SlaveId = 1
+	handler.Timeout = 100 * time.Millisecond
+	defer handler.Close()
+	if _, err := modbus.NewClient(handler).ReadHoldingRegisters(0, 1); err == nil {
+		t.Fatal("read answered although every response is dropped")
+	}
+}
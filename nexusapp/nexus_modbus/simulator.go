@@ -0,0 +1,552 @@
+package nexus_modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SimTables lists the data tables of a simulated unit in the order the UI offers them
+var SimTables = []string{TableCoils, TableDiscreteInputs, TableHoldingRegisters, TableInputRegisters}
+
+// SimSizes is the number of addresses in each data table of a simulated unit
+type SimSizes struct {
+	Coils            int
+	DiscreteInputs   int
+	HoldingRegisters int
+	InputRegisters   int
+}
+
+// Size returns the size of a table by name
+func (s SimSizes) Size(table string) int {
+	switch table {
+	case TableCoils:
+		return s.Coils
+	case TableDiscreteInputs:
+		return s.DiscreteInputs
+	case TableHoldingRegisters:
+		return s.HoldingRegisters
+	case TableInputRegisters:
+		return s.InputRegisters
+	}
+	return 0
+}
+
+// SimFaults are the faults a simulator injects, each rate is the fraction of requests affected
+type SimFaults struct {
+	Delay         time.Duration // Added before every response
+	ExceptionRate float64
+	ExceptionCode byte
+	DropRate      float64 // Requests left unanswered
+	BadCRCRate    float64 // RTU responses sent with a corrupted CRC
+}
+
+// GeneratorKind selects how a generator changes a value over time
+type GeneratorKind string
+
+const (
+	GeneratorRandom GeneratorKind = "random"
+	GeneratorRamp   GeneratorKind = "ramp"
+	GeneratorSine   GeneratorKind = "sine"
+)
+
+// GeneratorKinds lists the generator kinds in the order the UI offers them
+var GeneratorKinds = []GeneratorKind{GeneratorRandom, GeneratorRamp, GeneratorSine}
+
+// SimGenerator drives one register of a simulated unit between Min and Max
+type SimGenerator struct {
+	UnitId  byte
+	Table   string // TableHoldingRegisters or TableInputRegisters
+	Address int
+	Kind    GeneratorKind
+	Min     float64
+	Max     float64
+	Period  time.Duration // Of one ramp or sine cycle
+}
+
+// String describes the generator in one line
+func (g SimGenerator) String() string {
+	return fmt.Sprintf("Unit %d %s %d: %s %g..%g every %v", g.UnitId, g.Table, g.Address, g.Kind, g.Min, g.Max, g.Period)
+}
+
+// value returns the generated value elapsed into the run
+func (g SimGenerator) value(elapsed time.Duration, random *rand.Rand) uint16 {
+	phase := 0.0
+	if g.Period > 0 {
+		phase = math.Mod(float64(elapsed), float64(g.Period)) / float64(g.Period)
+	}
+	var fraction float64
+	switch g.Kind {
+	case GeneratorRandom:
+		fraction = random.Float64()
+	case GeneratorRamp:
+		fraction = phase
+	case GeneratorSine:
+		fraction = (1 + math.Sin(2*math.Pi*phase)) / 2
+	}
+	value := math.Round(g.Min + fraction*(g.Max-g.Min))
+	return uint16(math.Max(0, math.Min(65535, value)))
+}
+
+// ParseUnitIds reads a list of unit IDs and ranges such as "1, 2, 10-12"
+func ParseUnitIds(text string) ([]byte, error) {
+	seen := make(map[int]bool)
+	var unitIds []byte
+	for _, field := range splitValues(text) {
+		first, last := field, field
+		if i := strings.Index(field, "-"); i > 0 {
+			first, last = field[:i], field[i+1:]
+		}
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unit ID %q", field)
+		}
+		to, err := strconv.Atoi(last)
+		if err != nil || from < 1 || to > 247 || to < from {
+			return nil, fmt.Errorf("invalid unit IDs %q, use 1 to 247", field)
+		}
+		for id := from; id <= to; id++ {
+			if !seen[id] {
+				seen[id] = true
+				unitIds = append(unitIds, byte(id))
+			}
+		}
+	}
+	if len(unitIds) == 0 {
+		return nil, fmt.Errorf("no unit IDs given")
+	}
+	return unitIds, nil
+}
+
+// simUnit holds the four data tables of one simulated device, coils and inputs as 0 or 1
+type simUnit struct {
+	tables map[string][]uint16
+}
+
+func newSimUnit(sizes SimSizes) *simUnit {
+	unit := &simUnit{tables: make(map[string][]uint16)}
+	for _, table := range SimTables {
+		unit.tables[table] = make([]uint16, sizes.Size(table))
+	}
+	return unit
+}
+
+// Simulator is a Modbus server with one or more units. Its servers answer requests from the
+// data tables of the addressed unit, with generated values and injected faults.
+type Simulator struct {
+	mu         sync.Mutex
+	units      map[byte]*simUnit
+	sizes      SimSizes
+	faults     SimFaults
+	generators []SimGenerator
+	started    time.Time
+	random     *rand.Rand
+	requests   int
+}
+
+// NewSimulator creates a simulator with the given units, every table sized by sizes
+func NewSimulator(unitIds []byte, sizes SimSizes) *Simulator {
+	s := &Simulator{
+		units:   make(map[byte]*simUnit),
+		started: time.Now(),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	s.Configure(unitIds, sizes)
+	return s
+}
+
+// Configure sets the units and table sizes, keeping the values of addresses that remain
+func (s *Simulator) Configure(unitIds []byte, sizes SimSizes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	units := make(map[byte]*simUnit)
+	for _, unitId := range unitIds {
+		unit := newSimUnit(sizes)
+		if old, ok := s.units[unitId]; ok {
+			for table, values := range unit.tables {
+				copy(values, old.tables[table])
+			}
+		}
+		units[unitId] = unit
+	}
+	s.units = units
+	s.sizes = sizes
+}
+
+// UnitIds returns the simulated unit IDs in ascending order
+func (s *Simulator) UnitIds() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unitIds := make([]byte, 0, len(s.units))
+	for unitId := range s.units {
+		unitIds = append(unitIds, unitId)
+	}
+	sort.Slice(unitIds, func(i, j int) bool { return unitIds[i] < unitIds[j] })
+	return unitIds
+}
+
+// Sizes returns the table sizes of every unit
+func (s *Simulator) Sizes() SimSizes {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sizes
+}
+
+// Values returns a copy of a table of a unit, nil when the unit does not exist
+func (s *Simulator) Values(unitId byte, table string) []uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unit, ok := s.units[unitId]
+	if !ok {
+		return nil
+	}
+	values := make([]uint16, len(unit.tables[table]))
+	copy(values, unit.tables[table])
+	return values
+}
+
+// SetValue sets one address of a table, coils and inputs take 0 or 1
+func (s *Simulator) SetValue(unitId byte, table string, address int, value uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unit, ok := s.units[unitId]
+	if !ok {
+		return fmt.Errorf("no unit %d", unitId)
+	}
+	values := unit.tables[table]
+	if address < 0 || address >= len(values) {
+		return fmt.Errorf("address %d is outside the %s table (0-%d)", address, table, len(values)-1)
+	}
+	if (table == TableCoils || table == TableDiscreteInputs) && value > 1 {
+		return fmt.Errorf("%s values are 0 or 1", table)
+	}
+	values[address] = value
+	return nil
+}
+
+// SetFaults replaces the injected faults
+func (s *Simulator) SetFaults(faults SimFaults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = faults
+}
+
+// Faults returns the injected faults
+func (s *Simulator) Faults() SimFaults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.faults
+}
+
+// AddGenerator starts driving a register with a generator
+func (s *Simulator) AddGenerator(generator SimGenerator) error {
+	if generator.Table != TableHoldingRegisters && generator.Table != TableInputRegisters {
+		return fmt.Errorf("generators drive holding and input registers only")
+	}
+	if generator.Max < generator.Min {
+		return fmt.Errorf("maximum %g is below minimum %g", generator.Max, generator.Min)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unit, ok := s.units[generator.UnitId]
+	if !ok {
+		return fmt.Errorf("no unit %d", generator.UnitId)
+	}
+	if generator.Address < 0 || generator.Address >= len(unit.tables[generator.Table]) {
+		return fmt.Errorf("address %d is outside the %s table", generator.Address, generator.Table)
+	}
+	s.generators = append(s.generators, generator)
+	return nil
+}
+
+// Generators returns the running generators
+func (s *Simulator) Generators() []SimGenerator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SimGenerator(nil), s.generators...)
+}
+
+// ClearGenerators stops every generator, the registers keep their last values
+func (s *Simulator) ClearGenerators() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generators = nil
+}
+
+// Generate updates the registers driven by generators to their values at now
+func (s *Simulator) Generate(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := now.Sub(s.started)
+	for _, generator := range s.generators {
+		unit, ok := s.units[generator.UnitId]
+		if !ok {
+			continue
+		}
+		values := unit.tables[generator.Table]
+		if generator.Address < len(values) {
+			values[generator.Address] = generator.value(elapsed, s.random)
+		}
+	}
+}
+
+// Requests returns the number of requests the servers received
+func (s *Simulator) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// simFault is what the injected faults do to one response
+type simFault struct {
+	delay     time.Duration
+	drop      bool
+	exception bool
+	code      byte
+	badCRC    bool
+}
+
+// nextFault rolls the injected faults for one response
+func (s *Simulator) nextFault() simFault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return simFault{
+		delay:     s.faults.Delay,
+		drop:      s.random.Float64() < s.faults.DropRate,
+		exception: s.random.Float64() < s.faults.ExceptionRate,
+		code:      s.faults.ExceptionCode,
+		badCRC:    s.random.Float64() < s.faults.BadCRCRate,
+	}
+}
+
+// Handle answers one request PDU addressed to unitId. It returns nil when the unit does
+// not exist, which a serial slave answers with silence. Unit 0 writes to every unit.
+func (s *Simulator) Handle(unitId byte, pdu []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if len(pdu) == 0 {
+		return nil
+	}
+	if unitId == 0 {
+		var response []byte
+		for _, unit := range s.units {
+			response = unit.handle(pdu)
+		}
+		return response
+	}
+	unit, ok := s.units[unitId]
+	if !ok {
+		return nil
+	}
+	return unit.handle(pdu)
+}
+
+// respond answers a request with the rolled fault. An injected exception is sent instead
+// of executing the request, so a write answered with one leaves the tables unchanged.
+func (s *Simulator) respond(unitId byte, pdu []byte, fault simFault) []byte {
+	if !fault.exception || unitId == 0 || len(pdu) == 0 {
+		return s.Handle(unitId, pdu)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if _, ok := s.units[unitId]; !ok {
+		return nil
+	}
+	return exceptionPDU(pdu[0]&0x7F, fault.code)
+}
+
+// exceptionPDU builds the exception response to a function code
+func exceptionPDU(functionCode, code byte) []byte {
+	return []byte{functionCode | 0x80, code}
+}
+
+// handle executes a request PDU against the unit's tables and returns the response PDU
+func (u *simUnit) handle(pdu []byte) []byte {
+	functionCode := pdu[0]
+	word := func(i int) int {
+		return int(binary.BigEndian.Uint16(pdu[i:]))
+	}
+	// inRange checks a request's quantity against its limit and the table size
+	inRange := func(table string, address, quantity, limit int) byte {
+		if quantity < 1 || quantity > limit {
+			return 0x03
+		}
+		if address+quantity > len(u.tables[table]) {
+			return 0x02
+		}
+		return 0
+	}
+	bitTables := map[byte]string{1: TableCoils, 2: TableDiscreteInputs}
+	registerTables := map[byte]string{3: TableHoldingRegisters, 4: TableInputRegisters}
+
+	switch functionCode {
+	case 1, 2, 3, 4:
+		if len(pdu) < 5 {
+			return exceptionPDU(functionCode, 0x03)
+		}
+		address, quantity := word(1), word(3)
+		if table, ok := bitTables[functionCode]; ok {
+			if code := inRange(table, address, quantity, 2000); code != 0 {
+				return exceptionPDU(functionCode, code)
+			}
+			bits := make([]bool, quantity)
+			for i := range bits {
+				bits[i] = u.tables[table][address+i] != 0
+			}
+			packed := PackCoils(bits)
+			return append([]byte{functionCode, byte(len(packed))}, packed...)
+		}
+		table := registerTables[functionCode]
+		if code := inRange(table, address, quantity, 125); code != 0 {
+			return exceptionPDU(functionCode, code)
+		}
+		return append([]byte{functionCode, byte(2 * quantity)}, u.registers(table, address, quantity)...)
+	case 5:
+		if len(pdu) < 5 {
+			return exceptionPDU(functionCode, 0x03)
+		}
+		address, value := word(1), word(3)
+		if value != 0xFF00 && value != 0x0000 {
+			return exceptionPDU(functionCode, 0x03)
+		}
+		if code := inRange(TableCoils, address, 1, 1); code != 0 {
+			return exceptionPDU(functionCode, code)
+		}
+		u.tables[TableCoils][address] = uint16(value >> 15)
+		return append([]byte(nil), pdu[:5]...)
+	case 6:
+		if len(pdu) < 5 {
+			return exceptionPDU(functionCode, 0x03)
+		}
+		address := word(1)
+		if code := inRange(TableHoldingRegisters, address, 1, 1); code != 0 {
+			return exceptionPDU(functionCode, code)
+		}
+		u.tables[TableHoldingRegisters][address] = uint16(word(3))
+		return append([]byte(nil), pdu[:5]...)
+	case 15, 16:
+		if len(pdu) < 6 || len(pdu) < 6+int(pdu[5]) {
+			return exceptionPDU(functionCode, 0x03)
+		}
+		address, quantity, data := word(1), word(3), pdu[6:6+int(pdu[5])]
+		if functionCode == 15 {
+			if code := inRange(TableCoils, address, quantity, 1968); code != 0 || len(data) < (quantity+7)/8 {
+				return exceptionPDU(functionCode, maxCode(code, 0x03))
+			}
+			for i := 0; i < quantity; i++ {
+				u.tables[TableCoils][address+i] = uint16(data[i/8]>>uint(i%8)) & 1
+			}
+		} else {
+			if code := inRange(TableHoldingRegisters, address, quantity, 123); code != 0 || len(data) < 2*quantity {
+				return exceptionPDU(functionCode, maxCode(code, 0x03))
+			}
+			for i := 0; i < quantity; i++ {
+				u.tables[TableHoldingRegisters][address+i] = binary.BigEndian.Uint16(data[2*i:])
+			}
+		}
+		return append([]byte(nil), pdu[:5]...)
+	case 22:
+		if len(pdu) < 7 {
+			return exceptionPDU(functionCode, 0x03)
+		}
+		address := word(1)
+		if code := inRange(TableHoldingRegisters, address, 1, 1); code != 0 {
+			return exceptionPDU(functionCode, code)
+		}
+		andMask, orMask := uint16(word(3)), uint16(word(5))
+		current := u.tables[TableHoldingRegisters][address]
+		u.tables[TableHoldingRegisters][address] = current&andMask | orMask&^andMask
+		return append([]byte(nil), pdu[:7]...)
+	case 23:
+		if len(pdu) < 10 || len(pdu) < 10+int(pdu[9]) {
+			return exceptionPDU(functionCode, 0x03)
+		}
+		readAddress, readQuantity := word(1), word(3)
+		writeAddress, writeQuantity := word(5), word(7)
+		if code := inRange(TableHoldingRegisters, writeAddress, writeQuantity, 121); code != 0 || int(pdu[9]) < 2*writeQuantity {
+			return exceptionPDU(functionCode, maxCode(code, 0x03))
+		}
+		if code := inRange(TableHoldingRegisters, readAddress, readQuantity, 125); code != 0 {
+			return exceptionPDU(functionCode, code)
+		}
+		for i := 0; i < writeQuantity; i++ {
+			u.tables[TableHoldingRegisters][writeAddress+i] = binary.BigEndian.Uint16(pdu[10+2*i:])
+		}
+		return append([]byte{functionCode, byte(2 * readQuantity)}, u.registers(TableHoldingRegisters, readAddress, readQuantity)...)
+	case funcCodeEncapsulatedInterface:
+		return simDeviceIdentification(pdu)
+	}
+	return exceptionPDU(functionCode, 0x01)
+}
+
+// registers returns quantity registers of a table as big endian bytes
+func (u *simUnit) registers(table string, address, quantity int) []byte {
+	data := make([]byte, 2*quantity)
+	for i := 0; i < quantity; i++ {
+		binary.BigEndian.PutUint16(data[2*i:], u.tables[table][address+i])
+	}
+	return data
+}
+
+// maxCode returns the more specific of two exception codes, 0 meaning none
+func maxCode(a, b byte) byte {
+	if a != 0 {
+		return a
+	}
+	return b
+}
+
+// simDeviceObjects are the basic identification objects of a simulated unit
+var simDeviceObjects = []string{"Nexus", "NEXUS-SIM", "1.0"}
+
+// simDeviceIdentification answers FC43 / MEI 14 with the basic objects, streamed or one at a time
+func simDeviceIdentification(pdu []byte) []byte {
+	if len(pdu) < 4 || pdu[1] != meiReadDeviceIdentification {
+		return exceptionPDU(funcCodeEncapsulatedInterface, 0x01)
+	}
+	readCode, objectId := pdu[2], pdu[3]
+	if readCode < 1 || readCode > 4 {
+		return exceptionPDU(funcCodeEncapsulatedInterface, 0x03)
+	}
+	if int(objectId) >= len(simDeviceObjects) {
+		if readCode == 4 {
+			return exceptionPDU(funcCodeEncapsulatedInterface, 0x02)
+		}
+		objectId = 0
+	}
+	last := len(simDeviceObjects) - 1
+	if readCode == 4 {
+		last = int(objectId)
+	}
+
+	// Conformity level basic, stream and individual access
+	response := []byte{funcCodeEncapsulatedInterface, meiReadDeviceIdentification, readCode, 0x81, 0, 0, byte(last - int(objectId) + 1)}
+	for id := int(objectId); id <= last; id++ {
+		response = append(response, byte(id), byte(len(simDeviceObjects[id])))
+		response = append(response, simDeviceObjects[id]...)
+	}
+	return response
+}
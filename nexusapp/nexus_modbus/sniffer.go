@@ -0,0 +1,460 @@
+package nexus_modbus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+const (
+	sniffCapacity = 2000                 // Transactions kept by a sniffer
+	minSniffGap   = 2 * time.Millisecond // Shortest read timeout used to find frame gaps
+)
+
+// Register tables as named in the bus map
+const (
+	TableCoils            = "Coil"
+	TableDiscreteInputs   = "Discrete input"
+	TableHoldingRegisters = "Holding register"
+	TableInputRegisters   = "Input register"
+)
+
+// Transaction is a request seen on the bus and the response that followed it
+type Transaction struct {
+	Request  Frame
+	Response *Frame // nil when the slave did not answer, and for broadcasts
+	Latency  time.Duration
+}
+
+// Summary describes the transaction in one line, with the values read or written
+func (t Transaction) Summary() string {
+	summary := t.Request.Summary()
+	if values := t.Values(); values != "" {
+		summary += ": " + values
+	}
+	switch {
+	case t.Response == nil:
+		request, ok := t.Request.Decode()
+		if !ok || request.SlaveId != 0 {
+			summary += ", no response"
+		}
+	case !crcOK(t.Response.ADU):
+		summary += ", response CRC bad"
+	default:
+		if response, _ := t.Response.Decode(); response.Exception {
+			summary += fmt.Sprintf(", exception %02X", response.ExceptionCode)
+		}
+	}
+	return summary
+}
+
+// Values formats the values the master wrote, or the values the slave returned for a read
+func (t Transaction) Values() string {
+	var parts []string
+	for _, item := range t.items() {
+		if item.value != "" {
+			parts = append(parts, item.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// busItem is one address touched by a transaction
+type busItem struct {
+	table   string
+	address int
+	write   bool
+	value   string // "" when the transaction does not tell the value
+}
+
+// items lists the addresses a transaction reads or writes, with the values it carries.
+// Values of a read come from a valid response, values of a write from the request.
+func (t Transaction) items() []busItem {
+	request := t.Request.ADU
+	if !crcOK(request) {
+		return nil
+	}
+	pdu := request[1 : len(request)-2]
+	var response []byte
+	if t.Response != nil && crcOK(t.Response.ADU) && t.Response.ADU[1]&0x80 == 0 {
+		response = t.Response.ADU[1 : len(t.Response.ADU)-2]
+	}
+	word := func(data []byte, i int) int {
+		return int(data[i])<<8 | int(data[i+1])
+	}
+
+	var items []busItem
+	bits := func(table string, address, count int, data []byte, write bool) {
+		for i := 0; i < count; i++ {
+			item := busItem{table: table, address: address + i, write: write}
+			if i/8 < len(data) {
+				item.value = "OFF"
+				if data[i/8]&(1<<uint(i%8)) != 0 {
+					item.value = "ON"
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	registers := func(table string, address, count int, data []byte, write bool) {
+		for i := 0; i < count; i++ {
+			item := busItem{table: table, address: address + i, write: write}
+			if 2*i+1 < len(data) {
+				item.value = fmt.Sprint(word(data, 2*i))
+			}
+			items = append(items, item)
+		}
+	}
+	payload := func(data []byte, from int) []byte {
+		if len(data) <= from {
+			return nil
+		}
+		return data[from:]
+	}
+
+	switch pdu[0] {
+	case 1, 2, 3, 4:
+		if len(pdu) < 5 {
+			return nil
+		}
+		tables := map[byte]string{1: TableCoils, 2: TableDiscreteInputs, 3: TableHoldingRegisters, 4: TableInputRegisters}
+		if pdu[0] <= 2 {
+			bits(tables[pdu[0]], word(pdu, 1), word(pdu, 3), payload(response, 2), false)
+		} else {
+			registers(tables[pdu[0]], word(pdu, 1), word(pdu, 3), payload(response, 2), false)
+		}
+	case 5:
+		if len(pdu) < 5 {
+			return nil
+		}
+		value := "OFF"
+		if pdu[3] == 0xFF {
+			value = "ON"
+		}
+		items = append(items, busItem{table: TableCoils, address: word(pdu, 1), write: true, value: value})
+	case 6:
+		if len(pdu) < 5 {
+			return nil
+		}
+		registers(TableHoldingRegisters, word(pdu, 1), 1, pdu[3:], true)
+	case 15:
+		if len(pdu) < 6 {
+			return nil
+		}
+		bits(TableCoils, word(pdu, 1), word(pdu, 3), payload(pdu, 6), true)
+	case 16:
+		if len(pdu) < 6 {
+			return nil
+		}
+		registers(TableHoldingRegisters, word(pdu, 1), word(pdu, 3), payload(pdu, 6), true)
+	case 22:
+		if len(pdu) < 7 {
+			return nil
+		}
+		value := fmt.Sprintf("AND %04X OR %04X", word(pdu, 3), word(pdu, 5))
+		items = append(items, busItem{table: TableHoldingRegisters, address: word(pdu, 1), write: true, value: value})
+	case 23:
+		if len(pdu) < 10 {
+			return nil
+		}
+		registers(TableHoldingRegisters, word(pdu, 5), word(pdu, 7), payload(pdu, 10), true)
+		registers(TableHoldingRegisters, word(pdu, 1), word(pdu, 3), payload(response, 2), false)
+	}
+	return items
+}
+
+// BusRegister is one address the master accessed on a slave
+type BusRegister struct {
+	SlaveId byte
+	Table   string
+	Address int
+	Reads   int
+	Writes  int
+	Value   string // Last value seen, empty until a transaction carried one
+	Updated time.Time
+}
+
+type busKey struct {
+	slaveId byte
+	table   string
+	address int
+}
+
+// Sniffer follows the traffic between a master and its slaves without taking part in it.
+// It splits the byte stream into frames, pairs each request with its response and keeps
+// a map of the addresses the master reads and writes on each slave.
+type Sniffer struct {
+	mu           sync.Mutex
+	pending      *Frame // Request waiting for its response
+	transactions []Transaction
+	registers    map[busKey]*BusRegister
+	version      uint64
+}
+
+// NewSniffer creates a sniffer that has seen no traffic
+func NewSniffer() *Sniffer {
+	return &Sniffer{registers: make(map[busKey]*BusRegister)}
+}
+
+// Listen opens the port of config, never transmitting on it, and feeds the bus traffic to
+// the sniffer until ctx is done. A connection of the application to the port is released
+// first, since a second reader would take bytes away from the sniffer.
+func (s *Sniffer) Listen(ctx context.Context, config RTUConfig) error {
+	RTUPorts.Release(config.Port)
+
+	// Reads time out after the 3.5 character silence that ends an RTU frame
+	gap := frameGap(config.BaudRate)
+	if gap < minSniffGap {
+		gap = minSniffGap
+	}
+	port, err := serial.Open(&serial.Config{
+		Address:  config.Port,
+		BaudRate: config.BaudRate,
+		DataBits: config.DataBits,
+		StopBits: config.StopBits,
+		Parity:   config.Parity,
+		Timeout:  gap,
+	})
+	if err != nil {
+		return &PortError{Port: config.Port, Err: err}
+	}
+	defer port.Close()
+
+	err = ReadBusBlocks(ctx, port, func(block []byte, at time.Time) {
+		s.Feed(config.Port, block, at)
+	})
+	if err != nil {
+		return &PortError{Port: config.Port, Err: err}
+	}
+	return nil
+}
+
+// ReadBusBlocks reads port until ctx is done and calls emit with each run of bytes that ended
+// in a read timeout, along with the time its last byte arrived. port must time out its reads
+// after the silence that separates frames, as a serial port opened with that timeout does.
+func ReadBusBlocks(ctx context.Context, port io.Reader, emit func(block []byte, at time.Time)) error {
+	buf := make([]byte, rtuMaxFrame)
+	var block []byte
+	var last time.Time
+	flush := func() {
+		if len(block) > 0 {
+			emit(block, last)
+			block = nil
+		}
+	}
+	defer flush()
+
+	for ctx.Err() == nil {
+		n, err := port.Read(buf)
+		if err == serial.ErrTimeout {
+			flush()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// A readable port without data has been disconnected
+			return io.EOF
+		}
+		last = time.Now()
+		block = append(block, buf[:n]...)
+		if len(block) >= 2*rtuMaxFrame {
+			// A line without silences is noise, or the gap is too short to see
+			flush()
+		}
+	}
+	return nil
+}
+
+// Feed processes a run of bytes read from the bus of source. USB adapters deliver bytes
+// late and in chunks, so a run may hold several frames; it is split where a frame with a
+// valid CRC ends. The frames are captured by Traffic, requests as TX and responses as RX.
+func (s *Sniffer) Feed(source string, block []byte, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(block) > 0 {
+		n := s.frameLength(block)
+		s.add(Frame{Time: at, Transport: "RTU", Source: source, ADU: append([]byte(nil), block[:n]...)})
+		block = block[n:]
+	}
+	s.version++
+}
+
+// frameLength returns the length of the frame at the start of block, preferring a response
+// to the pending request. s.mu must be held.
+func (s *Sniffer) frameLength(block []byte) int {
+	lengths := []func([]byte) (int, bool){rtuRequestLength, RTUFrameLength}
+	if s.pending != nil {
+		lengths[0], lengths[1] = lengths[1], lengths[0]
+	}
+	for _, length := range lengths {
+		if n, ok := length(block); ok && n < len(block) && crcOK(block[:n]) {
+			return n
+		}
+	}
+	return len(block)
+}
+
+// add pairs a frame with the pending request or makes it the pending request. s.mu must be held.
+func (s *Sniffer) add(frame Frame) {
+	if s.pending != nil && s.isResponse(frame) {
+		frame.Direction = DirectionRX
+		Traffic.Capture(DirectionRX, frame.Transport, frame.Source, frame.ADU)
+		s.record(Transaction{Request: *s.pending, Response: &frame, Latency: frame.Time.Sub(s.pending.Time)})
+		s.pending = nil
+		return
+	}
+
+	if s.pending != nil {
+		s.record(Transaction{Request: *s.pending})
+	}
+	frame.Direction = DirectionTX
+	Traffic.Capture(DirectionTX, frame.Transport, frame.Source, frame.ADU)
+	s.pending = &frame
+	if len(frame.ADU) > 0 && frame.ADU[0] == 0 {
+		// Broadcasts are not answered
+		s.record(Transaction{Request: frame})
+		s.pending = nil
+	}
+}
+
+// isResponse reports whether frame answers the pending request. s.mu must be held.
+func (s *Sniffer) isResponse(frame Frame) bool {
+	request, adu := s.pending.ADU, frame.ADU
+	if len(adu) < 2 || len(request) < 2 || adu[0] != request[0] {
+		return false
+	}
+	if adu[1] == request[1]|0x80 {
+		return true
+	}
+	if adu[1] != request[1] {
+		return false
+	}
+	// A repeated read request looks like the response to the first one up to its byte count
+	if n, ok := RTUFrameLength(adu); ok {
+		return n == len(adu) || !crcOK(adu)
+	}
+	return true
+}
+
+// record keeps a transaction and updates the bus map with it. s.mu must be held.
+func (s *Sniffer) record(t Transaction) {
+	if len(s.transactions) >= sniffCapacity {
+		s.transactions = append(s.transactions[:0], s.transactions[len(s.transactions)-sniffCapacity+1:]...)
+	}
+	s.transactions = append(s.transactions, t)
+
+	if len(t.Request.ADU) == 0 {
+		return
+	}
+	slaveId := t.Request.ADU[0]
+	answered := t.Response != nil && crcOK(t.Response.ADU) && t.Response.ADU[1]&0x80 == 0
+	for _, item := range t.items() {
+		key := busKey{slaveId: slaveId, table: item.table, address: item.address}
+		register, ok := s.registers[key]
+		if !ok {
+			register = &BusRegister{SlaveId: slaveId, Table: item.table, Address: item.address}
+			s.registers[key] = register
+		}
+		if item.write {
+			register.Writes++
+		} else {
+			register.Reads++
+		}
+		// A written value only counts once the slave confirmed it, or for a broadcast
+		if item.value != "" && (!item.write || answered || slaveId == 0) {
+			register.Value = item.value
+			register.Updated = t.Request.Time
+		}
+	}
+}
+
+// Transactions returns the kept transactions, oldest first, and a version that changes
+// whenever new traffic was fed
+func (s *Sniffer) Transactions() ([]Transaction, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transactions := make([]Transaction, len(s.transactions))
+	copy(transactions, s.transactions)
+	return transactions, s.version
+}
+
+// Registers returns the bus map, sorted by slave, table and address
+func (s *Sniffer) Registers() []BusRegister {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registers := make([]BusRegister, 0, len(s.registers))
+	for _, register := range s.registers {
+		registers = append(registers, *register)
+	}
+	sort.Slice(registers, func(i, j int) bool {
+		a, b := registers[i], registers[j]
+		if a.SlaveId != b.SlaveId {
+			return a.SlaveId < b.SlaveId
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Address < b.Address
+	})
+	return registers
+}
+
+// Reset forgets the traffic seen so far
+func (s *Sniffer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = nil
+	s.transactions = nil
+	s.registers = make(map[busKey]*BusRegister)
+	s.version++
+}
+
+// rtuRequestLength returns the total length of a request frame sent by a master,
+// once enough of the frame has been received to know it
+func rtuRequestLength(frame []byte) (int, bool) {
+	if len(frame) < 2 {
+		return 0, false
+	}
+	switch frame[1] {
+	case 1, 2, 3, 4, 5, 6, 8:
+		return 8, true
+	case 15, 16:
+		if len(frame) < 7 {
+			return 0, false
+		}
+		return 9 + int(frame[6]), true
+	case 22:
+		return 10, true
+	case 23:
+		if len(frame) < 11 {
+			return 0, false
+		}
+		return 13 + int(frame[10]), true
+	case 24:
+		return 6, true
+	case 43:
+		return 7, true
+	}
+	return 0, false
+}
+
+// crcOK reports whether an RTU frame ends with its valid CRC
+func crcOK(frame []byte) bool {
+	if len(frame) < 4 {
+		return false
+	}
+	n := len(frame)
+	return uint16(frame[n-1])<<8|uint16(frame[n-2]) == CRC16(frame[:n-2])
+}
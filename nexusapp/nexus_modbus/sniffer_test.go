@@ -0,0 +1,385 @@
+package nexus_modbus
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// rtu appends the CRC to the slave ID and PDU of a frame
+func rtu(frame ...byte) []byte {
+	crc := CRC16(frame)
+	return append(frame, byte(crc), byte(crc>>8))
+}
+
+// join concatenates frames, as a USB adapter may deliver them in one read
+func join(frames ...[]byte) []byte {
+	return bytes.Join(frames, nil)
+}
+
+// Frames of a master reading two holding registers from slave 1 and writing one on slave 2
+var (
+	readRequest   = rtu(0x01, 0x03, 0x00, 0x10, 0x00, 0x02)
+	readResponse  = rtu(0x01, 0x03, 0x04, 0x12, 0x34, 0x56, 0x78)
+	readException = rtu(0x01, 0x83, 0x02)
+	writeRequest  = rtu(0x02, 0x06, 0x00, 0x05, 0x00, 0x2A)
+	writeResponse = rtu(0x02, 0x06, 0x00, 0x05, 0x00, 0x2A)
+	broadcast     = rtu(0x00, 0x06, 0x00, 0x01, 0x00, 0x07)
+	fc16Request   = rtu(0x01, 0x10, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02)
+	fc23Request   = rtu(0x01, 0x17, 0x00, 0x00, 0x00, 0x01, 0x00, 0x10, 0x00, 0x01, 0x02, 0x00, 0x09)
+)
+
+func TestRTURequestLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		frame  []byte
+		length int
+		ok     bool
+	}{
+		{"empty", nil, 0, false},
+		{"slave ID only", []byte{0x01}, 0, false},
+		{"FC3", readRequest, 8, true},
+		{"FC3 header", readRequest[:2], 8, true},
+		{"FC6", writeRequest, 8, true},
+		{"FC16", fc16Request, 13, true},
+		{"FC16 before byte count", fc16Request[:6], 0, false},
+		{"FC22", []byte{0x01, 22}, 10, true},
+		{"FC23", fc23Request, 15, true},
+		{"FC23 before byte count", fc23Request[:10], 0, false},
+		{"FC24", []byte{0x01, 24}, 6, true},
+		{"FC43", []byte{0x01, 43}, 7, true},
+		{"unknown function", []byte{0x01, 0x41, 0x00}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			length, ok := rtuRequestLength(test.frame)
+			if length != test.length || ok != test.ok {
+				t.Fatalf("rtuRequestLength = %d, %v, want %d, %v", length, ok, test.length, test.ok)
+			}
+		})
+	}
+}
+
+func TestSnifferIsResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		frame   []byte
+		want    bool
+	}{
+		{"read response", readRequest, readResponse, true},
+		{"exception", readRequest, readException, true},
+		{"other slave", readRequest, rtu(0x02, 0x03, 0x04, 0x12, 0x34, 0x56, 0x78), false},
+		{"other function", readRequest, writeResponse, false},
+		{"repeated read request", readRequest, readRequest, false},
+		{"truncated response", readRequest, readResponse[:5], true},
+		{"response with bad CRC", readRequest, append(readResponse[:len(readResponse)-1:len(readResponse)-1], 0), true},
+		{"write echo", writeRequest, writeResponse, true},
+		{"single byte", readRequest, []byte{0x01}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSniffer()
+			s.pending = &Frame{ADU: test.request}
+			if got := s.isResponse(Frame{ADU: test.frame}); got != test.want {
+				t.Fatalf("isResponse = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnifferFrameLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending []byte // nil when no request waits for its response
+		block   []byte
+		want    int
+	}{
+		{"single request", nil, readRequest, len(readRequest)},
+		{"request and response", nil, join(readRequest, readResponse), len(readRequest)},
+		{"response and next request", readRequest, join(readResponse, writeRequest), len(readResponse)},
+		{"exception and next request", readRequest, join(readException, writeRequest), len(readException)},
+		{"two requests", nil, join(readRequest, writeRequest), len(readRequest)},
+		{"noise", nil, []byte{0xFF, 0x00, 0x12}, 3},
+		{"bad CRC is not split", nil, join(readRequest[:6], []byte{0, 0}, writeRequest), 16},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSniffer()
+			if test.pending != nil {
+				s.pending = &Frame{ADU: test.pending}
+			}
+			if got := s.frameLength(test.block); got != test.want {
+				t.Fatalf("frameLength = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// sniffed describes a transaction by its frames
+type sniffed struct {
+	request  []byte
+	response []byte // nil for no response
+}
+
+func TestSnifferFeed(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks [][]byte // Each block ends in a read timeout
+		want   []sniffed
+	}{
+		{
+			name:   "request and response",
+			blocks: [][]byte{readRequest, readResponse},
+			want:   []sniffed{{readRequest, readResponse}},
+		},
+		{
+			name:   "both in one block",
+			blocks: [][]byte{join(readRequest, readResponse)},
+			want:   []sniffed{{readRequest, readResponse}},
+		},
+		{
+			name:   "several transactions in one block",
+			blocks: [][]byte{join(readRequest, readResponse, writeRequest, writeResponse)},
+			want:   []sniffed{{readRequest, readResponse}, {writeRequest, writeResponse}},
+		},
+		{
+			name:   "exception",
+			blocks: [][]byte{readRequest, readException},
+			want:   []sniffed{{readRequest, readException}},
+		},
+		{
+			name:   "no response",
+			blocks: [][]byte{readRequest, writeRequest, writeResponse},
+			want:   []sniffed{{readRequest, nil}, {writeRequest, writeResponse}},
+		},
+		{
+			name:   "repeated request",
+			blocks: [][]byte{readRequest, readRequest, readResponse},
+			want:   []sniffed{{readRequest, nil}, {readRequest, readResponse}},
+		},
+		{
+			name:   "broadcast",
+			blocks: [][]byte{broadcast, readRequest, readResponse},
+			want:   []sniffed{{broadcast, nil}, {readRequest, readResponse}},
+		},
+		{
+			name:   "response split over two reads",
+			blocks: [][]byte{readRequest, readResponse[:4], readResponse[4:]},
+			want:   []sniffed{{readRequest, readResponse[:4]}, {readResponse[4:], nil}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSniffer()
+			at := time.Unix(0, 0)
+			for _, block := range test.blocks {
+				at = at.Add(10 * time.Millisecond)
+				s.Feed("test", block, at)
+			}
+			// The last request waits for its response, another request completes it
+			s.Feed("test", rtu(0x09, 0x03, 0x00, 0x00, 0x00, 0x01), at.Add(time.Second))
+
+			transactions, _ := s.Transactions()
+			if len(transactions) != len(test.want) {
+				t.Fatalf("%d transactions, want %d: %v", len(transactions), len(test.want), transactions)
+			}
+			for i, want := range test.want {
+				got := transactions[i]
+				if !bytes.Equal(got.Request.ADU, want.request) {
+					t.Errorf("transaction %d: request % X, want % X", i, got.Request.ADU, want.request)
+				}
+				switch {
+				case want.response == nil && got.Response != nil:
+					t.Errorf("transaction %d: response % X, want none", i, got.Response.ADU)
+				case want.response != nil && got.Response == nil:
+					t.Errorf("transaction %d: no response, want % X", i, want.response)
+				case want.response != nil && !bytes.Equal(got.Response.ADU, want.response):
+					t.Errorf("transaction %d: response % X, want % X", i, got.Response.ADU, want.response)
+				}
+			}
+		})
+	}
+}
+
+func TestSnifferBusMap(t *testing.T) {
+	s := NewSniffer()
+	at := time.Unix(0, 0)
+	s.Feed("test", join(readRequest, readResponse, writeRequest, writeResponse), at)
+	s.Feed("test", readRequest, at)
+
+	want := []BusRegister{
+		{SlaveId: 1, Table: TableHoldingRegisters, Address: 0x10, Reads: 2, Value: "4660"},
+		{SlaveId: 1, Table: TableHoldingRegisters, Address: 0x11, Reads: 2, Value: "22136"},
+		{SlaveId: 2, Table: TableHoldingRegisters, Address: 5, Writes: 1, Value: "42"},
+	}
+	// The second read is still pending and counts once the next frame arrives
+	s.Feed("test", rtu(0x09, 0x03, 0x00, 0x00, 0x00, 0x01), at)
+	registers := s.Registers()
+	var got []BusRegister
+	for _, register := range registers {
+		if register.SlaveId != 9 {
+			register.Updated = time.Time{}
+			got = append(got, register)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("bus map %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("register %d: %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// readStep is one result of a scripted port read
+type readStep struct {
+	data []byte
+	err  error
+}
+
+// scriptedPort returns its steps in order, then cancels the read loop
+type scriptedPort struct {
+	steps  []readStep
+	cancel context.CancelFunc
+}
+
+func (p *scriptedPort) Read(buf []byte) (int, error) {
+	if len(p.steps) == 0 {
+		p.cancel()
+		return 0, serial.ErrTimeout
+	}
+	step := p.steps[0]
+	p.steps = p.steps[1:]
+	return copy(buf, step.data), step.err
+}
+
+func TestReadBusBlocks(t *testing.T) {
+	timeout := readStep{err: serial.ErrTimeout}
+	tests := []struct {
+		name   string
+		steps  []readStep
+		blocks [][]byte
+		err    error
+	}{
+		{
+			name:   "frames separated by silence",
+			steps:  []readStep{{data: readRequest}, timeout, {data: readResponse}, timeout},
+			blocks: [][]byte{readRequest, readResponse},
+		},
+		{
+			name:   "frame in chunks",
+			steps:  []readStep{{data: readResponse[:3]}, {data: readResponse[3:]}, timeout},
+			blocks: [][]byte{readResponse},
+		},
+		{
+			name:   "idle line",
+			steps:  []readStep{timeout, timeout},
+			blocks: nil,
+		},
+		{
+			name:   "block without a final timeout",
+			steps:  []readStep{{data: readRequest}},
+			blocks: [][]byte{readRequest},
+		},
+		{
+			name:   "disconnected",
+			steps:  []readStep{{data: readRequest}, {}},
+			blocks: [][]byte{readRequest},
+			err:    io.EOF,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			port := &scriptedPort{steps: test.steps, cancel: cancel}
+
+			var blocks [][]byte
+			err := ReadBusBlocks(ctx, port, func(block []byte, at time.Time) {
+				blocks = append(blocks, append([]byte(nil), block...))
+			})
+			if err != test.err {
+				t.Fatalf("ReadBusBlocks returned %v, want %v", err, test.err)
+			}
+			if len(blocks) != len(test.blocks) {
+				t.Fatalf("%d blocks, want %d: % X", len(blocks), len(test.blocks), blocks)
+			}
+			for i := range blocks {
+				if !bytes.Equal(blocks[i], test.blocks[i]) {
+					t.Errorf("block %d: % X, want % X", i, blocks[i], test.blocks[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadBusBlocksNoise(t *testing.T) {
+	// A line that never goes silent is cut into blocks of twice the largest frame
+	noise := bytes.Repeat([]byte{0x55}, rtuMaxFrame)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	port := &scriptedPort{steps: []readStep{{data: noise}, {data: noise}, {data: noise}}, cancel: cancel}
+
+	var sizes []int
+	ReadBusBlocks(ctx, port, func(block []byte, at time.Time) {
+		sizes = append(sizes, len(block))
+	})
+	if len(sizes) != 2 || sizes[0] != 2*rtuMaxFrame || sizes[1] != rtuMaxFrame {
+		t.Fatalf("block sizes %v, want [%d %d]", sizes, 2*rtuMaxFrame, rtuMaxFrame)
+	}
+}
+
+func TestSnifferListenPseudoTerminal(t *testing.T) {
+	master, path, err := OpenPseudoTerminal()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer master.Close()
+
+	s := NewSniffer()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Listen(ctx, RTUConfig{Port: path, BaudRate: 9600, DataBits: 8, Parity: "N", StopBits: 1})
+	}()
+	// Let the sniffer open the port before the bus starts talking
+	time.Sleep(100 * time.Millisecond)
+
+	// A USB adapter delivers the request and response of a fast slave in one chunk
+	for _, chunk := range [][]byte{join(readRequest, readResponse), writeRequest, writeResponse, readRequest} {
+		if _, err := master.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var transactions []Transaction
+	for time.Now().Before(deadline) {
+		if transactions, _ = s.Transactions(); len(transactions) >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	if len(transactions) != 2 {
+		t.Fatalf("%d transactions, want 2: %v", len(transactions), transactions)
+	}
+	for i, want := range []sniffed{{readRequest, readResponse}, {writeRequest, writeResponse}} {
+		got := transactions[i]
+		if !bytes.Equal(got.Request.ADU, want.request) || got.Response == nil || !bytes.Equal(got.Response.ADU, want.response) {
+			t.Errorf("transaction %d: %s, want request % X and response % X", i, got.Summary(), want.request, want.response)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package nexus_modbus
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// latencyWindow bounds the response times kept per device for the p95
+const latencyWindow = 1000
+
+// DeviceStats are the counters of one device
+type DeviceStats struct {
+	Device      string
+	Requests    int
+	Successes   int
+	Timeouts    int
+	FrameErrors int // CRC mismatches and malformed or mismatched responses
+	PortErrors  int
+	Exceptions  map[byte]int // By exception code
+	Min         time.Duration
+	Avg         time.Duration
+	Max         time.Duration
+	P95         time.Duration // Over the last latencyWindow responses
+}
+
+// ExceptionCount returns the total number of exception responses
+func (d DeviceStats) ExceptionCount() int {
+	total := 0
+	for _, count := range d.Exceptions {
+		total += count
+	}
+	return total
+}
+
+// ExceptionSummary lists the exception counts by code, e.g. "02: 3, 04: 1"
+func (d DeviceStats) ExceptionSummary() string {
+	codes := make([]int, 0, len(d.Exceptions))
+	for code := range d.Exceptions {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%02X: %d", code, d.Exceptions[byte(code)])
+	}
+	return strings.Join(parts, ", ")
+}
+
+type deviceCounters struct {
+	stats     DeviceStats
+	total     time.Duration
+	responses int
+	latencies []time.Duration // Ring of the most recent response times
+	next      int
+}
+
+// Stats collects request counters and response times per device
+type Stats struct {
+	mu      sync.Mutex
+	devices map[string]*deviceCounters
+	order   []string
+}
+
+// NewStats creates empty statistics
+func NewStats() *Stats {
+	return &Stats{devices: make(map[string]*deviceCounters)}
+}
+
+// Client returns a client on handler that counts every request for device
+func (s *Stats) Client(device string, handler modbus.ClientHandler) modbus.Client {
+	return &statsClient{client: modbus.NewClient(handler), stats: s, device: device}
+}
+
+// Handler wraps handler so the requests SendPDU sends through it, e.g. device identification,
+// are counted for device. Use Client for the standard functions.
+func (s *Stats) Handler(device string, handler modbus.ClientHandler) modbus.ClientHandler {
+	return &statsHandler{ClientHandler: handler, stats: s, device: device}
+}
+
+// counters returns the counters of a device, creating them on first use. s.mu must be held.
+func (s *Stats) counters(device string) *deviceCounters {
+	counters, ok := s.devices[device]
+	if !ok {
+		counters = &deviceCounters{stats: DeviceStats{Device: device, Exceptions: make(map[byte]int)}}
+		s.devices[device] = counters
+		s.order = append(s.order, device)
+	}
+	return counters
+}
+
+// Record counts one request and its outcome. Latency only counts when the device answered.
+// Requests cancelled by a stop or pause are not counted, the device was not at fault.
+func (s *Stats) Record(device string, latency time.Duration, err error) {
+	classified := Classify(err)
+	if classified != nil && classified.Code == CodeCancelled {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := s.counters(device)
+	stats := &counters.stats
+	stats.Requests++
+
+	if err == nil {
+		stats.Successes++
+	} else {
+		switch {
+		case classified.Code == CodeException:
+			stats.Exceptions[classified.ExceptionCode]++
+		case classified.Code == CodeTimeout:
+			stats.Timeouts++
+			return
+		case classified.IsPortFailure():
+			stats.PortErrors++
+			return
+		default:
+			stats.FrameErrors++
+		}
+	}
+
+	if counters.responses == 0 || latency < stats.Min {
+		stats.Min = latency
+	}
+	if latency > stats.Max {
+		stats.Max = latency
+	}
+	counters.responses++
+	counters.total += latency
+	if len(counters.latencies) < latencyWindow {
+		counters.latencies = append(counters.latencies, latency)
+	} else {
+		counters.latencies[counters.next] = latency
+		counters.next = (counters.next + 1) % latencyWindow
+	}
+}
+
+// Snapshot returns a copy of the counters of every device in the order they were first seen
+func (s *Stats) Snapshot() []DeviceStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make([]DeviceStats, 0, len(s.order))
+	for _, device := range s.order {
+		counters := s.devices[device]
+		stats := counters.stats
+		stats.Exceptions = make(map[byte]int, len(counters.stats.Exceptions))
+		for code, count := range counters.stats.Exceptions {
+			stats.Exceptions[code] = count
+		}
+		if counters.responses > 0 {
+			stats.Avg = counters.total / time.Duration(counters.responses)
+			stats.P95 = percentile(counters.latencies, 0.95)
+		}
+		snapshot = append(snapshot, stats)
+	}
+	return snapshot
+}
+
+// Reset clears the counters of every device
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.devices = make(map[string]*deviceCounters)
+	s.order = nil
+}
+
+// percentile returns the nearest-rank percentile of an unsorted set of durations
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(p*float64(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// WriteStatsCSV writes the counters as CSV, response times in milliseconds
+func WriteStatsCSV(w io.Writer, stats []DeviceStats) error {
+	writer := csv.NewWriter(w)
+	header := []string{"device", "requests", "successes", "timeouts", "frame_errors", "port_errors",
+		"exceptions", "exceptions_by_code", "min_ms", "avg_ms", "max_ms", "p95_ms"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64)
+	}
+	for _, d := range stats {
+		record := []string{
+			d.Device,
+			strconv.Itoa(d.Requests),
+			strconv.Itoa(d.Successes),
+			strconv.Itoa(d.Timeouts),
+			strconv.Itoa(d.FrameErrors),
+			strconv.Itoa(d.PortErrors),
+			strconv.Itoa(d.ExceptionCount()),
+			d.ExceptionSummary(),
+			ms(d.Min),
+			ms(d.Avg),
+			ms(d.Max),
+			ms(d.P95),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// statsHandler marks a handler whose raw requests are counted, SendPDU records them once the
+// response has passed every check
+type statsHandler struct {
+	modbus.ClientHandler
+	stats  *Stats
+	device string
+}
+
+// statsClient counts every call as one request, with the outcome the caller sees. The client
+// checks the byte count and echoed fields after decoding, so the handler cannot tell.
+type statsClient struct {
+	client modbus.Client
+	stats  *Stats
+	device string
+}
+
+// count records the outcome of a call started at start
+func (c *statsClient) count(start time.Time, err error) {
+	c.stats.Record(c.device, time.Since(start), err)
+}
+
+func (c *statsClient) ReadCoils(address, quantity uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.ReadCoils(address, quantity)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) ReadDiscreteInputs(address, quantity uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.ReadDiscreteInputs(address, quantity)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) WriteSingleCoil(address, value uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.WriteSingleCoil(address, value)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) WriteMultipleCoils(address, quantity uint16, value []byte) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.WriteMultipleCoils(address, quantity, value)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) ReadInputRegisters(address, quantity uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.ReadInputRegisters(address, quantity)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.ReadHoldingRegisters(address, quantity)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.WriteSingleRegister(address, value)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.WriteMultipleRegisters(address, quantity, value)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity uint16, value []byte) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.ReadWriteMultipleRegisters(readAddress, readQuantity, writeAddress, writeQuantity, value)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) MaskWriteRegister(address, andMask, orMask uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.MaskWriteRegister(address, andMask, orMask)
+	c.count(start, err)
+	return results, err
+}
+
+func (c *statsClient) ReadFIFOQueue(address uint16) ([]byte, error) {
+	start := time.Now()
+	results, err := c.client.ReadFIFOQueue(address)
+	c.count(start, err)
+	return results, err
+}
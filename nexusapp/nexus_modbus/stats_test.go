@@ -0,0 +1,57 @@
+package nexus_modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code ErrorCode
+	}{
+		{name: "exception", err: &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 0x02}, code: CodeException},
+		{name: "serial timeout", err: serial.ErrTimeout, code: CodeTimeout},
+		{name: "cancelled", err: context.Canceled, code: CodeCancelled},
+		{name: "wrapped cancel", err: fmt.Errorf("read: %w", context.Canceled), code: CodeCancelled},
+		{name: "deadline", err: context.DeadlineExceeded, code: CodeCancelled},
+		{name: "crc", err: errors.New("modbus: response crc 'FFFF' does not match expected '1234'"), code: CodeCRCMismatch},
+		{name: "unknown", err: errors.New("something else"), code: CodeUnknown},
+	}
+	for _, test := range tests {
+		if code := Classify(test.err).Code; code != test.code {
+			t.Errorf("%s: Classify(%v) = %s, want %s", test.name, test.err, code, test.code)
+		}
+	}
+}
+
+func TestStatsRecord(t *testing.T) {
+	stats := NewStats()
+	stats.Record("plc", 10*time.Millisecond, nil)
+	stats.Record("plc", 30*time.Millisecond, &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 0x02})
+	stats.Record("plc", time.Second, serial.ErrTimeout)
+	stats.Record("plc", 20*time.Millisecond, errors.New("modbus: response crc does not match"))
+	// A stop or pause abandoning a request is not counted
+	stats.Record("plc", 5*time.Millisecond, context.Canceled)
+	stats.Record("plc", 5*time.Millisecond, fmt.Errorf("poll: %w", context.DeadlineExceeded))
+
+	snapshot := stats.Snapshot()
+	if len(snapshot) != 1 {
+		t.Fatalf("%d devices, want 1", len(snapshot))
+	}
+	d := snapshot[0]
+	if d.Requests != 4 || d.Successes != 1 || d.Timeouts != 1 || d.FrameErrors != 1 || d.ExceptionCount() != 1 {
+		t.Fatalf("counted %+v, want 4 requests: 1 success, 1 timeout, 1 frame error and 1 exception", d)
+	}
+	// The timeout has no response time
+	if d.Min != 10*time.Millisecond || d.Max != 30*time.Millisecond || d.Avg != 20*time.Millisecond {
+		t.Fatalf("response times min %v avg %v max %v, want 10ms 20ms 30ms", d.Min, d.Avg, d.Max)
+	}
+}
@@ -0,0 +1,298 @@
+package nexus_modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// maxSweepHosts bounds the targets of one sweep, a /16 network
+const maxSweepHosts = 65536
+
+// SweepOptions controls a network sweep
+type SweepOptions struct {
+	Hosts          []string // IP addresses or host names
+	Ports          []int
+	UnitId         byte // Unit ID of the probe, 0 addresses the gateway or device itself
+	Register       int  // Holding register the probe reads
+	Workers        int  // Hosts probed at the same time
+	ConnectTimeout time.Duration
+	Timeout        time.Duration // Wait for each response
+	Identify       bool          // Ask every answering host for its FC43 identification
+}
+
+// SweepResult is a host that answered the probe, with data or with an exception
+type SweepResult struct {
+	Address       string // host:port
+	Latency       time.Duration
+	ExceptionCode byte                  // 0 when the probe read succeeded
+	Identity      *DeviceIdentification // nil when the host did not answer FC43
+}
+
+// ParseSweepTargets reads a list of IP addresses, host names and CIDR networks separated by
+// commas or whitespace. The network and broadcast addresses of IPv4 networks are left out.
+func ParseSweepTargets(text string) ([]string, error) {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(host string) error {
+		if !seen[host] {
+			if len(hosts) == maxSweepHosts {
+				return fmt.Errorf("too many hosts, at most %d can be swept at once", maxSweepHosts)
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+		return nil
+	}
+
+	for _, field := range splitValues(text) {
+		if !strings.Contains(field, "/") {
+			if err := add(field); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ip, network, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", field)
+		}
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("network %q: only IPv4 networks can be swept", field)
+		}
+		ones, bits := network.Mask.Size()
+		if bits-ones > 16 {
+			return nil, fmt.Errorf("network %q is too large, use /16 or smaller", field)
+		}
+		first := binary.BigEndian.Uint32(network.IP.To4())
+		last := first | (1<<uint(bits-ones) - 1)
+		if last-first >= 2 {
+			// Skip the network and broadcast addresses
+			first, last = first+1, last-1
+		}
+		for n := uint64(first); n <= uint64(last); n++ {
+			address := make(net.IP, 4)
+			binary.BigEndian.PutUint32(address, uint32(n))
+			if err := add(address.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts given")
+	}
+	return hosts, nil
+}
+
+// ParsePorts reads a list of TCP ports separated by commas or whitespace
+func ParsePorts(text string) ([]int, error) {
+	var ports []int
+	for _, field := range splitValues(text) {
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// SweepNetwork probes every port of every host with up to Workers connections at a time.
+// Hosts that answer are passed to found, progress counts the probed addresses. Both are
+// called from one goroutine at a time. The sweep returns early when ctx is cancelled.
+func SweepNetwork(ctx context.Context, options SweepOptions, found func(SweepResult), progress func(done, total int)) {
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	addresses := make(chan string)
+	go func() {
+		defer close(addresses)
+		for _, host := range options.Hosts {
+			for _, port := range options.Ports {
+				select {
+				case addresses <- net.JoinHostPort(host, strconv.Itoa(port)):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done, total := 0, len(options.Hosts)*len(options.Ports)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for address := range addresses {
+				result, ok := probeHost(ctx, address, options)
+
+				mu.Lock()
+				if ok && ctx.Err() == nil {
+					found(result)
+				}
+				done++
+				progress(done, total)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// probeHost connects to one address and reads the probe register. It reports false when
+// the port is closed or nothing answered.
+func probeHost(ctx context.Context, address string, options SweepOptions) (SweepResult, bool) {
+	result := SweepResult{Address: address}
+	dialer := net.Dialer{Timeout: options.ConnectTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return result, false
+	}
+
+	// A connection of its own, the sweep should not keep every host open in NetPorts
+	conn := &NetConnection{kind: TransportTCP, address: address, conn: netConn}
+	defer conn.Close()
+
+	timing := Timing{Timeout: options.Timeout}
+	var start time.Time
+	err = conn.Do(ctx, options.UnitId, timing, func(handler modbus.ClientHandler) error {
+		start = time.Now()
+		_, err := modbus.NewClient(handler).ReadHoldingRegisters(uint16(options.Register), 1)
+		return err
+	})
+	result.Latency = time.Since(start)
+	if err != nil {
+		mbErr, ok := err.(*modbus.ModbusError)
+		if !ok {
+			return result, false
+		}
+		// An exception still proves a Modbus device is listening
+		result.ExceptionCode = mbErr.ExceptionCode
+	}
+
+	if options.Identify {
+		conn.Do(ctx, options.UnitId, timing, func(handler modbus.ClientHandler) error {
+			result.Identity, err = ReadDeviceIdentification(handler)
+			return err
+		})
+	}
+	return result, true
+}
+
+// Gateway exceptions, sent by a gateway on behalf of a target that did not answer
+const (
+	ExceptionGatewayPathUnavailable byte = 0x0A
+	ExceptionGatewayTargetFailed    byte = 0x0B
+)
+
+// IsGatewayException reports whether an exception code comes from a gateway about its
+// target rather than from a device
+func IsGatewayException(code byte) bool {
+	return code == ExceptionGatewayPathUnavailable || code == ExceptionGatewayTargetFailed
+}
+
+// UnitSweepOptions controls a unit ID sweep behind a gateway
+type UnitSweepOptions struct {
+	First, Last int // Unit IDs to probe, 1-247
+	Register    int // Holding register the probe reads
+	Timeout     time.Duration
+	Identify    bool // Ask every device found for its FC43 identification
+}
+
+// UnitResult is a unit ID a device answered for, with data or with an exception of its own
+type UnitResult struct {
+	UnitId        byte
+	Latency       time.Duration
+	ExceptionCode byte                  // 0 when the probe read succeeded
+	Identity      *DeviceIdentification // nil when the device did not answer FC43
+}
+
+// SweepUnits probes the unit IDs over one connection, such as a TCP-to-RTU gateway. Devices
+// are passed to found, the gateway's exceptions for absent targets are only counted.
+// The sweep returns early when ctx is cancelled and stops when the connection fails.
+func SweepUnits(ctx context.Context, conn Transport, options UnitSweepOptions, found func(UnitResult),
+	progress func(done, total int)) (gatewayAnswers int, err error) {
+	timing := Timing{Timeout: options.Timeout}
+	total := options.Last - options.First + 1
+	for id := options.First; id <= options.Last && ctx.Err() == nil; id++ {
+		result := UnitResult{UnitId: byte(id)}
+		var start time.Time
+		err := conn.Do(ctx, byte(id), timing, func(handler modbus.ClientHandler) error {
+			start = time.Now()
+			_, err := modbus.NewClient(handler).ReadHoldingRegisters(uint16(options.Register), 1)
+			return err
+		})
+		result.Latency = time.Since(start)
+
+		if _, ok := err.(*PortError); ok {
+			return gatewayAnswers, err
+		}
+		answered := err == nil
+		if mbErr, ok := err.(*modbus.ModbusError); ok {
+			if IsGatewayException(mbErr.ExceptionCode) {
+				gatewayAnswers++
+			} else {
+				// Any other exception comes from a device listening on this ID
+				result.ExceptionCode = mbErr.ExceptionCode
+				answered = true
+			}
+		}
+		if answered {
+			if options.Identify {
+				conn.Do(ctx, byte(id), timing, func(handler modbus.ClientHandler) error {
+					result.Identity, err = ReadDeviceIdentification(handler)
+					return err
+				})
+			}
+			found(result)
+		}
+		progress(id-options.First+1, total)
+	}
+	return gatewayAnswers, nil
+}
+
+// WriteSweepCSV writes one line per answering host, latencies in milliseconds
+func WriteSweepCSV(w io.Writer, results []SweepResult) error {
+	writer := csv.NewWriter(w)
+	header := []string{"address", "latency_ms", "exception", "vendor", "product_code", "revision", "product_name", "model"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, result := range results {
+		exception := ""
+		if result.ExceptionCode != 0 {
+			exception = fmt.Sprintf("0x%02X", result.ExceptionCode)
+		}
+		identity := result.Identity
+		if identity == nil {
+			identity = &DeviceIdentification{}
+		}
+		record := []string{
+			result.Address,
+			strconv.FormatFloat(float64(result.Latency)/float64(time.Millisecond), 'f', 1, 64),
+			exception,
+			identity.Get("VendorName"),
+			identity.Get("ProductCode"),
+			identity.Get("MajorMinorRevision"),
+			identity.Get("ProductName"),
+			identity.Get("ModelName"),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,205 @@
+package nexus_modbus
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseSweepTargets(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		count int
+		first string
+		last  string
+		err   bool
+	}{
+		{name: "host", text: "192.168.1.10", count: 1, first: "192.168.1.10", last: "192.168.1.10"},
+		{name: "list with duplicates", text: "10.0.0.1, plc.local 10.0.0.1;10.0.0.2", count: 3, first: "10.0.0.1", last: "10.0.0.2"},
+		{name: "/24 without network and broadcast", text: "192.168.1.0/24", count: 254, first: "192.168.1.1", last: "192.168.1.254"},
+		{name: "host bits ignored", text: "192.168.1.77/30", count: 2, first: "192.168.1.77", last: "192.168.1.78"},
+		{name: "/31 keeps both addresses", text: "10.0.0.4/31", count: 2, first: "10.0.0.4", last: "10.0.0.5"},
+		{name: "/32", text: "10.0.0.9/32", count: 1, first: "10.0.0.9", last: "10.0.0.9"},
+		{name: "overlapping networks", text: "10.0.0.0/30 10.0.0.0/29", count: 6, first: "10.0.0.1", last: "10.0.0.6"},
+		{name: "/16", text: "172.16.0.0/16", count: 65534, first: "172.16.0.1", last: "172.16.255.254"},
+		{name: "larger than /16", text: "10.0.0.0/15", err: true},
+		{name: "more than a /16 in total", text: "10.0.0.0/16 10.1.0.0/16", err: true},
+		{name: "IPv6 network", text: "fd00::/120", err: true},
+		{name: "invalid network", text: "10.0.0.0/33", err: true},
+		{name: "empty", text: " , ", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hosts, err := ParseSweepTargets(test.text)
+			if test.err {
+				if err == nil {
+					t.Fatalf("ParseSweepTargets(%q) returned %d hosts, want an error", test.text, len(hosts))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSweepTargets(%q): %v", test.text, err)
+			}
+			if len(hosts) != test.count || hosts[0] != test.first || hosts[len(hosts)-1] != test.last {
+				t.Fatalf("ParseSweepTargets(%q) = %d hosts %s..%s, want %d hosts %s..%s", test.text,
+					len(hosts), hosts[0], hosts[len(hosts)-1], test.count, test.first, test.last)
+			}
+		})
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		text  string
+		ports []int
+		err   bool
+	}{
+		{text: "502", ports: []int{502}},
+		{text: "502, 5020 1502", ports: []int{502, 5020, 1502}},
+		{text: "", ports: nil},
+		{text: "0", err: true},
+		{text: "65536", err: true},
+		{text: "502,modbus", err: true},
+	}
+	for _, test := range tests {
+		ports, err := ParsePorts(test.text)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParsePorts(%q) = %v, want an error", test.text, ports)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePorts(%q): %v", test.text, err)
+			continue
+		}
+		if len(ports) != len(test.ports) {
+			t.Errorf("ParsePorts(%q) = %v, want %v", test.text, ports, test.ports)
+			continue
+		}
+		for i := range ports {
+			if ports[i] != test.ports[i] {
+				t.Errorf("ParsePorts(%q) = %v, want %v", test.text, ports, test.ports)
+				break
+			}
+		}
+	}
+}
+
+// listenLoopback listens on the same free port of every host, all in 127.0.0.0/8
+func listenLoopback(t *testing.T, hosts ...string) (int, []net.Listener) {
+	t.Helper()
+	for attempt := 0; attempt < 10; attempt++ {
+		first, err := net.Listen("tcp", net.JoinHostPort(hosts[0], "0"))
+		if err != nil {
+			t.Skipf("cannot listen on %s: %v", hosts[0], err)
+		}
+		port := first.Addr().(*net.TCPAddr).Port
+		listeners := []net.Listener{first}
+		for _, host := range hosts[1:] {
+			listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err != nil {
+				break
+			}
+			listeners = append(listeners, listener)
+		}
+		if len(listeners) == len(hosts) {
+			return port, listeners
+		}
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+	t.Skip("no port free on every loopback address")
+	return 0, nil
+}
+
+func TestSweepNetwork(t *testing.T) {
+	port, listeners := listenLoopback(t, "127.0.0.2", "127.0.0.3", "127.0.0.5")
+
+	// A device, a device without the probe register, and a port that is not Modbus
+	device := NewSimulator([]byte{1}, SimSizes{HoldingRegisters: 16})
+	small := NewSimulator([]byte{7}, SimSizes{HoldingRegisters: 4})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go device.ServeTCP(ctx, listeners[0])
+	go small.ServeTCP(ctx, listeners[1])
+	go func() {
+		for {
+			conn, err := listeners[2].Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	defer listeners[2].Close()
+
+	hosts, err := ParseSweepTargets("127.0.0.0/29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := SweepOptions{
+		Hosts:          hosts,
+		Ports:          []int{port},
+		Register:       10,
+		Workers:        3,
+		ConnectTimeout: time.Second,
+		Timeout:        time.Second,
+	}
+	var results []SweepResult
+	lastDone, total := 0, 0
+	SweepNetwork(context.Background(), options, func(result SweepResult) {
+		results = append(results, result)
+	}, func(done, n int) {
+		if done != lastDone+1 {
+			t.Errorf("progress jumped from %d to %d", lastDone, done)
+		}
+		lastDone, total = done, n
+	})
+
+	if lastDone != 6 || total != 6 {
+		t.Errorf("progress ended at %d of %d, want 6 of 6", lastDone, total)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Address < results[j].Address })
+	if len(results) != 2 {
+		t.Fatalf("%d hosts found, want 2: %+v", len(results), results)
+	}
+	portText := strconv.Itoa(port)
+	if results[0].Address != "127.0.0.2:"+portText || results[0].ExceptionCode != 0 {
+		t.Errorf("first result %+v, want 127.0.0.2:%s without exception", results[0], portText)
+	}
+	// The exception still proves a device listens
+	if results[1].Address != "127.0.0.3:"+portText || results[1].ExceptionCode != 0x02 {
+		t.Errorf("second result %+v, want 127.0.0.3:%s with exception 0x02", results[1], portText)
+	}
+	if n := device.Requests(); n != 1 {
+		t.Errorf("device probed %d times, want once", n)
+	}
+}
+
+func TestSweepNetworkCancelled(t *testing.T) {
+	hosts, err := ParseSweepTargets("127.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		SweepNetwork(ctx, SweepOptions{Hosts: hosts, Ports: []int{1}, Workers: 4, ConnectTimeout: time.Second},
+			func(result SweepResult) { t.Errorf("%s found after cancel", result.Address) },
+			func(done, total int) {})
+	}()
+	select {
+	case <-finished:
+	case <-time.After(waitTimeout):
+		t.Fatal("cancelled sweep did not return")
+	}
+}
@@ -0,0 +1,80 @@
+package nexus_modbus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// Timing holds the per-session request timing used for RTU and TCP reads and writes
+type Timing struct {
+	PollInterval time.Duration // Pause between poll cycles
+	Timeout      time.Duration // Wait for each response
+	FrameDelay   time.Duration // Minimum silence before each request, for slow RS-485 turnaround
+	Retries      int           // Extra attempts after a request got no valid response
+}
+
+// DefaultTiming returns the timing the scanners used before it was configurable
+func DefaultTiming() Timing {
+	return Timing{
+		PollInterval: 2 * time.Second,
+		Timeout:      time.Second,
+	}
+}
+
+// Run calls request and repeats it up to Retries times while it fails without a valid
+// response, waiting FrameDelay before each repeat. Exceptions and port failures are not retried,
+// and retries end when ctx is done.
+func (t Timing) Run(ctx context.Context, request func() error) error {
+	err := request()
+	for attempt := 0; attempt < t.Retries && retryable(err) && ctx.Err() == nil; attempt++ {
+		timer := time.NewTimer(t.FrameDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		err = request()
+	}
+	return err
+}
+
+// retryable reports whether a failed request is worth sending again
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch err.(type) {
+	case *modbus.ModbusError, *PortError:
+		return false
+	}
+	return true
+}
+
+// ParseMilliseconds parses a duration entered as whole milliseconds
+func ParseMilliseconds(text string) (time.Duration, error) {
+	ms, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid number of milliseconds %q", text)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// TimingFromMilliseconds builds a timing from values given in whole milliseconds,
+// a timeout of 0 selects defaultTimeout
+func TimingFromMilliseconds(timeoutMs, frameDelayMs, retries int, defaultTimeout time.Duration) Timing {
+	timing := Timing{
+		Timeout:    defaultTimeout,
+		FrameDelay: time.Duration(frameDelayMs) * time.Millisecond,
+		Retries:    retries,
+	}
+	if timeoutMs > 0 {
+		timing.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	return timing
+}
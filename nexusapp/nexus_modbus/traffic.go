@@ -0,0 +1,254 @@
+package nexus_modbus
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trafficCapacity bounds the frames kept by the traffic monitor
+const trafficCapacity = 5000
+
+// Direction tells whether a frame was transmitted or received
+type Direction string
+
+const (
+	DirectionTX Direction = "TX"
+	DirectionRX Direction = "RX"
+)
+
+// Frame is one captured ADU
+type Frame struct {
+	Time      time.Time
+	Direction Direction
+	Transport string // A TransportKind, "RTU", "ASCII", "TCP", "RTU over TCP" or "UDP"
+	Source    string // Serial port or host:port
+	ADU       []byte
+}
+
+// Hex returns the ADU as space separated hex bytes. ASCII frames are shown as their text.
+func (f Frame) Hex() string {
+	if f.Transport == string(TransportASCII) {
+		return strings.TrimRight(string(f.ADU), "\r\n")
+	}
+	return fmt.Sprintf("% X", f.ADU)
+}
+
+// FrameInfo is the decoded header of a frame. Fields the frame does not carry are left unset.
+// The checksum of an ASCII frame is its LRC.
+type FrameInfo struct {
+	SlaveId       byte
+	FunctionCode  byte
+	Address       int // -1 when the frame has no address
+	Count         int // -1 when the frame has no count
+	HasCRC        bool
+	CRCOK         bool
+	Exception     bool
+	ExceptionCode byte
+}
+
+// Decode parses the slave, function code, address, count, CRC and exception of a frame
+func (f Frame) Decode() (FrameInfo, bool) {
+	info := FrameInfo{Address: -1, Count: -1}
+	var pdu []byte
+	switch TransportKind(f.Transport) {
+	case TransportTCP, TransportUDP:
+		if len(f.ADU) < 8 {
+			return info, false
+		}
+		info.SlaveId = f.ADU[6]
+		pdu = f.ADU[7:]
+	case TransportASCII:
+		frame, ok := asciiBytes(f.ADU)
+		if !ok || len(frame) < 3 {
+			return info, false
+		}
+		info.SlaveId = frame[0]
+		pdu = frame[1 : len(frame)-1]
+		info.HasCRC = true
+		info.CRCOK = frame[len(frame)-1] == LRC(frame[:len(frame)-1])
+	default:
+		if len(f.ADU) < 4 {
+			return info, false
+		}
+		info.SlaveId = f.ADU[0]
+		pdu = f.ADU[1 : len(f.ADU)-2]
+		info.HasCRC = true
+		checksum := uint16(f.ADU[len(f.ADU)-1])<<8 | uint16(f.ADU[len(f.ADU)-2])
+		info.CRCOK = checksum == CRC16(f.ADU[:len(f.ADU)-2])
+	}
+	if len(pdu) == 0 {
+		return info, false
+	}
+
+	info.FunctionCode = pdu[0] & 0x7F
+	if pdu[0]&0x80 != 0 {
+		info.Exception = true
+		if len(pdu) > 1 {
+			info.ExceptionCode = pdu[1]
+		}
+		return info, true
+	}
+
+	word := func(i int) int {
+		return int(pdu[i])<<8 | int(pdu[i+1])
+	}
+	request := f.Direction == DirectionTX
+	switch info.FunctionCode {
+	case 1, 2, 3, 4:
+		if request && len(pdu) >= 5 {
+			info.Address, info.Count = word(1), word(3)
+		} else if !request && len(pdu) >= 2 {
+			info.Count = int(pdu[1]) // Byte count of the response
+		}
+	case 5, 6, 22:
+		if len(pdu) >= 3 {
+			info.Address, info.Count = word(1), 1
+		}
+	case 15, 16:
+		if len(pdu) >= 5 {
+			info.Address, info.Count = word(1), word(3)
+		}
+	case 23:
+		if request && len(pdu) >= 5 {
+			info.Address, info.Count = word(1), word(3)
+		} else if !request && len(pdu) >= 2 {
+			info.Count = int(pdu[1])
+		}
+	}
+	return info, true
+}
+
+// Summary describes the decoded frame in one line
+func (f Frame) Summary() string {
+	info, ok := f.Decode()
+	if !ok {
+		return "malformed frame"
+	}
+	parts := []string{fmt.Sprintf("slave %d", info.SlaveId), fmt.Sprintf("FC%d", info.FunctionCode)}
+	if info.Exception {
+		parts = append(parts, fmt.Sprintf("exception %02X", info.ExceptionCode))
+	}
+	if info.Address >= 0 {
+		parts = append(parts, fmt.Sprintf("address %d", info.Address))
+	}
+	if info.Count >= 0 {
+		if f.Direction == DirectionRX && info.Address < 0 {
+			parts = append(parts, fmt.Sprintf("%d bytes", info.Count))
+		} else {
+			parts = append(parts, fmt.Sprintf("count %d", info.Count))
+		}
+	}
+	if info.HasCRC {
+		checksum := "CRC"
+		if f.Transport == string(TransportASCII) {
+			checksum = "LRC"
+		}
+		if info.CRCOK {
+			parts = append(parts, checksum+" OK")
+		} else {
+			parts = append(parts, checksum+" bad")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CRC16 computes the Modbus RTU CRC of data
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// LRC computes the Modbus ASCII longitudinal redundancy check of data
+func LRC(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// asciiBytes decodes the hex digits between the colon and CR LF of an ASCII frame
+func asciiBytes(adu []byte) ([]byte, bool) {
+	text := strings.TrimRight(string(adu), "\r\n")
+	if !strings.HasPrefix(text, ":") {
+		return nil, false
+	}
+	frame, err := hex.DecodeString(text[1:])
+	return frame, err == nil
+}
+
+// TrafficMonitor keeps the most recent frames sent and received by the application
+type TrafficMonitor struct {
+	mu      sync.Mutex
+	frames  []Frame
+	next    int
+	full    bool
+	version uint64
+}
+
+// Traffic is the monitor every transport reports its frames to
+var Traffic = NewTrafficMonitor(trafficCapacity)
+
+// NewTrafficMonitor creates a monitor holding up to capacity frames
+func NewTrafficMonitor(capacity int) *TrafficMonitor {
+	return &TrafficMonitor{frames: make([]Frame, capacity)}
+}
+
+// Capture records a frame. The ADU is copied, so callers may reuse their buffer.
+func (m *TrafficMonitor) Capture(direction Direction, transport, source string, adu []byte) {
+	frame := Frame{
+		Time:      time.Now(),
+		Direction: direction,
+		Transport: transport,
+		Source:    source,
+		ADU:       append([]byte(nil), adu...),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.frames[m.next] = frame
+	m.next = (m.next + 1) % len(m.frames)
+	if m.next == 0 {
+		m.full = true
+	}
+	m.version++
+}
+
+// Frames returns the kept frames, oldest first, and a version that changes whenever they do,
+// so callers can tell whether anything new arrived
+func (m *TrafficMonitor) Frames() ([]Frame, uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var frames []Frame
+	if m.full {
+		frames = append(frames, m.frames[m.next:]...)
+	}
+	frames = append(frames, m.frames[:m.next]...)
+	return frames, m.version
+}
+
+// Clear drops the kept frames
+func (m *TrafficMonitor) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.frames = make([]Frame, len(m.frames))
+	m.next = 0
+	m.full = false
+	m.version++
+}
@@ -0,0 +1,78 @@
+package nexus_modbus
+
+import (
+	"context"
+
+	"github.com/goburrow/modbus"
+)
+
+// TransportKind names the framing and link requests travel over
+type TransportKind string
+
+const (
+	TransportRTU        TransportKind = "RTU"
+	TransportASCII      TransportKind = "ASCII"
+	TransportTCP        TransportKind = "TCP"          // MBAP framing over TCP
+	TransportRTUOverTCP TransportKind = "RTU over TCP" // Raw RTU frames through a serial to Ethernet converter
+	TransportUDP        TransportKind = "UDP"          // MBAP framing over UDP
+)
+
+// Transports lists the transports in the order the UI offers them
+var Transports = []TransportKind{TransportRTU, TransportASCII, TransportTCP, TransportRTUOverTCP, TransportUDP}
+
+// NetworkTransports lists the transports that reach a host instead of a serial port
+var NetworkTransports = []TransportKind{TransportTCP, TransportRTUOverTCP, TransportUDP}
+
+// IsSerial reports whether the transport uses a serial port
+func (k TransportKind) IsSerial() bool {
+	return k == TransportRTU || k == TransportASCII
+}
+
+// ParseTransport accepts the names in Transports, an empty string selects RTU
+func ParseTransport(s string) (TransportKind, bool) {
+	if s == "" {
+		return TransportRTU, true
+	}
+	for _, kind := range Transports {
+		if string(kind) == s {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// Transport sends requests to the devices behind a serial port or network address.
+// Scans, writes and discovery only use this interface, so they work over every transport.
+type Transport interface {
+	// Do runs fn with exclusive use of the transport. The handler passed to fn addresses
+	// slaveId and sends with the given timing, fn is repeated for timing.Retries when it gets
+	// no valid response. Failures of the port or connection are returned as *PortError.
+	Do(ctx context.Context, slaveId byte, timing Timing, fn func(handler modbus.ClientHandler) error) error
+	// Name names the transport and its port or address for display
+	Name() string
+}
+
+// TransportConfig selects a transport and what it connects to
+type TransportConfig struct {
+	Kind    TransportKind
+	Serial  RTUConfig // Line settings of RTU and ASCII
+	Address string    // host:port of the network transports
+}
+
+// Target returns the serial port or network address the transport connects to
+func (c TransportConfig) Target() string {
+	if c.Kind.IsSerial() {
+		return c.Serial.Port
+	}
+	return c.Address
+}
+
+// GetTransport returns the shared transport for config
+func GetTransport(config TransportConfig) Transport {
+	if config.Kind.IsSerial() {
+		serial := config.Serial
+		serial.ASCII = config.Kind == TransportASCII
+		return RTUPorts.Get(serial)
+	}
+	return NetPorts.Get(config.Kind, config.Address)
+}
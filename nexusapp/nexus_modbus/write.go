@@ -0,0 +1,227 @@
+package nexus_modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/goburrow/modbus"
+)
+
+// WriteFunctions lists the supported write function codes with their display names
+var WriteFunctions = []string{
+	"5: Write Single Coil",
+	"6: Write Single Register",
+	"15: Write Multiple Coils",
+	"16: Write Multiple Registers",
+	"22: Mask Write Register",
+	"23: Read/Write Multiple Registers",
+}
+
+// WriteRequest describes one write operation
+type WriteRequest struct {
+	FunctionCode int
+	Address      uint16
+	Quantity     uint16 // Coils or registers written by FC15, FC16 and FC23
+	Data         []byte // Packed coils (FC5, FC15) or register bytes (FC6, FC16, FC23)
+	AndMask      uint16 // FC22
+	OrMask       uint16 // FC22
+	ReadAddress  uint16 // FC23
+	ReadQuantity uint16 // FC23
+}
+
+// Protocol limits on the quantity of one request
+const (
+	MaxWriteCoils         = 1968 // FC15
+	MaxWriteRegisters     = 123  // FC16
+	MaxReadWriteRegisters = 121  // Written by FC23
+	MaxReadRegistersFC23  = 125  // Read by FC23
+)
+
+// Validate checks the quantities of the request against the protocol limits, so an oversized
+// write fails before it is sent instead of with a device exception
+func (r WriteRequest) Validate() error {
+	switch r.FunctionCode {
+	case 15:
+		if r.Quantity < 1 || r.Quantity > MaxWriteCoils {
+			return fmt.Errorf("FC15 writes 1 to %d coils, got %d", MaxWriteCoils, r.Quantity)
+		}
+	case 16:
+		if r.Quantity < 1 || r.Quantity > MaxWriteRegisters {
+			return fmt.Errorf("FC16 writes 1 to %d registers, got %d", MaxWriteRegisters, r.Quantity)
+		}
+	case 23:
+		if r.Quantity < 1 || r.Quantity > MaxReadWriteRegisters {
+			return fmt.Errorf("FC23 writes 1 to %d registers, got %d", MaxReadWriteRegisters, r.Quantity)
+		}
+		if r.ReadQuantity < 1 || r.ReadQuantity > MaxReadRegistersFC23 {
+			return fmt.Errorf("FC23 reads 1 to %d registers, got %d", MaxReadRegistersFC23, r.ReadQuantity)
+		}
+		if int(r.ReadAddress)+int(r.ReadQuantity) > 65536 {
+			return fmt.Errorf("read of %d registers at %d runs past address 65535", r.ReadQuantity, r.ReadAddress)
+		}
+	}
+	switch r.FunctionCode {
+	case 15:
+		if len(r.Data) != (int(r.Quantity)+7)/8 {
+			return fmt.Errorf("%d coils do not fit %d data bytes", r.Quantity, len(r.Data))
+		}
+	case 16, 23:
+		if len(r.Data) != 2*int(r.Quantity) {
+			return fmt.Errorf("%d registers do not fit %d data bytes", r.Quantity, len(r.Data))
+		}
+	}
+	if int(r.Address)+int(r.Quantity) > 65536 {
+		return fmt.Errorf("write of %d items at %d runs past address 65535", r.Quantity, r.Address)
+	}
+	return nil
+}
+
+// NewRegisterWrite builds an FC6 or FC16 request from register bytes.
+// A single register is written with FC6 unless forceMultiple is set.
+func NewRegisterWrite(address uint16, data []byte, forceMultiple bool) WriteRequest {
+	request := WriteRequest{FunctionCode: 16, Address: address, Quantity: uint16(len(data) / 2), Data: data}
+	if len(data) == 2 && !forceMultiple {
+		request.FunctionCode = 6
+	}
+	return request
+}
+
+// NewCoilWrite builds an FC5 or FC15 request from coil states.
+// A single coil is written with FC5 unless forceMultiple is set.
+func NewCoilWrite(address uint16, coils []bool, forceMultiple bool) WriteRequest {
+	request := WriteRequest{FunctionCode: 15, Address: address, Quantity: uint16(len(coils)), Data: PackCoils(coils)}
+	if len(coils) == 1 && !forceMultiple {
+		request.FunctionCode = 5
+	}
+	return request
+}
+
+// Write performs the request and returns the response data.
+// For FC23 this is the content of the registers that were read.
+func Write(client modbus.Client, request WriteRequest) ([]byte, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	switch request.FunctionCode {
+	case 5:
+		if len(request.Data) < 1 {
+			return nil, fmt.Errorf("no coil value to write")
+		}
+		var value uint16
+		if request.Data[0]&1 != 0 {
+			value = 0xFF00
+		}
+		return client.WriteSingleCoil(request.Address, value)
+	case 6:
+		if len(request.Data) < 2 {
+			return nil, fmt.Errorf("no register value to write")
+		}
+		return client.WriteSingleRegister(request.Address, binary.BigEndian.Uint16(request.Data))
+	case 15:
+		return client.WriteMultipleCoils(request.Address, request.Quantity, request.Data)
+	case 16:
+		return client.WriteMultipleRegisters(request.Address, request.Quantity, request.Data)
+	case 22:
+		return client.MaskWriteRegister(request.Address, request.AndMask, request.OrMask)
+	case 23:
+		return client.ReadWriteMultipleRegisters(request.ReadAddress, request.ReadQuantity,
+			request.Address, request.Quantity, request.Data)
+	}
+	return nil, fmt.Errorf("invalid write function code %d", request.FunctionCode)
+}
+
+// PackCoils packs coil states into bytes, least significant bit first
+func PackCoils(coils []bool) []byte {
+	packed := make([]byte, (len(coils)+7)/8)
+	for i, on := range coils {
+		if on {
+			packed[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return packed
+}
+
+// splitValues splits user input on commas and whitespace
+func splitValues(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// ParseCoils reads a list of coil states such as "1, 0, on, off"
+func ParseCoils(text string) ([]bool, error) {
+	var coils []bool
+	for _, field := range splitValues(text) {
+		switch strings.ToLower(field) {
+		case "1", "on", "true":
+			coils = append(coils, true)
+		case "0", "off", "false":
+			coils = append(coils, false)
+		default:
+			return nil, fmt.Errorf("invalid coil value %q", field)
+		}
+	}
+	if len(coils) == 0 {
+		return nil, fmt.Errorf("no coil values given")
+	}
+	return coils, nil
+}
+
+// ParseNumber reads a decimal, hex (0x), binary (0b) or floating point number
+func ParseNumber(text string) (float64, error) {
+	// Only switch base on an explicit prefix so "010" stays decimal
+	base := 10
+	if prefix := strings.ToLower(text); strings.HasPrefix(prefix, "0x") || strings.HasPrefix(prefix, "0b") {
+		base = 0
+	}
+	if n, err := strconv.ParseInt(text, base, 64); err == nil {
+		return float64(n), nil
+	}
+	if n, err := strconv.ParseUint(text, base, 64); err == nil {
+		return float64(n), nil
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+	return n, nil
+}
+
+// EncodeValues converts numbers into register bytes with the given type and byte order
+func EncodeValues(numbers []float64, dataType DataType, order ByteOrder) ([]byte, error) {
+	var data []byte
+	for _, number := range numbers {
+		b, err := EncodeValue(number, dataType, order)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+	}
+	return data, nil
+}
+
+// ParseRegisterValues converts user input into register bytes. Strings are taken
+// as-is, every other type expects a list of numbers.
+func ParseRegisterValues(text string, dataType DataType, order ByteOrder) ([]byte, error) {
+	if dataType == TypeString {
+		if text == "" {
+			return nil, fmt.Errorf("no text given")
+		}
+		return EncodeString(text, order), nil
+	}
+
+	var numbers []float64
+	for _, field := range splitValues(text) {
+		number, err := ParseNumber(field)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("no values given")
+	}
+	return EncodeValues(numbers, dataType, order)
+}
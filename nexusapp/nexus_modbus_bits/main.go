@@ -1,18 +1,25 @@
 package nexus_modbus_bits
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"github.com/goburrow/modbus"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
 )
 
 // Create a struct to hold the Modbus bits editor state
 type ModbusBitsEditor struct {
+	transport    nexus_modbus.TransportKind
+	address      string // host:port of the network transports
 	serialPort   string
 	baudRate     int
 	dataBits     int
@@ -20,35 +27,39 @@ type ModbusBitsEditor struct {
 	stopBits     int
 	slaveId      byte
 	registerAddr uint16
+	timing       nexus_modbus.Timing
 	bitToggles   []*widget.Check
 	readButton   *widget.Button
 	writeButton  *widget.Button
 	statusLabel  *widget.Label // Add a label for status messages
 }
 
-// Initialize Modbus client and set up the editor UI
-func Show(w fyne.Window) fyne.CanvasObject {
-	editor := &ModbusBitsEditor{} // Create an instance of ModbusBitsEditor
+// Initialize Modbus client and set up the editor UI, adding its inputs to settings
+func Show(w fyne.Window, settings *nexus_widgets.Settings) fyne.CanvasObject {
+	editor := &ModbusBitsEditor{transport: nexus_modbus.TransportRTU, timing: nexus_modbus.DefaultTiming()} // Create an instance of ModbusBitsEditor
 
-	// List of COM ports from COM1 to COM20
-	comPorts := make([]string, 20)
-	for i := 1; i <= 20; i++ {
-		comPorts[i-1] = fmt.Sprintf("COM%d", i)
-	}
+	// The editor has always waited 5 s for a response
+	editor.timing.Timeout = 5 * time.Second
 
-	// COM Port selection dropdown
-	portSelect := widget.NewSelect(comPorts, func(s string) {
-		editor.serialPort = s
+	// Serial ports present on the machine, refreshed as adapters are plugged in
+	portSelect := nexus_widgets.NewPortSelect(func(path string) {
+		editor.serialPort = path
 	})
-	portSelect.SetSelected("COM1") // Set default to COM1
+	settings.Add("port", portSelect.Path, portSelect.SetPath)
 
-	baudRateSelect := widget.NewSelect([]string{"1200", "2400", "4800", "9600", "19200", "38400", "57600", "115200"}, func(s string) {
+	baudRates := make([]string, len(nexus_modbus.BaudRates))
+	for i, baudRate := range nexus_modbus.BaudRates {
+		baudRates[i] = strconv.Itoa(baudRate)
+	}
+
+	baudRateSelect := widget.NewSelect(baudRates, func(s string) {
 		baudRate, err := strconv.Atoi(s)
 		if err == nil {
 			editor.baudRate = baudRate
 		}
 	})
 	baudRateSelect.SetSelected("9600") // Set default value
+	settings.Select("baudRate", baudRateSelect)
 
 	dataBitsEntry := widget.NewEntry()
 	dataBitsEntry.SetPlaceHolder("Data Bits (e.g., 8)")
@@ -58,6 +69,7 @@ func Show(w fyne.Window) fyne.CanvasObject {
 			editor.dataBits = dataBits
 		}
 	}
+	settings.Entry("dataBits", dataBitsEntry)
 
 	parityOptions := map[string]string{
 		"None": "N",
@@ -73,6 +85,7 @@ func Show(w fyne.Window) fyne.CanvasObject {
 		editor.parity = parityOptions[s]
 	})
 	paritySelect.SetSelected("Even") // Set default to "Even"
+	settings.Select("parity", paritySelect)
 
 	stopBitsEntry := widget.NewEntry()
 	stopBitsEntry.SetPlaceHolder("Stop Bits (1 or 2)")
@@ -82,6 +95,7 @@ func Show(w fyne.Window) fyne.CanvasObject {
 			editor.stopBits = stopBits
 		}
 	}
+	settings.Entry("stopBits", stopBitsEntry)
 
 	slaveIdEntry := widget.NewEntry()
 	slaveIdEntry.SetPlaceHolder("Slave ID (e.g., 1)")
@@ -91,6 +105,7 @@ func Show(w fyne.Window) fyne.CanvasObject {
 			editor.slaveId = byte(slaveId)
 		}
 	}
+	settings.Entry("slaveId", slaveIdEntry)
 
 	// Create the status label
 	editor.statusLabel = widget.NewLabel("")
@@ -98,6 +113,7 @@ func Show(w fyne.Window) fyne.CanvasObject {
 	// Create UI elements for address input
 	registerAddrInput := widget.NewEntry()
 	registerAddrInput.SetPlaceHolder("Register address (e.g., 100)")
+	settings.Entry("register", registerAddrInput)
 
 	// Create the bit toggle checkboxes (16 bits for a Modbus register)
 	for i := 0; i < 16; i++ {
@@ -121,12 +137,26 @@ func Show(w fyne.Window) fyne.CanvasObject {
 		editor.writeRegister()
 	})
 
-	action_buttons := container.NewGridWithColumns(2,
+	// Create the auto-detect button for the serial settings
+	detectButton := widget.NewButton("Detect Settings", func() {
+		nexus_widgets.ShowSerialDetectDialog(w, editor.serialPort, editor.dataBits, editor.slaveId, func(settings nexus_modbus.SerialSettings) {
+			baudRateSelect.SetSelected(strconv.Itoa(settings.BaudRate))
+			for name, parity := range parityOptions {
+				if parity == settings.Parity {
+					paritySelect.SetSelected(name)
+				}
+			}
+			stopBitsEntry.SetText(strconv.Itoa(settings.StopBits))
+		})
+	})
+
+	action_buttons := container.NewGridWithColumns(3,
 		editor.readButton,
 		editor.writeButton,
+		detectButton,
 	)
 
-	portContainer := container.NewVBox(widget.NewLabel("COM Port"), portSelect)
+	portContainer := container.NewVBox(widget.NewLabel("Serial Port"), portSelect.Select)
 	baudRateContainer := container.NewVBox(widget.NewLabel("Baud Rate"), baudRateSelect)
 	dataBitsContainer := container.NewVBox(widget.NewLabel("Data Bits"), dataBitsEntry)
 	parityContainer := container.NewVBox(widget.NewLabel("Parity"), paritySelect)
@@ -149,7 +179,9 @@ func Show(w fyne.Window) fyne.CanvasObject {
 
 	content := container.NewVBox(
 		widget.NewLabel("Modbus Bits Editor"),
+		nexus_widgets.NewTransportForm(nexus_modbus.Transports, &editor.transport, &editor.address, settings, nil),
 		inputGrid,
+		nexus_widgets.NewTimingForm(&editor.timing, false, settings, nil),
 		action_buttons,
 		bitToggleGrid,
 		layout.NewSpacer(),
@@ -159,35 +191,31 @@ func Show(w fyne.Window) fyne.CanvasObject {
 	return content
 }
 
-// Connect to Modbus device
-func (e *ModbusBitsEditor) connect() (*modbus.RTUClientHandler, error) {
-	handler := modbus.NewRTUClientHandler(e.serialPort)
-	handler.BaudRate = e.baudRate
-	handler.Parity = e.parity
-	handler.DataBits = e.dataBits
-	handler.StopBits = e.stopBits
-	handler.SlaveId = e.slaveId
-
-	if err := handler.Connect(); err != nil {
-		return nil, fmt.Errorf("could not connect to Modbus device: %v", err)
-	}
-	return handler, nil
+// connection returns the shared transport for the selected port or address and line settings
+func (e *ModbusBitsEditor) connection() nexus_modbus.Transport {
+	return nexus_modbus.GetTransport(nexus_modbus.TransportConfig{
+		Kind: e.transport,
+		Serial: nexus_modbus.RTUConfig{
+			Port:     e.serialPort,
+			BaudRate: e.baudRate,
+			DataBits: e.dataBits,
+			Parity:   e.parity,
+			StopBits: e.stopBits,
+		},
+		Address: e.address,
+	})
 }
 
 // Read the selected register, extract bit values, and update the UI checkboxes
 func (e *ModbusBitsEditor) readRegister() {
-	handler, err := e.connect()
-	if err != nil {
-		e.statusLabel.SetText(err.Error())
-		return
-	}
-	defer handler.Close()
-
-	client := modbus.NewClient(handler)
-
-	results, err := client.ReadHoldingRegisters(e.registerAddr, 1)
+	var results []byte
+	err := e.connection().Do(context.Background(), e.slaveId, e.timing, func(handler modbus.ClientHandler) error {
+		var err error
+		results, err = modbus.NewClient(handler).ReadHoldingRegisters(e.registerAddr, 1)
+		return err
+	})
 	if err != nil {
-		e.statusLabel.SetText(fmt.Sprintf("Error: Failed to read register: %v", err))
+		e.statusLabel.SetText("Error: Failed to read register: " + nexus_modbus.Classify(err).Describe())
 		return
 	}
 
@@ -224,19 +252,13 @@ func (e *ModbusBitsEditor) writeRegister() {
 		}
 	}
 
-	handler, err := e.connect()
-	if err != nil {
-		e.statusLabel.SetText(err.Error())
-		return
-	}
-	defer handler.Close()
-
-	client := modbus.NewClient(handler)
-
 	// Write the new value to the register
-	_, err = client.WriteSingleRegister(e.registerAddr, value)
+	err := e.connection().Do(context.Background(), e.slaveId, e.timing, func(handler modbus.ClientHandler) error {
+		_, err := modbus.NewClient(handler).WriteSingleRegister(e.registerAddr, value)
+		return err
+	})
 	if err != nil {
-		e.statusLabel.SetText(fmt.Sprintf("Error: Failed to write to register: %v", err))
+		e.statusLabel.SetText("Error: Failed to write to register: " + nexus_modbus.Classify(err).Describe())
 		return
 	}
 	e.statusLabel.SetText("Write successful!") // Update status after successful write
@@ -0,0 +1,75 @@
+package nexus_ports
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// PortInfo describes a serial port. The USB fields are empty for ports that are not USB adapters.
+type PortInfo struct {
+	Name         string `json:"name"`           // Port name as shown to the user, e.g. ttyUSB0 or COM3
+	Path         string `json:"path"`           // Path to open the port with
+	ByID         string `json:"byId,omitempty"` // Stable /dev/serial/by-id link, Linux only
+	VID          string `json:"vid,omitempty"`  // USB vendor ID as 4 hex digits
+	PID          string `json:"pid,omitempty"`  // USB product ID as 4 hex digits
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+// IsUSB reports whether the port belongs to a USB adapter
+func (p PortInfo) IsUSB() bool {
+	return p.VID != ""
+}
+
+// Description names the port with the adapter details available, e.g.
+// "/dev/ttyUSB0 - FT232R USB UART (FTDI, 0403:6001)"
+func (p PortInfo) Description() string {
+	if !p.IsUSB() {
+		return p.Path
+	}
+	product := p.Product
+	if product == "" {
+		product = "USB serial"
+	}
+	details := fmt.Sprintf("%s:%s", p.VID, p.PID)
+	if p.Manufacturer != "" {
+		details = p.Manufacturer + ", " + details
+	}
+	return fmt.Sprintf("%s - %s (%s)", p.Path, product, details)
+}
+
+// List returns the serial ports of the machine, sorted by path
+func List() ([]PortInfo, error) {
+	ports, err := listPorts()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Path < ports[j].Path })
+	return ports, nil
+}
+
+// Watch calls changed with the port list whenever an adapter is plugged or unplugged,
+// checking every interval. changed is called once with the current list first.
+// Watch returns when stop is closed.
+func Watch(interval time.Duration, stop <-chan struct{}, changed func([]PortInfo)) {
+	var last []PortInfo
+	first := true
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ports, err := List()
+		if err == nil && (first || !reflect.DeepEqual(ports, last)) {
+			changed(ports)
+			last = ports
+			first = false
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
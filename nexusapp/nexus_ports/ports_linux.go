@@ -0,0 +1,104 @@
+package nexus_ports
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sysTTY   = "/sys/class/tty"
+	serialID = "/dev/serial/by-id"
+)
+
+// listPorts lists the ttys in sysfs that belong to a device. Virtual consoles and
+// pseudo terminals have no device. The legacy 8250 ports the kernel registers whether
+// or not the hardware exists are skipped as well, see phantomUART.
+func listPorts() ([]PortInfo, error) {
+	entries, err := ioutil.ReadDir(sysTTY)
+	if err != nil {
+		return nil, err
+	}
+	byID := serialLinks()
+
+	var ports []PortInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		device, err := filepath.EvalSymlinks(filepath.Join(sysTTY, name, "device"))
+		if err != nil {
+			continue
+		}
+		if phantomUART(name) {
+			continue
+		}
+		subsystem := linkName(filepath.Join(device, "subsystem"))
+
+		port := PortInfo{Name: name, Path: "/dev/" + name, ByID: byID[name]}
+		if usb := usbDevice(device, subsystem); usb != "" {
+			port.VID = readAttribute(usb, "idVendor")
+			port.PID = readAttribute(usb, "idProduct")
+			port.Manufacturer = readAttribute(usb, "manufacturer")
+			port.Product = readAttribute(usb, "product")
+			port.SerialNumber = readAttribute(usb, "serial")
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// phantomUART reports whether a tty is a UART the kernel found no hardware for. serial8250
+// registers its legacy ports on the platform bus either way and leaves the missing ones with
+// port type 0 (unknown). SoC UARTs such as ttymxc, ttyAMA or ttyS on dw-apb-uart share the
+// platform bus but have a configured type, USB ports have no type at all.
+func phantomUART(name string) bool {
+	return readAttribute(filepath.Join(sysTTY, name), "type") == "0"
+}
+
+// usbDevice returns the sysfs directory of the USB device a tty belongs to, or ""
+// when the tty is not on USB. USB serial converters such as ttyUSB have the tty device
+// below the USB interface, CDC ACM ports have the interface itself as their device.
+func usbDevice(device, subsystem string) string {
+	switch subsystem {
+	case "usb-serial":
+		return filepath.Dir(filepath.Dir(device))
+	case "usb":
+		return filepath.Dir(device)
+	}
+	return ""
+}
+
+// serialLinks maps tty names to their /dev/serial/by-id links
+func serialLinks() map[string]string {
+	links := make(map[string]string)
+	entries, err := ioutil.ReadDir(serialID)
+	if err != nil {
+		return links
+	}
+	for _, entry := range entries {
+		link := filepath.Join(serialID, entry.Name())
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		links[filepath.Base(target)] = link
+	}
+	return links
+}
+
+// linkName returns the last path element of a symlink's target
+func linkName(link string) string {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+func readAttribute(dir, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,28 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package nexus_ports
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// listPorts lists the callout devices of macOS and the BSDs, which are the ones to open
+// for an outgoing connection
+func listPorts() ([]PortInfo, error) {
+	var ports []PortInfo
+	for _, pattern := range []string{"/dev/cu.*", "/dev/cuaU*", "/dev/cuau*"} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			if strings.HasSuffix(path, ".lock") || strings.HasSuffix(path, ".init") {
+				continue
+			}
+			ports = append(ports, PortInfo{Name: filepath.Base(path), Path: path})
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,27 @@
+package nexus_ports
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// listPorts reads the COM ports from the SERIALCOMM registry key, which lists the ports
+// of the adapters currently present. The key holds no USB details.
+func listPorts() ([]PortInfo, error) {
+	output, err := exec.Command("reg", "query", `HKLM\HARDWARE\DEVICEMAP\SERIALCOMM`).Output()
+	if err != nil {
+		// The key does not exist while no serial port is present
+		return nil, nil
+	}
+
+	var ports []PortInfo
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[len(fields)-2] != "REG_SZ" {
+			continue
+		}
+		name := fields[len(fields)-1]
+		ports = append(ports, PortInfo{Name: name, Path: name})
+	}
+	return ports, nil
+}
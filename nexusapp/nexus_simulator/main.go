@@ -0,0 +1,484 @@
+package nexus_simulator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
+)
+
+// ModbusSimulator serves simulated devices over TCP and a virtual serial port, so the
+// scanners can be tried and tested without hardware
+type ModbusSimulator struct {
+	window    fyne.Window
+	sim       *nexus_modbus.Simulator
+	mu        sync.Mutex         // Guards the fields below, a failing server and the refresh loop run in the background
+	cancel    context.CancelFunc // Stops the servers, nil while stopped
+	listening string             // Where the servers listen, for the status line
+	unitId    byte               // Unit shown in the values table
+	table     string             // Table shown in the values table
+	values    []uint16
+	faults    nexus_modbus.SimFaults
+
+	valuesTable     *widget.Table
+	unitSelect      *widget.Select
+	statusLabel     *widget.Label
+	generatorsLabel *widget.Label
+	startButton     *widget.Button
+	stopButton      *widget.Button
+	settings        *nexus_widgets.Settings // Inputs saved with the workspace
+}
+
+// start configures the units and serves them on the selected interfaces until stop
+func (ms *ModbusSimulator) start(tcp bool, address string, serial bool, unitIds []byte, sizes nexus_modbus.SimSizes) {
+	if !tcp && !serial {
+		ms.statusLabel.SetText("Select TCP, virtual serial or both")
+		return
+	}
+	ms.sim.Configure(unitIds, sizes)
+	ms.updateUnits()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var listening []string
+	if tcp {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			cancel()
+			ms.statusLabel.SetText(fmt.Sprintf("Cannot listen on %s: %v", address, err))
+			return
+		}
+		listening = append(listening, "TCP "+listener.Addr().String())
+		go ms.serve(ctx, func() error { return ms.sim.ServeTCP(ctx, listener) })
+	}
+	if serial {
+		master, path, err := nexus_modbus.OpenPseudoTerminal()
+		if err != nil {
+			cancel()
+			ms.statusLabel.SetText(err.Error())
+			return
+		}
+		listening = append(listening, "RTU "+path)
+		go func() {
+			<-ctx.Done()
+			master.Close()
+		}()
+		go ms.serve(ctx, func() error { return ms.sim.ServeRTU(ctx, master) })
+	}
+	go ms.sim.RunGenerators(ctx, 100*time.Millisecond)
+
+	ms.mu.Lock()
+	ms.cancel = cancel
+	ms.listening = strings.Join(listening, " and ")
+	ms.mu.Unlock()
+	ms.startButton.Disable()
+	ms.stopButton.Enable()
+	ms.updateStatus()
+}
+
+// serve runs a server and stops the simulator when it fails
+func (ms *ModbusSimulator) serve(ctx context.Context, server func() error) {
+	if err := server(); err != nil && ctx.Err() == nil {
+		ms.halt()
+		ms.statusLabel.SetText(fmt.Sprintf("Server failed: %v", err))
+	}
+}
+
+func (ms *ModbusSimulator) stop() {
+	ms.halt()
+	ms.statusLabel.SetText("Stopped")
+}
+
+// halt stops the servers and lets the simulator be started again
+func (ms *ModbusSimulator) halt() {
+	ms.mu.Lock()
+	if ms.cancel != nil {
+		ms.cancel()
+		ms.cancel = nil
+	}
+	ms.mu.Unlock()
+	ms.startButton.Enable()
+	ms.stopButton.Disable()
+}
+
+func (ms *ModbusSimulator) updateStatus() {
+	ms.mu.Lock()
+	running, listening := ms.cancel != nil, ms.listening
+	ms.mu.Unlock()
+	if !running {
+		return
+	}
+	ms.statusLabel.SetText(fmt.Sprintf("Serving %s, %d request(s)", listening, ms.sim.Requests()))
+}
+
+// updateUnits offers the configured units, keeping the shown unit while it exists
+func (ms *ModbusSimulator) updateUnits() {
+	var options []string
+	selected := ""
+	shown, _ := ms.shown()
+	for _, unitId := range ms.sim.UnitIds() {
+		option := strconv.Itoa(int(unitId))
+		options = append(options, option)
+		if unitId == shown || selected == "" {
+			selected = option
+		}
+	}
+	ms.unitSelect.Options = options
+	ms.unitSelect.SetSelected(selected)
+}
+
+// shown returns the unit and table shown in the values table
+func (ms *ModbusSimulator) shown() (byte, string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.unitId, ms.table
+}
+
+// show selects the unit and table shown in the values table
+func (ms *ModbusSimulator) show(unitId byte, table string) {
+	ms.mu.Lock()
+	ms.unitId, ms.table = unitId, table
+	ms.mu.Unlock()
+	ms.update()
+}
+
+// value returns the shown value at address, false when the table has fewer values
+func (ms *ModbusSimulator) value(address int) (uint16, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if address < 0 || address >= len(ms.values) {
+		return 0, false
+	}
+	return ms.values[address], true
+}
+
+// update reloads the shown values
+func (ms *ModbusSimulator) update() {
+	unitId, table := ms.shown()
+	values := ms.sim.Values(unitId, table)
+	ms.mu.Lock()
+	if unitId == ms.unitId && table == ms.table {
+		// Else another unit or table was selected while reading, its update shows it
+		ms.values = values
+	}
+	ms.mu.Unlock()
+	ms.valuesTable.Refresh()
+	ms.updateStatus()
+}
+
+// edit asks for a new value of an address of the shown table
+func (ms *ModbusSimulator) edit(address int) {
+	unitId, table := ms.shown()
+	entry := widget.NewEntry()
+	if value, ok := ms.value(address); ok {
+		entry.SetText(strconv.Itoa(int(value)))
+	}
+	items := []*widget.FormItem{widget.NewFormItem("Value", entry)}
+	title := fmt.Sprintf("Unit %d %s %d", unitId, table, address)
+	dialog.ShowForm(title, "Set", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		value, err := nexus_modbus.ParseNumber(strings.TrimSpace(entry.Text))
+		if err == nil && (value < 0 || value > 65535 || value != float64(int(value))) {
+			err = fmt.Errorf("%g is not a register value (0-65535)", value)
+		}
+		if err == nil {
+			err = ms.sim.SetValue(unitId, table, address, uint16(value))
+		}
+		if err != nil {
+			dialog.ShowError(err, ms.window)
+			return
+		}
+		ms.update()
+	}, ms.window)
+}
+
+// numberEntry creates an entry that calls set with each valid, non-negative number typed
+func numberEntry(text string, set func(value float64)) *widget.Entry {
+	entry := widget.NewEntry()
+	entry.SetText(text)
+	entry.OnChanged = func(s string) {
+		if value, err := nexus_modbus.ParseNumber(strings.TrimSpace(s)); err == nil && value >= 0 {
+			set(value)
+		}
+	}
+	return entry
+}
+
+// labeled puts a label above an input
+func labeled(label string, object fyne.CanvasObject) fyne.CanvasObject {
+	return container.NewVBox(widget.NewLabel(label), object)
+}
+
+func (ms *ModbusSimulator) createServerForm() fyne.CanvasObject {
+	tcpCheck := widget.NewCheck("Modbus TCP", nil)
+	tcpCheck.SetChecked(true)
+	addressEntry := widget.NewEntry()
+	addressEntry.SetText("127.0.0.1:5020")
+	serialCheck := widget.NewCheck("Virtual serial port (RTU)", nil)
+
+	unitsEntry := widget.NewEntry()
+	unitsEntry.SetText("1")
+	unitsEntry.SetPlaceHolder("e.g. 1, 2, 10-12")
+	sizes := nexus_modbus.SimSizes{Coils: 100, DiscreteInputs: 100, HoldingRegisters: 100, InputRegisters: 100}
+	sizeEntry := func(size *int) *widget.Entry {
+		return numberEntry(strconv.Itoa(*size), func(value float64) {
+			*size = int(value)
+		})
+	}
+	coilsEntry := sizeEntry(&sizes.Coils)
+	discreteInputsEntry := sizeEntry(&sizes.DiscreteInputs)
+	holdingRegistersEntry := sizeEntry(&sizes.HoldingRegisters)
+	inputRegistersEntry := sizeEntry(&sizes.InputRegisters)
+	ms.settings.Check("tcp", tcpCheck)
+	ms.settings.Entry("address", addressEntry)
+	ms.settings.Check("serial", serialCheck)
+	ms.settings.Entry("unitIds", unitsEntry)
+	ms.settings.Entry("coils", coilsEntry)
+	ms.settings.Entry("discreteInputs", discreteInputsEntry)
+	ms.settings.Entry("holdingRegisters", holdingRegistersEntry)
+	ms.settings.Entry("inputRegisters", inputRegistersEntry)
+
+	ms.statusLabel = widget.NewLabel("Stopped")
+	ms.startButton = widget.NewButtonWithIcon("Start", theme.MediaPlayIcon(), func() {
+		unitIds, err := nexus_modbus.ParseUnitIds(unitsEntry.Text)
+		if err != nil {
+			ms.statusLabel.SetText(err.Error())
+			return
+		}
+		for _, table := range nexus_modbus.SimTables {
+			if size := sizes.Size(table); size < 1 || size > 65536 {
+				ms.statusLabel.SetText(fmt.Sprintf("%s size must be 1 to 65536", table))
+				return
+			}
+		}
+		ms.start(tcpCheck.Checked, strings.TrimSpace(addressEntry.Text), serialCheck.Checked, unitIds, sizes)
+	})
+	ms.stopButton = widget.NewButtonWithIcon("Stop", theme.MediaStopIcon(), func() {
+		ms.stop()
+	})
+	ms.stopButton.Disable()
+
+	return container.NewVBox(
+		container.NewGridWithColumns(3,
+			tcpCheck,
+			labeled("Host:Port", addressEntry),
+			serialCheck,
+		),
+		container.NewGridWithColumns(5,
+			labeled("Unit IDs", unitsEntry),
+			labeled("Coils", coilsEntry),
+			labeled("Discrete Inputs", discreteInputsEntry),
+			labeled("Holding Registers", holdingRegistersEntry),
+			labeled("Input Registers", inputRegistersEntry),
+		),
+		container.NewHBox(ms.startButton, ms.stopButton, ms.statusLabel),
+	)
+}
+
+func (ms *ModbusSimulator) createGeneratorForm() fyne.CanvasObject {
+	generator := nexus_modbus.SimGenerator{
+		Table:  nexus_modbus.TableHoldingRegisters,
+		Kind:   nexus_modbus.GeneratorSine,
+		Max:    1000,
+		Period: 10 * time.Second,
+	}
+	tableSelect := widget.NewSelect([]string{nexus_modbus.TableHoldingRegisters, nexus_modbus.TableInputRegisters}, func(s string) {
+		generator.Table = s
+	})
+	tableSelect.SetSelected(generator.Table)
+
+	kinds := make([]string, len(nexus_modbus.GeneratorKinds))
+	for i, kind := range nexus_modbus.GeneratorKinds {
+		kinds[i] = string(kind)
+	}
+	kindSelect := widget.NewSelect(kinds, func(s string) {
+		generator.Kind = nexus_modbus.GeneratorKind(s)
+	})
+	kindSelect.SetSelected(string(generator.Kind))
+
+	addressEntry := numberEntry("0", func(value float64) { generator.Address = int(value) })
+	minEntry := numberEntry("0", func(value float64) { generator.Min = value })
+	maxEntry := numberEntry("1000", func(value float64) { generator.Max = value })
+	periodEntry := numberEntry("10000", func(value float64) {
+		generator.Period = time.Duration(value) * time.Millisecond
+	})
+
+	ms.generatorsLabel = widget.NewLabel("No generators")
+	showGenerators := func() {
+		var lines []string
+		for _, g := range ms.sim.Generators() {
+			lines = append(lines, g.String())
+		}
+		if len(lines) == 0 {
+			lines = []string{"No generators"}
+		}
+		ms.generatorsLabel.SetText(strings.Join(lines, "\n"))
+	}
+	addButton := widget.NewButtonWithIcon("Add", theme.ContentAddIcon(), func() {
+		generator.UnitId, _ = ms.shown()
+		if err := ms.sim.AddGenerator(generator); err != nil {
+			dialog.ShowError(err, ms.window)
+			return
+		}
+		showGenerators()
+	})
+	clearButton := widget.NewButtonWithIcon("Clear", theme.DeleteIcon(), func() {
+		ms.sim.ClearGenerators()
+		showGenerators()
+	})
+
+	return container.NewVBox(
+		widget.NewLabel("Generators (on the unit shown)"),
+		container.NewGridWithColumns(6,
+			labeled("Table", tableSelect),
+			labeled("Address", addressEntry),
+			labeled("Kind", kindSelect),
+			labeled("Min", minEntry),
+			labeled("Max", maxEntry),
+			labeled("Period (ms)", periodEntry),
+		),
+		container.NewHBox(addButton, clearButton),
+		ms.generatorsLabel,
+	)
+}
+
+func (ms *ModbusSimulator) createFaultForm() fyne.CanvasObject {
+	percentEntry := func(rate *float64) *widget.Entry {
+		return numberEntry("0", func(value float64) {
+			*rate = value / 100
+			ms.sim.SetFaults(ms.faults)
+		})
+	}
+	delayEntry := numberEntry("0", func(value float64) {
+		ms.faults.Delay = time.Duration(value) * time.Millisecond
+		ms.sim.SetFaults(ms.faults)
+	})
+	codeEntry := numberEntry("4", func(value float64) {
+		ms.faults.ExceptionCode = byte(value)
+		ms.sim.SetFaults(ms.faults)
+	})
+
+	exceptionEntry := percentEntry(&ms.faults.ExceptionRate)
+	dropEntry := percentEntry(&ms.faults.DropRate)
+	badCRCEntry := percentEntry(&ms.faults.BadCRCRate)
+	ms.settings.Entry("faultDelay", delayEntry)
+	ms.settings.Entry("faultExceptions", exceptionEntry)
+	ms.settings.Entry("faultExceptionCode", codeEntry)
+	ms.settings.Entry("faultDropped", dropEntry)
+	ms.settings.Entry("faultBadCRC", badCRCEntry)
+
+	return container.NewVBox(
+		widget.NewLabel("Faults"),
+		container.NewGridWithColumns(5,
+			labeled("Delay (ms)", delayEntry),
+			labeled("Exceptions (%)", exceptionEntry),
+			labeled("Exception Code", codeEntry),
+			labeled("Dropped (%)", dropEntry),
+			labeled("Bad CRC (%)", badCRCEntry),
+		),
+	)
+}
+
+func (ms *ModbusSimulator) createUI() fyne.CanvasObject {
+	headers := []string{"Address", "Value", "Hex"}
+	ms.valuesTable = widget.NewTable(
+		func() (int, int) {
+			ms.mu.Lock()
+			defer ms.mu.Unlock()
+			return len(ms.values) + 1, len(headers)
+		},
+		func() fyne.CanvasObject { return widget.NewLabel("00000") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+			label.TextStyle = fyne.TextStyle{}
+			value, ok := ms.value(id.Row - 1)
+			if !ok {
+				// The table shrank since its length was read
+				label.SetText("")
+				return
+			}
+			switch id.Col {
+			case 0:
+				label.SetText(strconv.Itoa(id.Row - 1))
+			case 1:
+				label.SetText(strconv.Itoa(int(value)))
+			case 2:
+				label.SetText(fmt.Sprintf("0x%04X", value))
+			}
+		},
+	)
+	ms.valuesTable.SetColumnWidth(0, 80)
+	ms.valuesTable.SetColumnWidth(1, 100)
+	ms.valuesTable.SetColumnWidth(2, 100)
+	ms.valuesTable.OnSelected = func(id widget.TableCellID) {
+		ms.valuesTable.UnselectAll()
+		if id.Row > 0 {
+			ms.edit(id.Row - 1)
+		}
+	}
+
+	ms.unitSelect = widget.NewSelect(nil, func(s string) {
+		if unitId, err := strconv.Atoi(s); err == nil {
+			_, table := ms.shown()
+			ms.show(byte(unitId), table)
+		}
+	})
+	tableSelect := widget.NewSelect(nexus_modbus.SimTables, func(s string) {
+		unitId, _ := ms.shown()
+		ms.show(unitId, s)
+	})
+	tableSelect.SetSelected(nexus_modbus.TableHoldingRegisters)
+
+	controls := container.NewVBox(
+		widget.NewLabel("Modbus Slave Simulator"),
+		ms.createServerForm(),
+		widget.NewSeparator(),
+		ms.createGeneratorForm(),
+		widget.NewSeparator(),
+		ms.createFaultForm(),
+		widget.NewSeparator(),
+		container.NewGridWithColumns(2,
+			labeled("Unit", ms.unitSelect),
+			labeled("Table (select a value to edit it)", tableSelect),
+		),
+	)
+	ms.updateUnits()
+
+	go nexus_widgets.RefreshEvery(500*time.Millisecond, nil, ms.update)
+
+	return container.NewBorder(controls, nil, nil, nil, ms.valuesTable)
+}
+
+// Show initializes the ModbusSimulator and loads its UI into the given window.
+// Its server and fault settings are added to settings.
+func Show(win fyne.Window, settings *nexus_widgets.Settings) fyne.CanvasObject {
+	simulator := &ModbusSimulator{
+		window:   win,
+		settings: settings,
+		sim: nexus_modbus.NewSimulator([]byte{1}, nexus_modbus.SimSizes{
+			Coils: 100, DiscreteInputs: 100, HoldingRegisters: 100, InputRegisters: 100,
+		}),
+		unitId: 1,
+		table:  nexus_modbus.TableHoldingRegisters,
+		faults: nexus_modbus.SimFaults{ExceptionCode: 0x04},
+	}
+	return simulator.createUI()
+}
@@ -0,0 +1,301 @@
+package nexus_sniffer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
+)
+
+// BusSniffer listens to an RS-485 bus without transmitting and shows what its master does
+type BusSniffer struct {
+	config  nexus_modbus.RTUConfig
+	sniffer *nexus_modbus.Sniffer
+
+	mu           sync.Mutex         // Guards the fields below, the listener and the refresh loop run in the background
+	cancel       context.CancelFunc // Stops listening, nil while stopped
+	transactions []nexus_modbus.Transaction
+	registers    []nexus_modbus.BusRegister
+	version      uint64
+
+	statusText binding.String
+	listening  binding.Bool // Enables Listen or Stop, set when the listener starts and ends
+
+	transactionsTable *widget.Table
+	registersTable    *widget.Table
+	startButton       *widget.Button
+	stopButton        *widget.Button
+}
+
+// start listens on the configured port until stop
+func (bs *BusSniffer) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	bs.mu.Lock()
+	if bs.cancel != nil {
+		// Still listening
+		bs.mu.Unlock()
+		cancel()
+		return
+	}
+	bs.cancel = cancel
+	bs.mu.Unlock()
+	bs.listening.Set(true)
+	bs.statusText.Set(fmt.Sprintf("Listening on %s at %d baud", bs.config.Port, bs.config.BaudRate))
+
+	go func(config nexus_modbus.RTUConfig) {
+		err := bs.sniffer.Listen(ctx, config)
+		cancel()
+		bs.mu.Lock()
+		bs.cancel = nil
+		bs.mu.Unlock()
+
+		// The bindings update the label and buttons, not this goroutine
+		if err != nil {
+			bs.statusText.Set(nexus_modbus.Classify(err).Describe())
+		} else {
+			bs.statusText.Set("Stopped")
+		}
+		bs.listening.Set(false)
+	}(bs.config)
+}
+
+func (bs *BusSniffer) stop() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.cancel != nil {
+		bs.cancel()
+	}
+}
+
+// update reloads the tables when new traffic arrived. force reloads anyway.
+func (bs *BusSniffer) update(force bool) {
+	transactions, version := bs.sniffer.Transactions()
+	registers := bs.sniffer.Registers()
+	bs.mu.Lock()
+	if version == bs.version && !force {
+		bs.mu.Unlock()
+		return
+	}
+	bs.version = version
+	bs.transactions = transactions
+	bs.registers = registers
+	bs.mu.Unlock()
+
+	bs.transactionsTable.Refresh()
+	if len(transactions) > 0 {
+		bs.transactionsTable.ScrollToBottom()
+	}
+	bs.registersTable.Refresh()
+}
+
+// transaction returns a shown transaction, false when the row is gone since the table asked for its length
+func (bs *BusSniffer) transaction(row int) (nexus_modbus.Transaction, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if row < 0 || row >= len(bs.transactions) {
+		return nexus_modbus.Transaction{}, false
+	}
+	return bs.transactions[row], true
+}
+
+// register returns a shown register, false when the row is gone since the table asked for its length
+func (bs *BusSniffer) register(row int) (nexus_modbus.BusRegister, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if row < 0 || row >= len(bs.registers) {
+		return nexus_modbus.BusRegister{}, false
+	}
+	return bs.registers[row], true
+}
+
+// newTable creates a table with a bold header row, cell fills the other rows
+func newTable(headers []string, widths []float32, rows func() int, cell func(row, col int) string) *widget.Table {
+	table := widget.NewTable(
+		func() (int, int) { return rows() + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("00:00:00.000") },
+		func(id widget.TableCellID, object fyne.CanvasObject) {
+			label := object.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+			label.TextStyle = fyne.TextStyle{}
+			label.SetText(cell(id.Row-1, id.Col))
+		},
+	)
+	for i, width := range widths {
+		table.SetColumnWidth(i, width)
+	}
+	return table
+}
+
+func (bs *BusSniffer) createUI(settings *nexus_widgets.Settings) fyne.CanvasObject {
+	portSelect := nexus_widgets.NewPortSelect(func(path string) {
+		bs.config.Port = path
+	})
+	settings.Add("port", portSelect.Path, portSelect.SetPath)
+
+	baudRates := make([]string, len(nexus_modbus.BaudRates))
+	for i, baudRate := range nexus_modbus.BaudRates {
+		baudRates[i] = strconv.Itoa(baudRate)
+	}
+	baudRateSelect := widget.NewSelect(baudRates, func(s string) {
+		if baudRate, err := strconv.Atoi(s); err == nil {
+			bs.config.BaudRate = baudRate
+		}
+	})
+	baudRateSelect.SetSelected("9600")
+	settings.Select("baudRate", baudRateSelect)
+
+	dataBitsEntry := widget.NewEntry()
+	dataBitsEntry.SetText("8")
+	dataBitsEntry.OnChanged = func(s string) {
+		if dataBits, err := strconv.Atoi(s); err == nil {
+			bs.config.DataBits = dataBits
+		}
+	}
+	settings.Entry("dataBits", dataBitsEntry)
+
+	parityOptions := map[string]string{"None": "N", "Even": "E", "Odd": "O"}
+	paritySelect := widget.NewSelect([]string{"None", "Even", "Odd"}, func(s string) {
+		bs.config.Parity = parityOptions[s]
+	})
+	paritySelect.SetSelected("Even")
+	settings.Select("parity", paritySelect)
+
+	stopBitsEntry := widget.NewEntry()
+	stopBitsEntry.SetText("1")
+	stopBitsEntry.OnChanged = func(s string) {
+		if stopBits, err := strconv.Atoi(s); err == nil {
+			bs.config.StopBits = stopBits
+		}
+	}
+	settings.Entry("stopBits", stopBitsEntry)
+
+	bs.transactionsTable = newTable(
+		[]string{"Time", "Transaction", "Latency"},
+		[]float32{110, 640, 90},
+		func() int {
+			bs.mu.Lock()
+			defer bs.mu.Unlock()
+			return len(bs.transactions)
+		},
+		func(row, col int) string {
+			transaction, ok := bs.transaction(row)
+			if !ok {
+				return ""
+			}
+			switch col {
+			case 0:
+				return transaction.Request.Time.Format("15:04:05.000")
+			case 1:
+				return transaction.Summary()
+			}
+			if transaction.Response == nil {
+				return ""
+			}
+			return fmt.Sprintf("%.1f ms", float64(transaction.Latency)/float64(time.Millisecond))
+		},
+	)
+
+	bs.registersTable = newTable(
+		[]string{"Slave", "Table", "Address", "Reads", "Writes", "Last value", "Updated"},
+		[]float32{60, 140, 80, 70, 70, 160, 110},
+		func() int {
+			bs.mu.Lock()
+			defer bs.mu.Unlock()
+			return len(bs.registers)
+		},
+		func(row, col int) string {
+			register, ok := bs.register(row)
+			if !ok {
+				return ""
+			}
+			switch col {
+			case 0:
+				return strconv.Itoa(int(register.SlaveId))
+			case 1:
+				return register.Table
+			case 2:
+				return strconv.Itoa(register.Address)
+			case 3:
+				return strconv.Itoa(register.Reads)
+			case 4:
+				return strconv.Itoa(register.Writes)
+			case 5:
+				return register.Value
+			}
+			if register.Updated.IsZero() {
+				return ""
+			}
+			return register.Updated.Format("15:04:05.000")
+		},
+	)
+
+	bs.statusText = binding.NewString()
+	bs.statusText.Set("Stopped")
+	statusLabel := widget.NewLabelWithData(bs.statusText)
+	bs.startButton = widget.NewButtonWithIcon("Listen", theme.MediaPlayIcon(), func() {
+		bs.start()
+	})
+	bs.stopButton = widget.NewButtonWithIcon("Stop", theme.MediaStopIcon(), func() {
+		bs.stop()
+	})
+	bs.stopButton.Disable()
+	bs.listening = binding.NewBool()
+	bs.listening.AddListener(binding.NewDataListener(func() {
+		if listening, _ := bs.listening.Get(); listening {
+			bs.startButton.Disable()
+			bs.stopButton.Enable()
+		} else {
+			bs.startButton.Enable()
+			bs.stopButton.Disable()
+		}
+	}))
+	resetButton := widget.NewButtonWithIcon("Reset", theme.DeleteIcon(), func() {
+		bs.sniffer.Reset()
+		bs.update(true)
+	})
+
+	lineSettings := container.NewGridWithColumns(5,
+		container.NewVBox(widget.NewLabel("Serial Port"), portSelect.Select),
+		container.NewVBox(widget.NewLabel("Baud Rate"), baudRateSelect),
+		container.NewVBox(widget.NewLabel("Data Bits"), dataBitsEntry),
+		container.NewVBox(widget.NewLabel("Parity"), paritySelect),
+		container.NewVBox(widget.NewLabel("Stop Bits"), stopBitsEntry),
+	)
+	controls := container.NewVBox(
+		widget.NewLabel("Bus Sniffer (listen only, never transmits)"),
+		lineSettings,
+		container.NewHBox(bs.startButton, bs.stopButton, resetButton, statusLabel),
+	)
+
+	go nexus_widgets.RefreshEvery(500*time.Millisecond, nil, func() { bs.update(false) })
+
+	tables := container.NewVSplit(
+		container.NewBorder(widget.NewLabel("Transactions"), nil, nil, nil, bs.transactionsTable),
+		container.NewBorder(widget.NewLabel("Registers accessed by the master"), nil, nil, nil, bs.registersTable),
+	)
+	return container.NewBorder(controls, nil, nil, nil, tables)
+}
+
+// Show initializes the BusSniffer and loads its UI into the given window.
+// Its line settings are added to settings.
+func Show(win fyne.Window, settings *nexus_widgets.Settings) fyne.CanvasObject {
+	sniffer := &BusSniffer{
+		config:  nexus_modbus.RTUConfig{BaudRate: 9600, DataBits: 8, Parity: "E", StopBits: 1},
+		sniffer: nexus_modbus.NewSniffer(),
+	}
+	return sniffer.createUI(settings)
+}
@@ -0,0 +1,229 @@
+package nexus_traffic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
+)
+
+// TrafficConsole shows the frames captured by nexus_modbus.Traffic
+type TrafficConsole struct {
+	window fyne.Window
+
+	mu          sync.Mutex           // Guards the fields below, the refresh loop reloads the frames
+	frames      []nexus_modbus.Frame // Frames passing the filter, as shown
+	version     uint64
+	slaveFilter int // -1 shows all slaves
+	fcFilter    int // -1 shows all function codes
+	paused      bool
+
+	framesTable *widget.Table
+	statusLabel *widget.Label
+}
+
+// matches reports whether a frame passes the slave and function code filters, the caller holds the lock
+func (tc *TrafficConsole) matches(frame nexus_modbus.Frame) bool {
+	if tc.slaveFilter < 0 && tc.fcFilter < 0 {
+		return true
+	}
+	info, ok := frame.Decode()
+	if !ok {
+		return false
+	}
+	if tc.slaveFilter >= 0 && int(info.SlaveId) != tc.slaveFilter {
+		return false
+	}
+	return tc.fcFilter < 0 || int(info.FunctionCode) == tc.fcFilter
+}
+
+// update reloads the shown frames, unless paused. force reloads even without new frames.
+func (tc *TrafficConsole) update(force bool) {
+	tc.mu.Lock()
+	if tc.paused && !force {
+		tc.mu.Unlock()
+		return
+	}
+	frames, version := nexus_modbus.Traffic.Frames()
+	if version == tc.version && !force {
+		tc.mu.Unlock()
+		return
+	}
+	tc.version = version
+
+	var shown []nexus_modbus.Frame
+	for _, frame := range frames {
+		if tc.matches(frame) {
+			shown = append(shown, frame)
+		}
+	}
+	tc.frames = shown
+	tc.mu.Unlock()
+
+	tc.framesTable.Refresh()
+	if len(shown) > 0 {
+		tc.framesTable.ScrollToBottom()
+	}
+	tc.statusLabel.SetText(fmt.Sprintf("%d of %d frame(s)", len(shown), len(frames)))
+}
+
+// frame returns a shown frame, false when the row is gone since the table asked for its length
+func (tc *TrafficConsole) frame(row int) (nexus_modbus.Frame, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if row < 0 || row >= len(tc.frames) {
+		return nexus_modbus.Frame{}, false
+	}
+	return tc.frames[row], true
+}
+
+// text formats the shown frames as one line each, for copying and saving
+func (tc *TrafficConsole) text() string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	var lines []string
+	for _, frame := range tc.frames {
+		lines = append(lines, fmt.Sprintf("%s %s %s %s  %s  [%s]", frame.Time.Format("15:04:05.000"),
+			frame.Direction, frame.Transport, frame.Source, frame.Hex(), frame.Summary()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseFilter reads a filter entry, an empty or invalid entry shows everything
+func parseFilter(s string) int {
+	value, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || value < 0 {
+		return -1
+	}
+	return value
+}
+
+func (tc *TrafficConsole) createUI(settings *nexus_widgets.Settings) fyne.CanvasObject {
+	headers := []string{"Time", "Dir", "Source", "Frame", "Decoded"}
+	tc.framesTable = widget.NewTable(
+		func() (int, int) {
+			tc.mu.Lock()
+			defer tc.mu.Unlock()
+			return len(tc.frames) + 1, len(headers)
+		},
+		func() fyne.CanvasObject { return widget.NewLabel("00:00:00.000") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+			label.TextStyle = fyne.TextStyle{Monospace: id.Col == 3}
+			frame, ok := tc.frame(id.Row - 1)
+			if !ok {
+				label.SetText("")
+				return
+			}
+			switch id.Col {
+			case 0:
+				label.SetText(frame.Time.Format("15:04:05.000"))
+			case 1:
+				label.SetText(string(frame.Direction))
+			case 2:
+				label.SetText(frame.Transport + " " + frame.Source)
+			case 3:
+				label.SetText(frame.Hex())
+			case 4:
+				label.SetText(frame.Summary())
+			}
+		},
+	)
+	tc.framesTable.SetColumnWidth(0, 110)
+	tc.framesTable.SetColumnWidth(1, 40)
+	tc.framesTable.SetColumnWidth(2, 170)
+	tc.framesTable.SetColumnWidth(3, 420)
+	tc.framesTable.SetColumnWidth(4, 360)
+
+	tc.statusLabel = widget.NewLabel("")
+
+	slaveEntry := widget.NewEntry()
+	slaveEntry.SetPlaceHolder("Slave ID (all)")
+	slaveEntry.OnChanged = func(s string) {
+		tc.mu.Lock()
+		tc.slaveFilter = parseFilter(s)
+		tc.mu.Unlock()
+		tc.update(true)
+	}
+
+	fcEntry := widget.NewEntry()
+	fcEntry.SetPlaceHolder("Function code (all)")
+	fcEntry.OnChanged = func(s string) {
+		tc.mu.Lock()
+		tc.fcFilter = parseFilter(s)
+		tc.mu.Unlock()
+		tc.update(true)
+	}
+	settings.Entry("slaveFilter", slaveEntry)
+	settings.Entry("functionCodeFilter", fcEntry)
+
+	var pauseButton *widget.Button
+	pauseButton = widget.NewButtonWithIcon("Pause", theme.MediaPauseIcon(), func() {
+		tc.mu.Lock()
+		tc.paused = !tc.paused
+		paused := tc.paused
+		tc.mu.Unlock()
+		if paused {
+			pauseButton.SetText("Resume")
+			pauseButton.SetIcon(theme.MediaPlayIcon())
+		} else {
+			pauseButton.SetText("Pause")
+			pauseButton.SetIcon(theme.MediaPauseIcon())
+			tc.update(true)
+		}
+	})
+
+	clearButton := widget.NewButtonWithIcon("Clear", theme.DeleteIcon(), func() {
+		nexus_modbus.Traffic.Clear()
+		tc.update(true)
+	})
+
+	copyButton := widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
+		tc.window.Clipboard().SetContent(tc.text())
+	})
+
+	saveButton := widget.NewButtonWithIcon("Save", theme.DocumentSaveIcon(), func() {
+		text := tc.text()
+		nexus_widgets.SaveToFile(tc.window, "modbus_traffic.txt", "traffic log", func(w io.Writer) error {
+			_, err := io.WriteString(w, text+"\n")
+			return err
+		})
+	})
+
+	filters := container.NewGridWithColumns(2,
+		container.NewVBox(widget.NewLabel("Slave ID"), slaveEntry),
+		container.NewVBox(widget.NewLabel("Function Code"), fcEntry),
+	)
+	controls := container.NewVBox(
+		widget.NewLabel("Traffic Monitor"),
+		filters,
+		container.NewHBox(pauseButton, clearButton, copyButton, saveButton, tc.statusLabel),
+	)
+
+	go nexus_widgets.RefreshEvery(500*time.Millisecond, nil, func() { tc.update(false) })
+
+	return container.NewBorder(controls, nil, nil, nil, tc.framesTable)
+}
+
+// Show initializes the TrafficConsole and loads its UI into the given window.
+// Its filters are added to settings.
+func Show(win fyne.Window, settings *nexus_widgets.Settings) fyne.CanvasObject {
+	console := &TrafficConsole{window: win, slaveFilter: -1, fcFilter: -1}
+	return console.createUI(settings)
+}
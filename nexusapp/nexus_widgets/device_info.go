@@ -0,0 +1,65 @@
+package nexus_widgets
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// ShowDeviceInfoDialog runs read in the background and shows the device identification objects it returns
+func ShowDeviceInfoDialog(win fyne.Window, title string, read func() (*nexus_modbus.DeviceIdentification, error)) {
+	statusLabel := widget.NewLabel("Reading device identification...")
+	progress := widget.NewProgressBarInfinite()
+
+	var objects []nexus_modbus.DeviceObject
+
+	headers := []string{"ID", "Object", "Value"}
+	objectsTable := widget.NewTable(
+		func() (int, int) { return len(objects) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("MajorMinorRevision") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+			label.TextStyle = fyne.TextStyle{}
+			object := objects[id.Row-1]
+			switch id.Col {
+			case 0:
+				label.SetText(fmt.Sprintf("0x%02X", object.Id))
+			case 1:
+				label.SetText(object.Name)
+			case 2:
+				label.SetText(object.Value)
+			}
+		},
+	)
+	objectsTable.SetColumnWidth(0, 60)
+	objectsTable.SetColumnWidth(1, 180)
+	objectsTable.SetColumnWidth(2, 300)
+
+	infoDialog := dialog.NewCustom(title, "Close",
+		container.NewBorder(container.NewVBox(progress, statusLabel), nil, nil, nil, objectsTable), win)
+	infoDialog.Resize(fyne.NewSize(600, 420))
+	infoDialog.Show()
+
+	go func() {
+		identification, err := read()
+		progress.Stop()
+		progress.Hide()
+		if err != nil {
+			statusLabel.SetText("Device identification failed: " + nexus_modbus.Classify(err).Describe())
+			return
+		}
+		objects = identification.Objects
+		objectsTable.Refresh()
+		statusLabel.SetText(fmt.Sprintf("Conformity level 0x%02X, %d object(s)", identification.ConformityLevel, len(objects)))
+	}()
+}
@@ -0,0 +1,99 @@
+package nexus_widgets
+
+import (
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_ports"
+)
+
+// portRefresh is how often the port selects look for plugged or unplugged adapters
+const portRefresh = 2 * time.Second
+
+// PortSelect is a select of the serial ports present, kept up to date as adapters come and go
+type PortSelect struct {
+	Select *widget.Select
+
+	mu     sync.Mutex
+	paths  map[string]string // By option text, replaced by the watcher
+	wanted string            // Path to select once its adapter is plugged in
+}
+
+// NewPortSelect creates a select of the serial ports present. Options show the adapter details,
+// selected is called with the path to open. The first port is selected initially, and again
+// when the selected port disappears.
+func NewPortSelect(selected func(path string)) *PortSelect {
+	ps := &PortSelect{paths: make(map[string]string)}
+	ps.Select = widget.NewSelect(nil, func(option string) {
+		ps.mu.Lock()
+		path := ps.paths[option]
+		ps.mu.Unlock()
+		selected(path)
+	})
+	ps.Select.PlaceHolder = "No serial ports found"
+
+	go nexus_ports.Watch(portRefresh, nil, func(ports []nexus_ports.PortInfo) {
+		options := make([]string, len(ports))
+		ps.mu.Lock()
+		current := ps.paths[ps.Select.Selected]
+		ps.paths = make(map[string]string, len(ports))
+		keep, wanted := "", ""
+		for i, port := range ports {
+			options[i] = port.Description()
+			ps.paths[options[i]] = port.Path
+			if port.Path == current {
+				keep = options[i]
+			}
+			if port.Path == ps.wanted {
+				wanted = options[i]
+			}
+		}
+		if wanted != "" {
+			ps.wanted = ""
+		}
+		ps.mu.Unlock()
+
+		ps.Select.Options = options
+		switch {
+		case wanted != "" && wanted != keep:
+			ps.Select.SetSelected(wanted)
+		case keep != "":
+			ps.Select.Selected = keep
+			ps.Select.Refresh()
+		case len(options) > 0:
+			ps.Select.SetSelected(options[0])
+		default:
+			ps.Select.ClearSelected()
+		}
+	})
+	return ps
+}
+
+// Path returns the path of the selected port
+func (ps *PortSelect) Path() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.paths[ps.Select.Selected]
+}
+
+// SetPath selects the port with the given path, now if present or else once it is plugged in
+func (ps *PortSelect) SetPath(path string) {
+	ps.mu.Lock()
+	option := ""
+	for text, p := range ps.paths {
+		if p == path {
+			option = text
+		}
+	}
+	if option == "" {
+		ps.wanted = path
+	}
+	ps.mu.Unlock()
+
+	if option != "" {
+		ps.Select.SetSelected(option)
+	}
+}
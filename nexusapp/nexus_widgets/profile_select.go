@@ -0,0 +1,61 @@
+package nexus_widgets
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// noProfile is the option that reads the registers entered by hand
+const noProfile = "None (manual registers)"
+
+// NewProfileSelect creates a picker of the profiles in nexus_modbus.Profiles with a button that
+// reloads the library folder. selected is called with the chosen profile, nil for none.
+// The chosen profile is added to settings.
+func NewProfileSelect(win fyne.Window, selected func(profile *nexus_modbus.Profile), settings *Settings) fyne.CanvasObject {
+	options := func() []string {
+		return append([]string{noProfile}, nexus_modbus.Profiles.Names()...)
+	}
+	profileSelect := widget.NewSelect(options(), func(name string) {
+		profile, _ := nexus_modbus.Profiles.Get(name)
+		selected(profile)
+	})
+	profileSelect.SetSelected(noProfile)
+	settings.Select("profile", profileSelect)
+
+	reloadButton := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
+		dir := nexus_modbus.Profiles.Dir()
+		if err := nexus_modbus.Profiles.Load(dir); err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		profileSelect.Options = options()
+		// Selecting again picks up the edited points of the selected profile
+		name := profileSelect.Selected
+		if _, ok := nexus_modbus.Profiles.Get(name); !ok {
+			name = noProfile
+		}
+		profileSelect.SetSelected(name)
+		if errs := nexus_modbus.Profiles.Errors(); len(errs) > 0 {
+			ShowProfileErrors(win, errs)
+		}
+	})
+	return container.NewBorder(nil, nil, nil, reloadButton, profileSelect)
+}
+
+// ShowProfileErrors lists the profile files that could not be loaded
+func ShowProfileErrors(win fyne.Window, errs []error) {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	dialog.ShowError(fmt.Errorf("Some profiles in %s could not be loaded:\n%s",
+		nexus_modbus.Profiles.Dir(), strings.Join(lines, "\n")), win)
+}
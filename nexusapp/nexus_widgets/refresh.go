@@ -0,0 +1,34 @@
+package nexus_widgets
+
+import (
+	"sync"
+	"time"
+)
+
+// appStopped is closed by StopRefreshing, which ends every refresh loop
+var (
+	appStopped  = make(chan struct{})
+	stopRefresh sync.Once
+)
+
+// RefreshEvery calls refresh every interval until stop is closed or StopRefreshing is called.
+// A nil stop runs for the life of the app, as the refresh loops of the tabs do.
+func RefreshEvery(interval time.Duration, stop <-chan struct{}, refresh func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-appStopped:
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// StopRefreshing ends every refresh loop, main calls it once the window has closed
+func StopRefreshing() {
+	stopRefresh.Do(func() { close(appStopped) })
+}
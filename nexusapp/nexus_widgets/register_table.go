@@ -0,0 +1,368 @@
+package nexus_widgets
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// Status of a row whose last read succeeded
+const RowOK = "OK"
+
+// registerColumns are the column titles of a register table, shown in its first row
+var registerColumns = []string{"Address", "Name", "Raw", "Value", "Unit", "Last Changed", "Status"}
+
+// registerColumnWidths are the initial widths of the columns
+var registerColumnWidths = []float32{100, 160, 120, 180, 60, 110, 200}
+
+// changedColor marks the rows whose value changed in the last poll
+var changedColor = color.NRGBA{R: 0xFF, G: 0xC1, B: 0x07, A: 0x50}
+
+// RegisterRow is one coil, register or profile point of a register table
+type RegisterRow struct {
+	FunctionCode int // Read function code, selects the table shown with the address
+	Address      int
+	Name         string
+	Raw          string // Register bytes in hex
+	Value        string
+	Unit         string
+	Status       string                     // RowOK or the error of the last read
+	Writable     bool                       // Double-clicking the row edits the value
+	Point        *nexus_modbus.ProfilePoint // Profile point shown by the row, nil for plain registers
+	Changed      time.Time                  // Set by the table when the value changes
+
+	changed bool // Value differs from the previous poll
+}
+
+// key identifies the row across polls
+func (r RegisterRow) key() string {
+	return fmt.Sprintf("%d/%d/%s", r.FunctionCode, r.Address, r.Name)
+}
+
+// AddressText returns the table and address of the row, e.g. "HR 500"
+func (r RegisterRow) AddressText() string {
+	return nexus_modbus.AddressName(r.FunctionCode, r.Address)
+}
+
+// column returns the text of the row in the given column
+func (r RegisterRow) column(col int) string {
+	switch col {
+	case 0:
+		return r.AddressText()
+	case 1:
+		return r.Name
+	case 2:
+		return r.Raw
+	case 3:
+		return r.Value
+	case 4:
+		return r.Unit
+	case 5:
+		if r.Changed.IsZero() {
+			return ""
+		}
+		return r.Changed.Format("15:04:05")
+	}
+	return r.Status
+}
+
+// ScanRows returns the rows of a poll. Point values are shown without their unit, which has
+// a column of its own.
+func ScanRows(result *nexus_modbus.ScanResult) []RegisterRow {
+	rows := make([]RegisterRow, 0, len(result.Values))
+	for _, value := range result.Values {
+		row := RegisterRow{
+			FunctionCode: value.FunctionCode,
+			Address:      value.Address,
+			Status:       RowOK,
+			Writable:     value.Writable(),
+			Point:        value.Point,
+		}
+		if value.Point != nil {
+			row.Name, row.Unit = value.Point.Name, value.Point.Unit
+		}
+		if value.Err != nil {
+			row.Status = value.Err.Error()
+		} else {
+			row.Raw = value.Raw
+			row.Value = strings.TrimSuffix(value.Text, " "+row.Unit)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// ScanErrorText describes a failed poll, or the failed requests of a poll that read other
+// values. It is empty when err is nil.
+func ScanErrorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	if chunks, ok := err.(*nexus_modbus.ChunkError); ok {
+		return "Read error: " + chunks.Error()
+	}
+	return "Read error: " + nexus_modbus.Classify(err).Describe()
+}
+
+// RegisterTable shows polled values with the time they last changed. Tapping a column title
+// sorts by it, tapping a row selects it for copying and double-clicking a writable row calls OnEdit.
+// Rows may be updated from any goroutine.
+type RegisterTable struct {
+	Table  *widget.Table
+	OnEdit func(row RegisterRow)
+
+	mu         sync.Mutex
+	rows       []RegisterRow   // In display order
+	selected   map[string]bool // By row key, kept across polls
+	sortColumn int             // -1 keeps the order of the poll
+	descending bool
+}
+
+// NewRegisterTable creates an empty register table
+func NewRegisterTable() *RegisterTable {
+	t := &RegisterTable{selected: make(map[string]bool), sortColumn: -1}
+	t.Table = widget.NewTable(
+		func() (int, int) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			return len(t.rows) + 1, len(registerColumns)
+		},
+		func() fyne.CanvasObject {
+			return newRegisterCell(t)
+		},
+		func(id widget.TableCellID, object fyne.CanvasObject) {
+			t.updateCell(id, object.(*registerCell))
+		},
+	)
+	for col, width := range registerColumnWidths {
+		t.Table.SetColumnWidth(col, width)
+	}
+	return t
+}
+
+// Update replaces the rows with the results of a poll. Values are compared with the previous
+// poll to set the changed time, rows that failed keep their last value next to the error.
+func (t *RegisterTable) Update(rows []RegisterRow) {
+	now := time.Now()
+	t.mu.Lock()
+	previous := make(map[string]RegisterRow, len(t.rows))
+	for _, row := range t.rows {
+		previous[row.key()] = row
+	}
+	for i := range rows {
+		row := &rows[i]
+		old, ok := previous[row.key()]
+		switch {
+		case !ok:
+			row.Changed = now
+		case row.Status != RowOK && row.Value == "":
+			row.Raw, row.Value, row.Changed = old.Raw, old.Value, old.Changed
+		case row.Value != old.Value:
+			row.Changed, row.changed = now, true
+		default:
+			row.Changed = old.Changed
+		}
+	}
+	t.rows = rows
+	t.sortRows()
+	t.mu.Unlock()
+
+	t.Table.Refresh()
+}
+
+// SetStatus sets the status of every row, e.g. when a whole poll failed
+func (t *RegisterTable) SetStatus(status string) {
+	t.mu.Lock()
+	for i := range t.rows {
+		t.rows[i].Status = status
+		t.rows[i].changed = false
+	}
+	t.mu.Unlock()
+
+	t.Table.Refresh()
+}
+
+// Text returns the column titles and the selected rows, or all rows when none is selected,
+// tab separated for pasting into a spreadsheet
+func (t *RegisterTable) Text() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var rows []RegisterRow
+	for _, row := range t.rows {
+		if t.selected[row.key()] {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		rows = t.rows
+	}
+
+	lines := []string{strings.Join(registerColumns, "\t")}
+	for _, row := range rows {
+		fields := make([]string, len(registerColumns))
+		for col := range fields {
+			fields[col] = row.column(col)
+		}
+		lines = append(lines, strings.Join(fields, "\t"))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ClearSelection unselects all rows
+func (t *RegisterTable) ClearSelection() {
+	t.mu.Lock()
+	t.selected = make(map[string]bool)
+	t.mu.Unlock()
+
+	t.Table.Refresh()
+}
+
+// sortRows orders the rows by the sort column, the caller holds the lock
+func (t *RegisterTable) sortRows() {
+	if t.sortColumn < 0 {
+		return
+	}
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		a, b := t.rows[i], t.rows[j]
+		if t.descending {
+			a, b = b, a
+		}
+		switch t.sortColumn {
+		case 0:
+			if a.FunctionCode != b.FunctionCode {
+				return a.FunctionCode < b.FunctionCode
+			}
+			return a.Address < b.Address
+		case 5:
+			return a.Changed.Before(b.Changed)
+		}
+		return strings.ToLower(a.column(t.sortColumn)) < strings.ToLower(b.column(t.sortColumn))
+	})
+}
+
+// updateCell shows the column title or row value in a cell
+func (t *RegisterTable) updateCell(id widget.TableCellID, cell *registerCell) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cell.id = id
+	cell.background.FillColor = color.Transparent
+	if id.Row == 0 {
+		title := registerColumns[id.Col]
+		if id.Col == t.sortColumn {
+			if t.descending {
+				title += " ▼"
+			} else {
+				title += " ▲"
+			}
+		}
+		cell.label.TextStyle = fyne.TextStyle{Bold: true}
+		cell.label.SetText(title)
+		cell.background.Refresh()
+		return
+	}
+	if id.Row > len(t.rows) {
+		cell.label.SetText("")
+		cell.background.Refresh()
+		return
+	}
+
+	row := t.rows[id.Row-1]
+	switch {
+	case t.selected[row.key()]:
+		cell.background.FillColor = theme.SelectionColor()
+	case row.changed:
+		cell.background.FillColor = changedColor
+	}
+	cell.label.TextStyle = fyne.TextStyle{}
+	cell.label.SetText(row.column(id.Col))
+	cell.background.Refresh()
+}
+
+// tapped sorts by a column title or toggles the selection of a row
+func (t *RegisterTable) tapped(id widget.TableCellID) {
+	t.mu.Lock()
+	if id.Row == 0 {
+		// Tapping the sort column again reverses the order
+		if t.sortColumn == id.Col {
+			t.descending = !t.descending
+		} else {
+			t.sortColumn, t.descending = id.Col, false
+		}
+		t.sortRows()
+	} else if id.Row <= len(t.rows) {
+		key := t.rows[id.Row-1].key()
+		if t.selected[key] {
+			delete(t.selected, key)
+		} else {
+			t.selected[key] = true
+		}
+	}
+	t.mu.Unlock()
+
+	t.Table.Refresh()
+}
+
+// doubleTapped edits the value of a writable row
+func (t *RegisterTable) doubleTapped(id widget.TableCellID) {
+	t.mu.Lock()
+	var row RegisterRow
+	ok := id.Row > 0 && id.Row <= len(t.rows)
+	if ok {
+		row = t.rows[id.Row-1]
+	}
+	t.mu.Unlock()
+
+	if ok && row.Writable && t.OnEdit != nil {
+		t.OnEdit(row)
+	}
+}
+
+// registerCell is a table cell that passes taps and double taps to its table
+type registerCell struct {
+	widget.BaseWidget
+
+	table      *RegisterTable
+	id         widget.TableCellID
+	background *canvas.Rectangle
+	label      *widget.Label
+}
+
+// newRegisterCell creates an empty cell of the table
+func newRegisterCell(table *RegisterTable) *registerCell {
+	cell := &registerCell{
+		table:      table,
+		background: canvas.NewRectangle(color.Transparent),
+		label:      widget.NewLabel(""),
+	}
+	cell.label.Wrapping = fyne.TextTruncate
+	cell.ExtendBaseWidget(cell)
+	return cell
+}
+
+// CreateRenderer implements fyne.Widget
+func (c *registerCell) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewMax(c.background, c.label))
+}
+
+// Tapped implements fyne.Tappable
+func (c *registerCell) Tapped(*fyne.PointEvent) {
+	c.table.tapped(c.id)
+}
+
+// DoubleTapped implements fyne.DoubleTappable
+func (c *registerCell) DoubleTapped(*fyne.PointEvent) {
+	c.table.doubleTapped(c.id)
+}
@@ -0,0 +1,30 @@
+package nexus_widgets
+
+import (
+	"fmt"
+	"io"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// SaveToFile asks for a file name, suggesting fileName, and saves what write produces into it.
+// what names the content in the error message.
+func SaveToFile(win fyne.Window, fileName, what string, write func(w io.Writer) error) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		if writer == nil {
+			return // Cancelled
+		}
+		defer writer.Close()
+
+		if err := write(writer); err != nil {
+			dialog.ShowError(fmt.Errorf("Failed to export %s: %v", what, err), win)
+		}
+	}, win)
+	saveDialog.SetFileName(fileName)
+	saveDialog.Show()
+}
@@ -0,0 +1,312 @@
+package nexus_widgets
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/goburrow/modbus"
+
+	"nexusapp/nexus_modbus"
+)
+
+// ScanTarget is the device a Scanner polls and what it reads
+type ScanTarget struct {
+	Transport nexus_modbus.TransportConfig
+	UnitId    byte
+	Name      string // Names the device in the statistics
+	Timing    nexus_modbus.Timing
+	Scan      nexus_modbus.ScanConfig
+}
+
+// Scanner polls, writes to and identifies the device of its target, one request at a time on
+// the shared connection of the target's transport. It holds the parts the scanner tabs share:
+// the register table, the message labels and the statistics.
+type Scanner struct {
+	Table   *RegisterTable
+	Stats   *nexus_modbus.Stats
+	Poller  *nexus_modbus.Poller // Runs the polls, writes and device info requests one at a time
+	Spinner *widget.ProgressBarInfinite
+
+	// OnScan is called from the poller after every poll that was not cancelled and shown, with
+	// the target it read and its result or error, nil when unused
+	OnScan func(target ScanTarget, result *nexus_modbus.ScanResult, err error)
+
+	window    fyne.Window
+	errorText binding.String
+	writeText binding.String
+
+	mu     sync.Mutex // Guards target
+	target ScanTarget // Copy of the form read by the poller and writes, see SetTarget
+}
+
+// NewScanner creates a scanner whose dialogs open on win
+func NewScanner(win fyne.Window) *Scanner {
+	s := &Scanner{
+		Table:     NewRegisterTable(),
+		Stats:     nexus_modbus.NewStats(),
+		Poller:    nexus_modbus.NewPoller(),
+		Spinner:   widget.NewProgressBarInfinite(),
+		window:    win,
+		errorText: binding.NewString(),
+		writeText: binding.NewString(),
+	}
+	s.Spinner.Hide() // Shown while polling
+	s.Table.OnEdit = func(row RegisterRow) {
+		scan := s.Target().Scan
+		ShowRowWriteDialog(win, row, scan.DataType, scan.ByteOrder, s.ShowError, s.Write)
+	}
+	return s
+}
+
+// SetTarget replaces the target, the tabs call it on the UI thread after every edit of the form
+func (s *Scanner) SetTarget(target ScanTarget) {
+	s.mu.Lock()
+	s.target = target
+	s.mu.Unlock()
+}
+
+// Target returns the target as of the last edit of the form, safe to call from any goroutine
+func (s *Scanner) Target() ScanTarget {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.target
+}
+
+// Connection returns the shared connection of the target's transport
+func (s *Scanner) Connection() nexus_modbus.Transport {
+	return nexus_modbus.GetTransport(s.Target().Transport)
+}
+
+// Start polls the target at its poll interval until Stop
+func (s *Scanner) Start() {
+	s.Spinner.Show()
+	s.Poller.Start(func() time.Duration { return s.Target().Timing.PollInterval }, s.scan)
+}
+
+// Stop stops polling, abandoning a read in flight
+func (s *Scanner) Stop() {
+	s.Poller.Stop()
+	s.Spinner.Hide()
+}
+
+// ReadOnce polls the target once on the poller queue, between the polls of a running scan
+func (s *Scanner) ReadOnce() {
+	go s.Poller.Do(context.Background(), func(ctx context.Context) error {
+		s.scan(ctx)
+		return nil
+	})
+}
+
+// scan reads the target's range or profile points once. Results of a poll cancelled while it
+// ran are dropped.
+func (s *Scanner) scan(ctx context.Context) {
+	target := s.Target()
+	var result *nexus_modbus.ScanResult
+	err := s.do(ctx, target, func(handler modbus.ClientHandler) error {
+		var err error
+		result, err = nexus_modbus.Scan(s.Stats.Client(target.Name, handler), target.Scan)
+		return err
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.errorText.Set(ScanErrorText(err))
+		s.Table.SetStatus(nexus_modbus.Classify(err).Error())
+	} else {
+		// Clear the error label when every request succeeded, else name the failed ones
+		s.errorText.Set(ScanErrorText(result.Err))
+		s.Table.Update(ScanRows(result))
+	}
+	if s.OnScan != nil {
+		s.OnScan(target, result, err)
+	}
+}
+
+// Write sends a write request to the target on the poller queue, between two polls. Registers
+// returned by FC23 are decoded with the data type and byte order used for the written values.
+func (s *Scanner) Write(request nexus_modbus.WriteRequest, dataType nexus_modbus.DataType, byteOrder nexus_modbus.ByteOrder) {
+	target := s.Target()
+	var results []byte
+	err := s.Poller.Do(context.Background(), func(ctx context.Context) error {
+		return s.do(ctx, target, func(handler modbus.ClientHandler) error {
+			var err error
+			results, err = nexus_modbus.Write(s.Stats.Client(target.Name, handler), request)
+			return err
+		})
+	})
+	if err != nil {
+		s.writeText.Set("Write error: " + nexus_modbus.Classify(err).Describe())
+		return
+	}
+
+	s.writeText.Set(WriteResultText(request, results, dataType, byteOrder))
+	go func() {
+		// Clear the message after 5 seconds, the binding refreshes the label on the main thread
+		time.Sleep(5 * time.Second)
+		s.writeText.Set("")
+	}()
+}
+
+// ReadDeviceIdentification asks the target for its FC43 / MEI 14 identification objects
+func (s *Scanner) ReadDeviceIdentification() (*nexus_modbus.DeviceIdentification, error) {
+	target := s.Target()
+	var identification *nexus_modbus.DeviceIdentification
+	err := s.Poller.Do(context.Background(), func(ctx context.Context) error {
+		return s.do(ctx, target, func(handler modbus.ClientHandler) error {
+			var err error
+			identification, err = nexus_modbus.ReadDeviceIdentification(s.Stats.Handler(target.Name, handler))
+			return err
+		})
+	})
+	return identification, err
+}
+
+// do runs request on the connection of target
+func (s *Scanner) do(ctx context.Context, target ScanTarget, request func(handler modbus.ClientHandler) error) error {
+	return nexus_modbus.GetTransport(target.Transport).Do(ctx, target.UnitId, target.Timing, request)
+}
+
+// ShowError shows a message in the error label
+func (s *Scanner) ShowError(message string) {
+	s.errorText.Set(message)
+}
+
+// Messages returns the error and write labels, shown below the table
+func (s *Scanner) Messages() fyne.CanvasObject {
+	errorLabel := widget.NewLabelWithData(s.errorText)
+	errorLabel.Wrapping = fyne.TextWrapWord
+	return container.NewVBox(errorLabel, widget.NewLabelWithData(s.writeText))
+}
+
+// TableButtons returns the buttons that copy and clear the selected rows of the table
+func (s *Scanner) TableButtons() fyne.CanvasObject {
+	// Copies the selected rows, or all of them, for pasting into a spreadsheet
+	copyButton := widget.NewButtonWithIcon("Copy Rows", theme.ContentCopyIcon(), func() {
+		s.window.Clipboard().SetContent(s.Table.Text())
+	})
+	clearButton := widget.NewButton("Clear Selection", func() {
+		s.Table.ClearSelection()
+	})
+	return container.NewHBox(copyButton, clearButton)
+}
+
+// ScanForm is what the read inputs of a scanner tab set, see NewScanForm
+type ScanForm struct {
+	FunctionCode int
+	Address      int
+	Quantity     int
+	DataType     nexus_modbus.DataType
+	ByteOrder    nexus_modbus.ByteOrder
+	Profile      *nexus_modbus.Profile // Named points read instead of the range, nil for none
+	MaxBlock     int                   // Registers per request, 0 for the protocol limit
+}
+
+// Config returns what a poll reads, the profile points instead of the range when one is selected
+func (f *ScanForm) Config() nexus_modbus.ScanConfig {
+	return nexus_modbus.ScanConfig{
+		FunctionCode: f.FunctionCode,
+		Address:      f.Address,
+		Quantity:     f.Quantity,
+		DataType:     f.DataType,
+		ByteOrder:    f.ByteOrder,
+		Profile:      f.Profile,
+		Planner:      nexus_modbus.ReadPlanner{MaxRegisters: f.MaxBlock},
+	}
+}
+
+// NewScanForm builds the function code, range, data type, byte order, profile and block size
+// inputs, which update form as they are edited and then call changed, if set. The inputs are
+// added to settings, the range entries under addressKey and quantityKey.
+func NewScanForm(win fyne.Window, form *ScanForm, addressKey, quantityKey string, settings *Settings, changed func()) fyne.CanvasObject {
+	functionCodeSelect := widget.NewSelect([]string{"1: Read Coils", "2: Read Discrete Inputs", "3: Read Holding Registers", "4: Read Input Registers"}, func(s string) {
+		code, err := strconv.Atoi(s[:1])
+		if err == nil {
+			form.FunctionCode = code
+			notify(changed)
+		}
+	})
+	if form.FunctionCode >= 1 && form.FunctionCode <= len(functionCodeSelect.Options) {
+		functionCodeSelect.SetSelected(functionCodeSelect.Options[form.FunctionCode-1])
+	}
+	settings.Select("functionCode", functionCodeSelect)
+
+	addressEntry := widget.NewEntry()
+	addressEntry.SetPlaceHolder("Start Register (e.g., 0)")
+	addressEntry.OnChanged = func(s string) {
+		address, err := strconv.Atoi(s)
+		if err == nil {
+			form.Address = address
+			notify(changed)
+		}
+	}
+	settings.Entry(addressKey, addressEntry)
+
+	quantityEntry := widget.NewEntry()
+	quantityEntry.SetPlaceHolder("Number of Registers (e.g., 1)")
+	quantityEntry.OnChanged = func(s string) {
+		quantity, err := strconv.Atoi(s)
+		if err == nil {
+			form.Quantity = quantity
+			notify(changed)
+		}
+	}
+	settings.Entry(quantityKey, quantityEntry)
+
+	dataTypes := make([]string, len(nexus_modbus.DataTypes))
+	for i, dataType := range nexus_modbus.DataTypes {
+		dataTypes[i] = string(dataType)
+	}
+	dataTypeSelect := widget.NewSelect(dataTypes, func(s string) {
+		form.DataType = nexus_modbus.DataType(s)
+		notify(changed)
+	})
+	dataTypeSelect.SetSelected(string(form.DataType))
+	settings.Select("dataType", dataTypeSelect)
+
+	byteOrders := make([]string, len(nexus_modbus.ByteOrders))
+	for i, order := range nexus_modbus.ByteOrders {
+		byteOrders[i] = string(order)
+	}
+	byteOrderSelect := widget.NewSelect(byteOrders, func(s string) {
+		form.ByteOrder = nexus_modbus.ByteOrder(s)
+		notify(changed)
+	})
+	byteOrderSelect.SetSelected(string(form.ByteOrder))
+	settings.Select("byteOrder", byteOrderSelect)
+
+	// Longer ranges are read in several requests, some devices answer fewer than 125 registers at once
+	maxBlockEntry := widget.NewEntry()
+	maxBlockEntry.SetPlaceHolder("Registers per request (max 125)")
+	maxBlockEntry.OnChanged = func(s string) {
+		maxBlock, err := strconv.Atoi(s)
+		if err != nil || maxBlock < 0 {
+			maxBlock = 0
+		}
+		form.MaxBlock = maxBlock
+		notify(changed)
+	}
+	settings.Entry("maxBlock", maxBlockEntry)
+
+	profileSelect := NewProfileSelect(win, func(profile *nexus_modbus.Profile) {
+		form.Profile = profile
+		notify(changed)
+	}, settings)
+
+	return container.NewGridWithColumns(3,
+		container.NewVBox(widget.NewLabel("Function Code"), functionCodeSelect),
+		container.NewVBox(widget.NewLabel("Start Register"), addressEntry),
+		container.NewVBox(widget.NewLabel("Number of Registers"), quantityEntry),
+		container.NewVBox(widget.NewLabel("Data Type"), dataTypeSelect),
+		container.NewVBox(widget.NewLabel("Byte Order"), byteOrderSelect),
+		container.NewVBox(widget.NewLabel("Device Profile"), profileSelect),
+		container.NewVBox(widget.NewLabel("Max Block Size"), maxBlockEntry),
+	)
+}
@@ -0,0 +1,129 @@
+package nexus_widgets
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+
+	"nexusapp/nexus_modbus"
+)
+
+// scanned is one call of Scanner.OnScan
+type scanned struct {
+	target ScanTarget
+	result *nexus_modbus.ScanResult
+	err    error
+}
+
+// simulatedTarget serves a simulator on a local port until the test ends and returns a target
+// reading its holding registers 0-1
+func simulatedTarget(t *testing.T, sim *nexus_modbus.Simulator) ScanTarget {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go sim.ServeTCP(ctx, listener)
+	t.Cleanup(cancel)
+
+	address := listener.Addr().String()
+	return ScanTarget{
+		Transport: nexus_modbus.TransportConfig{Kind: nexus_modbus.TransportTCP, Address: address},
+		UnitId:    1,
+		Name:      address + " unit 1",
+		Timing:    nexus_modbus.Timing{PollInterval: 10 * time.Millisecond, Timeout: time.Second},
+		Scan: nexus_modbus.ScanConfig{
+			FunctionCode: 3,
+			Quantity:     2,
+			DataType:     nexus_modbus.TypeUint16,
+			ByteOrder:    nexus_modbus.OrderABCD,
+		},
+	}
+}
+
+// nextScan waits for a poll of the scanner or fails the test
+func nextScan(t *testing.T, scans <-chan scanned) scanned {
+	t.Helper()
+	select {
+	case scan := <-scans:
+		return scan
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a poll")
+		return scanned{}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	test.NewApp()
+	sim := nexus_modbus.NewSimulator([]byte{1}, nexus_modbus.SimSizes{HoldingRegisters: 8})
+	if err := sim.SetValue(1, nexus_modbus.TableHoldingRegisters, 1, 4321); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScanner(test.NewWindow(nil))
+	scans := make(chan scanned, 100)
+	s.OnScan = func(target ScanTarget, result *nexus_modbus.ScanResult, err error) {
+		scans <- scanned{target, result, err}
+	}
+	target := simulatedTarget(t, sim)
+	s.SetTarget(target)
+
+	s.ReadOnce()
+	scan := nextScan(t, scans)
+	if scan.err != nil {
+		t.Fatalf("poll failed: %v", scan.err)
+	}
+	if scan.target.Name != target.Name || len(scan.result.Values) != 2 || scan.result.Values[1].Text != "4321" {
+		t.Fatalf("poll of %q read %+v, want 0 and 4321 from %q", scan.target.Name, scan.result.Values, target.Name)
+	}
+	if text := s.Table.Text(); !strings.Contains(text, "4321") {
+		t.Fatalf("table does not show the polled value:\n%s", text)
+	}
+
+	// Writes go through the poller queue while polling
+	s.Start()
+	nextScan(t, scans)
+	s.Write(nexus_modbus.NewRegisterWrite(0, []byte{0x00, 0x07}, false), nexus_modbus.TypeUint16, nexus_modbus.OrderABCD)
+	if values := sim.Values(1, nexus_modbus.TableHoldingRegisters); values[0] != 7 {
+		t.Fatalf("holding register 0 = %d after the write, want 7", values[0])
+	}
+	identification, err := s.ReadDeviceIdentification()
+	if err != nil {
+		t.Fatalf("ReadDeviceIdentification: %v", err)
+	}
+	if vendor := identification.Get("VendorName"); vendor != "Nexus" {
+		t.Fatalf("vendor %q, want Nexus", vendor)
+	}
+	s.Stop()
+	if s.Poller.Running() {
+		t.Fatal("poller still running after Stop")
+	}
+
+	stats := s.Stats.Snapshot()
+	if len(stats) != 1 || stats[0].Device != target.Name || stats[0].Requests < 4 {
+		t.Fatalf("statistics %+v, want at least 4 requests of %q", stats, target.Name)
+	}
+}
+
+func TestScannerTargetFailure(t *testing.T) {
+	test.NewApp()
+	s := NewScanner(test.NewWindow(nil))
+	scans := make(chan scanned, 1)
+	s.OnScan = func(target ScanTarget, result *nexus_modbus.ScanResult, err error) {
+		scans <- scanned{target, result, err}
+	}
+
+	// Unit 9 does not exist, the simulator answers as a gateway would
+	target := simulatedTarget(t, nexus_modbus.NewSimulator([]byte{1}, nexus_modbus.SimSizes{HoldingRegisters: 8}))
+	target.UnitId = 9
+	s.SetTarget(target)
+	s.ReadOnce()
+	if scan := nextScan(t, scans); scan.err == nil {
+		t.Fatalf("poll of an absent unit read %+v", scan.result.Values)
+	}
+}
@@ -0,0 +1,87 @@
+package nexus_widgets
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// ShowSerialDetectDialog opens the serial settings auto-detect window for the given port.
+// Clicking a detected combination passes it to apply and closes the window.
+func ShowSerialDetectDialog(win fyne.Window, port string, dataBits int, slaveId byte, apply func(nexus_modbus.SerialSettings)) {
+	slaveIdEntry := widget.NewEntry()
+	slaveIdEntry.SetText(strconv.Itoa(int(slaveId)))
+	registerEntry := widget.NewEntry()
+	registerEntry.SetText("0")
+	probeTimeoutEntry := widget.NewEntry()
+	probeTimeoutEntry.SetText("300")
+
+	probeGrid := container.NewGridWithColumns(3,
+		container.NewVBox(widget.NewLabel("Slave ID"), slaveIdEntry),
+		container.NewVBox(widget.NewLabel("Probe Register"), registerEntry),
+		container.NewVBox(widget.NewLabel("Probe Timeout (ms)"), probeTimeoutEntry),
+	)
+
+	NewSweepDialog(win, SweepConfig{
+		Title:     "Detect Serial Settings",
+		Form:      probeGrid,
+		StartText: "Detect",
+		Columns:   []string{"Settings", "Response Time", "Exception"},
+		Widths:    []float32{140, 140, 100},
+		Hint:      "Click a result to apply its settings to the form",
+		Size:      fyne.NewSize(520, 560),
+		Start: func() (SweepFunc, error) {
+			id, err := strconv.Atoi(slaveIdEntry.Text)
+			if err != nil || id < 1 || id > 247 {
+				return nil, fmt.Errorf("Invalid slave ID: %s", slaveIdEntry.Text)
+			}
+			register, err := strconv.Atoi(registerEntry.Text)
+			if err != nil || register < 0 || register > 65535 {
+				return nil, fmt.Errorf("Invalid register address: %s", registerEntry.Text)
+			}
+			timeoutMs, err := strconv.Atoi(probeTimeoutEntry.Text)
+			if err != nil || timeoutMs <= 0 {
+				return nil, fmt.Errorf("Invalid probe timeout: %s", probeTimeoutEntry.Text)
+			}
+
+			return func(ctx context.Context, run *SweepRun) string {
+				run.SetStatus(fmt.Sprintf("Trying serial settings on %s...", port))
+				err := nexus_modbus.DetectSerialSettings(ctx, port, dataBits, byte(id), uint16(register),
+					time.Duration(timeoutMs)*time.Millisecond,
+					func(result nexus_modbus.DetectedSettings) { run.Add(result) }, run.Progress)
+				switch {
+				case err != nil:
+					return nexus_modbus.Classify(err).Describe()
+				case ctx.Err() != nil:
+					return fmt.Sprintf("Detection cancelled, %d working setting(s) found", run.Count())
+				case run.Count() == 0:
+					return "No response with any setting, check wiring and slave ID"
+				}
+				return fmt.Sprintf("Detection finished, %d working setting(s) found", run.Count())
+			}, nil
+		},
+		Cell: func(row interface{}, col int) string {
+			result := row.(nexus_modbus.DetectedSettings)
+			switch col {
+			case 0:
+				return result.SerialSettings.String()
+			case 1:
+				return result.ResponseTime.Round(time.Millisecond).String()
+			}
+			if result.ExceptionCode == 0 {
+				return "-"
+			}
+			return fmt.Sprintf("0x%02X", result.ExceptionCode)
+		},
+		OnSelect: func(row interface{}) {
+			apply(row.(nexus_modbus.DetectedSettings).SerialSettings)
+		},
+	}).Show()
+}
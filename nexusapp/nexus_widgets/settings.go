@@ -0,0 +1,84 @@
+package nexus_widgets
+
+import (
+	"strconv"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+// setting reads and writes one saved value of a tab
+type setting struct {
+	get func() string
+	set func(value string)
+}
+
+// Settings collects the inputs of a tab by key, so a workspace can save and restore them.
+// Restoring sets the inputs as if typed, which updates the tab through their callbacks.
+// The methods accept a nil Settings, for forms used outside a workspace.
+type Settings struct {
+	keys     []string // In the order added, which is the order restored
+	settings map[string]setting
+}
+
+// NewSettings creates an empty set of settings
+func NewSettings() *Settings {
+	return &Settings{settings: make(map[string]setting)}
+}
+
+// Add registers a value under key
+func (s *Settings) Add(key string, get func() string, set func(value string)) {
+	if s == nil {
+		return
+	}
+	if _, ok := s.settings[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.settings[key] = setting{get: get, set: set}
+}
+
+// Entry registers the text of an entry and returns the entry
+func (s *Settings) Entry(key string, entry *widget.Entry) *widget.Entry {
+	s.Add(key, func() string { return entry.Text }, entry.SetText)
+	return entry
+}
+
+// Select registers the selected option of a select, options that no longer exist are not restored
+func (s *Settings) Select(key string, sel *widget.Select) *widget.Select {
+	s.Add(key, func() string { return sel.Selected }, func(value string) {
+		for _, option := range sel.Options {
+			if option == value {
+				sel.SetSelected(value)
+				return
+			}
+		}
+	})
+	return sel
+}
+
+// Check registers the state of a check
+func (s *Settings) Check(key string, check *widget.Check) *widget.Check {
+	s.Add(key, func() string { return strconv.FormatBool(check.Checked) }, func(value string) {
+		if checked, err := strconv.ParseBool(value); err == nil {
+			check.SetChecked(checked)
+		}
+	})
+	return check
+}
+
+// Values returns the current value of every setting
+func (s *Settings) Values() map[string]string {
+	values := make(map[string]string, len(s.keys))
+	for _, key := range s.keys {
+		values[key] = s.settings[key].get()
+	}
+	return values
+}
+
+// Restore sets the given values in the order the settings were added, unknown keys are ignored
+func (s *Settings) Restore(values map[string]string) {
+	for _, key := range s.keys {
+		if value, ok := values[key]; ok {
+			s.settings[key].set(value)
+		}
+	}
+}
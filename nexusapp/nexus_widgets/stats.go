@@ -0,0 +1,97 @@
+package nexus_widgets
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// ShowStatsDialog opens the communication statistics of stats, refreshed every second while open
+func ShowStatsDialog(win fyne.Window, title string, stats *nexus_modbus.Stats) {
+	snapshot := stats.Snapshot()
+
+	headers := []string{"Device", "Requests", "OK", "Timeouts", "CRC/Frame", "Port", "Exceptions", "Min", "Avg", "Max", "P95"}
+	milliseconds := func(d time.Duration) string {
+		return fmt.Sprintf("%.1f ms", float64(d)/float64(time.Millisecond))
+	}
+	statsTable := widget.NewTable(
+		func() (int, int) { return len(snapshot) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("CRC/Frame") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.SetText(headers[id.Col])
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				return
+			}
+			label.TextStyle = fyne.TextStyle{}
+			device := snapshot[id.Row-1]
+			switch id.Col {
+			case 0:
+				label.SetText(device.Device)
+			case 1:
+				label.SetText(strconv.Itoa(device.Requests))
+			case 2:
+				label.SetText(strconv.Itoa(device.Successes))
+			case 3:
+				label.SetText(strconv.Itoa(device.Timeouts))
+			case 4:
+				label.SetText(strconv.Itoa(device.FrameErrors))
+			case 5:
+				label.SetText(strconv.Itoa(device.PortErrors))
+			case 6:
+				text := strconv.Itoa(device.ExceptionCount())
+				if summary := device.ExceptionSummary(); summary != "" {
+					text += " (" + summary + ")"
+				}
+				label.SetText(text)
+			case 7:
+				label.SetText(milliseconds(device.Min))
+			case 8:
+				label.SetText(milliseconds(device.Avg))
+			case 9:
+				label.SetText(milliseconds(device.Max))
+			case 10:
+				label.SetText(milliseconds(device.P95))
+			}
+		},
+	)
+	statsTable.SetColumnWidth(0, 160)
+	statsTable.SetColumnWidth(6, 150)
+
+	refresh := func() {
+		snapshot = stats.Snapshot()
+		statsTable.Refresh()
+	}
+
+	resetButton := widget.NewButtonWithIcon("Reset", theme.DeleteIcon(), func() {
+		stats.Reset()
+		refresh()
+	})
+	exportButton := widget.NewButtonWithIcon("Export CSV", theme.DocumentSaveIcon(), func() {
+		current := stats.Snapshot()
+		SaveToFile(win, "modbus_stats.csv", "statistics", func(w io.Writer) error {
+			return nexus_modbus.WriteStatsCSV(w, current)
+		})
+	})
+
+	stop := make(chan struct{})
+	statsDialog := dialog.NewCustom(title, "Close",
+		container.NewBorder(nil, container.NewHBox(resetButton, exportButton), nil, nil, statsTable), win)
+	statsDialog.SetOnClosed(func() {
+		close(stop)
+	})
+	statsDialog.Resize(fyne.NewSize(1000, 400))
+	statsDialog.Show()
+
+	go RefreshEvery(time.Second, stop, refresh)
+}
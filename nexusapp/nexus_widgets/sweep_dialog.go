@@ -0,0 +1,222 @@
+package nexus_widgets
+
+import (
+	"context"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// SweepFunc runs a sweep until it ends or ctx is cancelled and returns the final status line.
+// Results and progress are reported through run.
+type SweepFunc func(ctx context.Context, run *SweepRun) string
+
+// SweepConfig describes a sweep window: the inputs of the sweep, the columns of its results
+// and what clicking a result does
+type SweepConfig struct {
+	Title     string
+	Form      fyne.CanvasObject   // Inputs shown above the buttons, may be nil
+	StartText string              // Label of the start button
+	Buttons   []fyne.CanvasObject // More buttons shown after Cancel, e.g. exports
+	Columns   []string
+	Widths    []float32 // Column widths, the table's default when shorter than Columns
+	Hint      string    // Shown above the results, e.g. how to use them
+	Size      fyne.Size
+
+	// Start checks the inputs and returns the sweep to run, its error is shown as the status
+	Start func() (SweepFunc, error)
+	// Cell returns the text of a result in a column
+	Cell func(row interface{}, col int) string
+	// OnSelect receives a clicked result, the window closes afterwards. Nil ignores clicks.
+	OnSelect func(row interface{})
+}
+
+// SweepDialog runs a sweep in the background and lists its results as they arrive. Closing the
+// window cancels a running sweep.
+type SweepDialog struct {
+	config       SweepConfig
+	dialog       dialog.Dialog
+	table        *widget.Table
+	progressBar  *widget.ProgressBar
+	statusLabel  *widget.Label
+	startButton  *widget.Button
+	cancelButton *widget.Button
+
+	mu     sync.Mutex
+	rows   []interface{}
+	cancel context.CancelFunc // Set while a sweep runs
+}
+
+// SweepRun reports the results and progress of one sweep to its window. Its methods may be
+// called from any goroutine.
+type SweepRun struct {
+	dialog *SweepDialog
+}
+
+// Add appends a result to the table
+func (r *SweepRun) Add(row interface{}) {
+	r.dialog.mu.Lock()
+	r.dialog.rows = append(r.dialog.rows, row)
+	r.dialog.mu.Unlock()
+	r.dialog.table.Refresh()
+}
+
+// Progress moves the progress bar
+func (r *SweepRun) Progress(done, total int) {
+	if total > 0 {
+		r.dialog.progressBar.SetValue(float64(done) / float64(total))
+	}
+}
+
+// SetStatus shows a status line while the sweep runs
+func (r *SweepRun) SetStatus(text string) {
+	r.dialog.statusLabel.SetText(text)
+}
+
+// Count returns the number of results added so far
+func (r *SweepRun) Count() int {
+	return len(r.dialog.Rows())
+}
+
+// NewSweepDialog creates the sweep window, Show opens it
+func NewSweepDialog(win fyne.Window, config SweepConfig) *SweepDialog {
+	d := &SweepDialog{
+		config:      config,
+		progressBar: widget.NewProgressBar(),
+		statusLabel: widget.NewLabel(""),
+	}
+	d.statusLabel.Wrapping = fyne.TextWrapWord
+
+	d.table = widget.NewTable(
+		func() (int, int) {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return len(d.rows) + 1, len(config.Columns)
+		},
+		func() fyne.CanvasObject { return widget.NewLabel("Response Time") },
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			label := cell.(*widget.Label)
+			if id.Row == 0 {
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				label.SetText(config.Columns[id.Col])
+				return
+			}
+			label.TextStyle = fyne.TextStyle{}
+			d.mu.Lock()
+			var row interface{}
+			if id.Row <= len(d.rows) {
+				row = d.rows[id.Row-1]
+			}
+			d.mu.Unlock()
+			if row == nil {
+				label.SetText("")
+				return
+			}
+			label.SetText(config.Cell(row, id.Col))
+		},
+	)
+	for col, width := range config.Widths {
+		d.table.SetColumnWidth(col, width)
+	}
+	d.table.OnSelected = func(id widget.TableCellID) {
+		d.mu.Lock()
+		var row interface{}
+		if id.Row > 0 && id.Row <= len(d.rows) {
+			row = d.rows[id.Row-1]
+		}
+		d.mu.Unlock()
+		if row == nil || config.OnSelect == nil {
+			return
+		}
+		config.OnSelect(row)
+		d.dialog.Hide()
+	}
+
+	d.startButton = widget.NewButtonWithIcon(config.StartText, theme.SearchIcon(), d.start)
+	d.cancelButton = widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), d.Cancel)
+	d.cancelButton.Disable()
+
+	buttons := container.NewHBox(d.startButton, d.cancelButton)
+	for _, button := range config.Buttons {
+		buttons.Add(button)
+	}
+	top := container.NewVBox()
+	if config.Form != nil {
+		top.Add(config.Form)
+	}
+	top.Add(buttons)
+	top.Add(d.progressBar)
+	top.Add(d.statusLabel)
+	if config.Hint != "" {
+		top.Add(widget.NewLabel(config.Hint))
+	}
+
+	d.dialog = dialog.NewCustom(config.Title, "Close", container.NewBorder(top, nil, nil, nil, d.table), win)
+	d.dialog.SetOnClosed(d.Cancel)
+	d.dialog.Resize(config.Size)
+	return d
+}
+
+// Show opens the window
+func (d *SweepDialog) Show() {
+	d.dialog.Show()
+}
+
+// Rows returns a copy of the results listed so far
+func (d *SweepDialog) Rows() []interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]interface{}(nil), d.rows...)
+}
+
+// Cancel stops a running sweep, it finishes with its last result
+func (d *SweepDialog) Cancel() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// start checks the inputs and runs the sweep in the background
+func (d *SweepDialog) start() {
+	sweep, err := d.config.Start()
+	if err != nil {
+		d.statusLabel.SetText(err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.mu.Lock()
+	if d.cancel != nil {
+		// A sweep is still running
+		d.mu.Unlock()
+		cancel()
+		return
+	}
+	d.rows = nil
+	d.cancel = cancel
+	d.mu.Unlock()
+
+	d.table.Refresh()
+	d.progressBar.SetValue(0)
+	d.statusLabel.SetText("")
+	d.startButton.Disable()
+	d.cancelButton.Enable()
+
+	go func() {
+		status := sweep(ctx, &SweepRun{dialog: d})
+		cancel()
+
+		d.mu.Lock()
+		d.cancel = nil
+		d.mu.Unlock()
+		d.statusLabel.SetText(status)
+		d.startButton.Enable()
+		d.cancelButton.Disable()
+	}()
+}
@@ -0,0 +1,63 @@
+package nexus_widgets
+
+import (
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// NewTimingForm builds the entries for the request timing, which update timing as they are edited
+// and then call changed, if set. The poll interval entry is only shown for tools that poll. The
+// entries are added to settings.
+func NewTimingForm(timing *nexus_modbus.Timing, poll bool, settings *Settings, changed func()) fyne.CanvasObject {
+	millisecondsEntry := func(value *time.Duration, placeHolder string) *widget.Entry {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder(placeHolder)
+		entry.SetText(strconv.FormatInt(int64(*value/time.Millisecond), 10))
+		entry.OnChanged = func(s string) {
+			if d, err := nexus_modbus.ParseMilliseconds(s); err == nil {
+				*value = d
+				notify(changed)
+			}
+		}
+		return entry
+	}
+
+	timeoutEntry := settings.Entry("timeout", millisecondsEntry(&timing.Timeout, "Timeout (ms)"))
+	frameDelayEntry := settings.Entry("frameDelay", millisecondsEntry(&timing.FrameDelay, "Frame delay (ms)"))
+
+	retriesEntry := widget.NewEntry()
+	retriesEntry.SetPlaceHolder("Retries (e.g., 2)")
+	retriesEntry.SetText(strconv.Itoa(timing.Retries))
+	retriesEntry.OnChanged = func(s string) {
+		if retries, err := strconv.Atoi(s); err == nil && retries >= 0 {
+			timing.Retries = retries
+			notify(changed)
+		}
+	}
+	settings.Entry("retries", retriesEntry)
+
+	var objects []fyne.CanvasObject
+	if poll {
+		pollIntervalEntry := settings.Entry("pollInterval", millisecondsEntry(&timing.PollInterval, "Poll interval (ms)"))
+		objects = append(objects, container.NewVBox(widget.NewLabel("Poll Interval (ms)"), pollIntervalEntry))
+	}
+	objects = append(objects,
+		container.NewVBox(widget.NewLabel("Timeout (ms)"), timeoutEntry),
+		container.NewVBox(widget.NewLabel("Frame Delay (ms)"), frameDelayEntry),
+		container.NewVBox(widget.NewLabel("Retries"), retriesEntry),
+	)
+	return container.NewGridWithColumns(len(objects), objects...)
+}
+
+// notify calls an optional change callback
+func notify(changed func()) {
+	if changed != nil {
+		changed()
+	}
+}
@@ -0,0 +1,45 @@
+package nexus_widgets
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// NewTransportForm builds a select of the given transports and an entry for the host:port of
+// the network ones, which update kind and address as they are edited and then call changed, if
+// set. The entry is only shown while a network transport is selected. Both are added to settings.
+func NewTransportForm(kinds []nexus_modbus.TransportKind, kind *nexus_modbus.TransportKind, address *string, settings *Settings, changed func()) fyne.CanvasObject {
+	addressEntry := widget.NewEntry()
+	addressEntry.SetPlaceHolder("Host:Port (e.g., 192.168.1.10:502)")
+	addressEntry.SetText(*address)
+	addressEntry.OnChanged = func(s string) {
+		*address = s
+		notify(changed)
+	}
+	addressContainer := container.NewVBox(widget.NewLabel("Host:Port"), addressEntry)
+
+	options := make([]string, len(kinds))
+	for i, k := range kinds {
+		options[i] = string(k)
+	}
+	transportSelect := widget.NewSelect(options, func(s string) {
+		*kind = nexus_modbus.TransportKind(s)
+		if kind.IsSerial() {
+			addressContainer.Hide()
+		} else {
+			addressContainer.Show()
+		}
+		notify(changed)
+	})
+	transportSelect.SetSelected(string(*kind))
+	settings.Select("transport", transportSelect)
+	settings.Entry("address", addressEntry)
+
+	return container.NewGridWithColumns(2,
+		container.NewVBox(widget.NewLabel("Transport"), transportSelect),
+		addressContainer,
+	)
+}
@@ -0,0 +1,315 @@
+package nexus_widgets
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+const (
+	chartMarginLeft   = 70
+	chartMarginBottom = 24
+	chartMarginTop    = 8
+	chartMarginRight  = 12
+)
+
+// trendColors is the palette used for the plotted series, in order
+var trendColors = []color.Color{
+	color.NRGBA{R: 0x21, G: 0x96, B: 0xF3, A: 0xFF},
+	color.NRGBA{R: 0xF4, G: 0x43, B: 0x36, A: 0xFF},
+	color.NRGBA{R: 0x4C, G: 0xAF, B: 0x50, A: 0xFF},
+	color.NRGBA{R: 0xFF, G: 0x98, B: 0x00, A: 0xFF},
+	color.NRGBA{R: 0x9C, G: 0x27, B: 0xB0, A: 0xFF},
+	color.NRGBA{R: 0x00, G: 0xBC, B: 0xD4, A: 0xFF},
+	color.NRGBA{R: 0xFF, G: 0xEB, B: 0x3B, A: 0xFF},
+	color.NRGBA{R: 0x79, G: 0x55, B: 0x48, A: 0xFF},
+}
+
+// TrendSeries is one named line on a trend chart
+type TrendSeries struct {
+	Name    string
+	Samples []nexus_modbus.Sample
+}
+
+// TrendChart plots series of samples against time with auto-scaling axes.
+// Hovering the plot shows a cursor and reports the values under it through OnCursor.
+type TrendChart struct {
+	widget.BaseWidget
+
+	OnCursor func(readout string)
+
+	mu            sync.Mutex // Guards the fields below, SetData is called from the refresh loop of the trend window
+	series        []TrendSeries
+	start, end    time.Time
+	cursorX       float32
+	cursorVisible bool
+}
+
+// NewTrendChart creates an empty trend chart
+func NewTrendChart() *TrendChart {
+	chart := &TrendChart{}
+	chart.ExtendBaseWidget(chart)
+	return chart
+}
+
+// SetData replaces the plotted series and the visible time span
+func (c *TrendChart) SetData(series []TrendSeries, start, end time.Time) {
+	c.mu.Lock()
+	c.series = series
+	c.start = start
+	c.end = end
+	c.mu.Unlock()
+	c.Refresh()
+	c.reportCursor()
+}
+
+// SeriesColor returns the line color used for the series at index i
+func SeriesColor(i int) color.Color {
+	return trendColors[i%len(trendColors)]
+}
+
+// MouseIn implements desktop.Hoverable
+func (c *TrendChart) MouseIn(event *desktop.MouseEvent) {
+	c.MouseMoved(event)
+}
+
+// MouseMoved implements desktop.Hoverable
+func (c *TrendChart) MouseMoved(event *desktop.MouseEvent) {
+	width := c.Size().Width
+	c.mu.Lock()
+	c.cursorX = event.Position.X
+	c.cursorVisible = event.Position.X >= chartMarginLeft && event.Position.X <= width-chartMarginRight
+	c.mu.Unlock()
+	c.Refresh()
+	c.reportCursor()
+}
+
+// MouseOut implements desktop.Hoverable
+func (c *TrendChart) MouseOut() {
+	c.mu.Lock()
+	c.cursorVisible = false
+	c.mu.Unlock()
+	c.Refresh()
+	if c.OnCursor != nil {
+		c.OnCursor("")
+	}
+}
+
+// reportCursor reports the value of every series nearest to the cursor time while the cursor is shown
+func (c *TrendChart) reportCursor() {
+	if c.OnCursor == nil {
+		return
+	}
+	if readout, ok := c.cursorReadout(c.Size().Width); ok {
+		c.OnCursor(readout)
+	}
+}
+
+// cursorReadout formats the values under the cursor, false while it is hidden
+func (c *TrendChart) cursorReadout(width float32) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	plotWidth := width - chartMarginLeft - chartMarginRight
+	if !c.cursorVisible || plotWidth <= 0 || !c.end.After(c.start) {
+		return "", false
+	}
+	span := c.end.Sub(c.start)
+	at := c.start.Add(time.Duration(float64(span) * float64((c.cursorX-chartMarginLeft)/plotWidth)))
+
+	parts := []string{at.Format("15:04:05")}
+	for _, series := range c.series {
+		if sample, ok := nearestSample(series.Samples, at); ok {
+			parts = append(parts, fmt.Sprintf("%s = %g", series.Name, sample.Value))
+		}
+	}
+	return strings.Join(parts, "   "), true
+}
+
+// nearestSample finds the sample closest in time to at in a chronological slice
+func nearestSample(samples []nexus_modbus.Sample, at time.Time) (nexus_modbus.Sample, bool) {
+	if len(samples) == 0 {
+		return nexus_modbus.Sample{}, false
+	}
+	best := samples[0]
+	for _, sample := range samples[1:] {
+		if absDuration(sample.Time.Sub(at)) < absDuration(best.Time.Sub(at)) {
+			best = sample
+		}
+	}
+	return best, true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// CreateRenderer implements fyne.Widget
+func (c *TrendChart) CreateRenderer() fyne.WidgetRenderer {
+	r := &trendChartRenderer{chart: c, background: canvas.NewRectangle(theme.InputBackgroundColor())}
+	r.rebuild(c.Size())
+	return r
+}
+
+type trendChartRenderer struct {
+	chart      *TrendChart
+	background *canvas.Rectangle
+	objects    []fyne.CanvasObject
+}
+
+func (r *trendChartRenderer) Layout(size fyne.Size) {
+	r.rebuild(size)
+}
+
+func (r *trendChartRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(300, 200)
+}
+
+func (r *trendChartRenderer) Refresh() {
+	r.rebuild(r.chart.Size())
+	canvas.Refresh(r.chart)
+}
+
+func (r *trendChartRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *trendChartRenderer) Destroy() {}
+
+// rebuild recreates the axes, labels and lines for the current data and size
+func (r *trendChartRenderer) rebuild(size fyne.Size) {
+	c := r.chart
+	c.mu.Lock()
+	allSeries, start, end := c.series, c.start, c.end
+	cursorX, cursorVisible := c.cursorX, c.cursorVisible
+	c.mu.Unlock()
+
+	r.background.FillColor = theme.InputBackgroundColor()
+	r.background.Resize(size)
+	objects := []fyne.CanvasObject{r.background}
+
+	plotLeft := float32(chartMarginLeft)
+	plotTop := float32(chartMarginTop)
+	plotRight := size.Width - chartMarginRight
+	plotBottom := size.Height - chartMarginBottom
+	if plotRight <= plotLeft || plotBottom <= plotTop {
+		r.objects = objects
+		return
+	}
+
+	// Auto-scale the value axis to the visible samples with a small margin
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, series := range allSeries {
+		for _, sample := range series.Samples {
+			minValue = math.Min(minValue, sample.Value)
+			maxValue = math.Max(maxValue, sample.Value)
+		}
+	}
+	if math.IsInf(minValue, 1) {
+		minValue, maxValue = 0, 1
+	}
+	if maxValue == minValue {
+		minValue--
+		maxValue++
+	}
+	padding := (maxValue - minValue) * 0.05
+	minValue -= padding
+	maxValue += padding
+
+	span := end.Sub(start)
+	if span <= 0 {
+		span = time.Second
+	}
+	toX := func(t time.Time) float32 {
+		return plotLeft + (plotRight-plotLeft)*float32(float64(t.Sub(start))/float64(span))
+	}
+	toY := func(v float64) float32 {
+		return plotBottom - (plotBottom-plotTop)*float32((v-minValue)/(maxValue-minValue))
+	}
+
+	// Horizontal grid lines with value labels
+	const gridLines = 4
+	for i := 0; i <= gridLines; i++ {
+		value := minValue + (maxValue-minValue)*float64(i)/gridLines
+		y := toY(value)
+
+		grid := canvas.NewLine(theme.ShadowColor())
+		grid.Position1 = fyne.NewPos(plotLeft, y)
+		grid.Position2 = fyne.NewPos(plotRight, y)
+		objects = append(objects, grid)
+
+		label := canvas.NewText(fmt.Sprintf("%.4g", value), theme.ForegroundColor())
+		label.TextSize = 11
+		label.Alignment = fyne.TextAlignTrailing
+		label.Move(fyne.NewPos(0, y-8))
+		label.Resize(fyne.NewSize(plotLeft-6, 16))
+		objects = append(objects, label)
+	}
+
+	// Axes
+	xAxis := canvas.NewLine(theme.ForegroundColor())
+	xAxis.Position1 = fyne.NewPos(plotLeft, plotBottom)
+	xAxis.Position2 = fyne.NewPos(plotRight, plotBottom)
+	yAxis := canvas.NewLine(theme.ForegroundColor())
+	yAxis.Position1 = fyne.NewPos(plotLeft, plotTop)
+	yAxis.Position2 = fyne.NewPos(plotLeft, plotBottom)
+	objects = append(objects, xAxis, yAxis)
+
+	// Time labels at both ends of the window
+	startLabel := canvas.NewText(start.Format("15:04:05"), theme.ForegroundColor())
+	startLabel.TextSize = 11
+	startLabel.Move(fyne.NewPos(plotLeft, plotBottom+4))
+	endLabel := canvas.NewText(end.Format("15:04:05"), theme.ForegroundColor())
+	endLabel.TextSize = 11
+	endLabel.Alignment = fyne.TextAlignTrailing
+	endLabel.Move(fyne.NewPos(plotRight-80, plotBottom+4))
+	endLabel.Resize(fyne.NewSize(80, 16))
+	objects = append(objects, startLabel, endLabel)
+
+	// Series lines, thinned to roughly one point per pixel column
+	maxPoints := int(plotRight - plotLeft)
+	for i, series := range allSeries {
+		samples := series.Samples
+		step := 1
+		if maxPoints > 0 && len(samples) > maxPoints {
+			step = (len(samples) + maxPoints - 1) / maxPoints
+		}
+		var previous *fyne.Position
+		for j := 0; j < len(samples); j += step {
+			if samples[j].Time.Before(start) {
+				continue
+			}
+			point := fyne.NewPos(toX(samples[j].Time), toY(samples[j].Value))
+			if previous != nil {
+				line := canvas.NewLine(SeriesColor(i))
+				line.StrokeWidth = 2
+				line.Position1 = *previous
+				line.Position2 = point
+				objects = append(objects, line)
+			}
+			previous = &point
+		}
+	}
+
+	if cursorVisible {
+		cursor := canvas.NewLine(theme.PrimaryColor())
+		cursor.Position1 = fyne.NewPos(cursorX, plotTop)
+		cursor.Position2 = fyne.NewPos(cursorX, plotBottom)
+		objects = append(objects, cursor)
+	}
+
+	r.objects = objects
+}
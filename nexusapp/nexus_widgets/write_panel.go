@@ -0,0 +1,263 @@
+package nexus_widgets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// WriteFunc sends a write request of a scanner. Registers returned by FC23 are decoded with
+// the data type and byte order used for the written values.
+type WriteFunc func(request nexus_modbus.WriteRequest, dataType nexus_modbus.DataType, byteOrder nexus_modbus.ByteOrder)
+
+// NewWritePanel builds the write inputs for FC5, FC6, FC15, FC16, FC22 and FC23. Invalid inputs
+// are passed to onError, valid requests to write. The inputs are added to settings.
+func NewWritePanel(settings *Settings, onError func(message string), write WriteFunc) fyne.CanvasObject {
+	writeFunction := 6
+
+	writeRegisterEntry := widget.NewEntry()
+	writeRegisterEntry.SetPlaceHolder("Address")
+
+	writeValueEntry := widget.NewEntry()
+	writeValueEntry.SetPlaceHolder("Value to write (e.g., 1234)")
+
+	dataTypes := make([]string, len(nexus_modbus.DataTypes))
+	for i, dataType := range nexus_modbus.DataTypes {
+		dataTypes[i] = string(dataType)
+	}
+	writeTypeSelect := widget.NewSelect(dataTypes, nil)
+	writeTypeSelect.SetSelected(string(nexus_modbus.TypeUint16))
+
+	byteOrders := make([]string, len(nexus_modbus.ByteOrders))
+	for i, order := range nexus_modbus.ByteOrders {
+		byteOrders[i] = string(order)
+	}
+	writeOrderSelect := widget.NewSelect(byteOrders, nil)
+	writeOrderSelect.SetSelected(string(nexus_modbus.OrderABCD))
+
+	andMaskEntry := widget.NewEntry()
+	andMaskEntry.SetPlaceHolder("AND mask (e.g., 0xFF00)")
+	orMaskEntry := widget.NewEntry()
+	orMaskEntry.SetPlaceHolder("OR mask (e.g., 0x0012)")
+
+	readAddressEntry := widget.NewEntry()
+	readAddressEntry.SetPlaceHolder("Read address")
+	readCountEntry := widget.NewEntry()
+	readCountEntry.SetPlaceHolder("Read count")
+
+	typeRow := container.NewGridWithColumns(2, writeTypeSelect, writeOrderSelect)
+	maskRow := container.NewGridWithColumns(2, andMaskEntry, orMaskEntry)
+	readRow := container.NewGridWithColumns(2, readAddressEntry, readCountEntry)
+
+	writeFunctionSelect := widget.NewSelect(nexus_modbus.WriteFunctions, func(s string) {
+		code, err := strconv.Atoi(strings.SplitN(s, ":", 2)[0])
+		if err != nil {
+			return
+		}
+		writeFunction = code
+
+		// Only show the inputs the selected function code uses
+		switch code {
+		case 5:
+			writeValueEntry.SetPlaceHolder("Coil state (1/0 or on/off)")
+		case 15:
+			writeValueEntry.SetPlaceHolder("Coil states (e.g., 1,0,1,1)")
+		case 6:
+			writeValueEntry.SetPlaceHolder("Value to write (e.g., 1234)")
+		default:
+			writeValueEntry.SetPlaceHolder("Values to write (e.g., 1.5, 2.5)")
+		}
+		if code == 22 {
+			writeValueEntry.Hide()
+			maskRow.Show()
+		} else {
+			writeValueEntry.Show()
+			maskRow.Hide()
+		}
+		if code == 6 || code == 16 || code == 23 {
+			typeRow.Show()
+		} else {
+			typeRow.Hide()
+		}
+		if code == 23 {
+			readRow.Show()
+		} else {
+			readRow.Hide()
+		}
+	})
+	writeFunctionSelect.SetSelected("6: Write Single Register")
+	settings.Select("writeFunction", writeFunctionSelect)
+	settings.Entry("writeAddress", writeRegisterEntry)
+	settings.Select("writeDataType", writeTypeSelect)
+	settings.Select("writeByteOrder", writeOrderSelect)
+
+	// Button to trigger the write operation
+	writeButton := widget.NewButtonWithIcon("Write", theme.ConfirmIcon(), func() {
+		request, err := BuildWriteRequest(writeFunction, writeRegisterEntry.Text, writeValueEntry.Text,
+			nexus_modbus.DataType(writeTypeSelect.Selected), nexus_modbus.ByteOrder(writeOrderSelect.Selected),
+			andMaskEntry.Text, orMaskEntry.Text, readAddressEntry.Text, readCountEntry.Text)
+		if err != nil {
+			onError(err.Error())
+			return
+		}
+
+		// The write waits on the poller queue for a running poll, scanning goes on after it
+		go write(request, nexus_modbus.DataType(writeTypeSelect.Selected), nexus_modbus.ByteOrder(writeOrderSelect.Selected))
+	})
+
+	return container.NewVBox(
+		container.NewGridWithColumns(3, writeFunctionSelect, writeRegisterEntry, writeValueEntry),
+		typeRow,
+		maskRow,
+		readRow,
+		writeButton,
+	)
+}
+
+// BuildWriteRequest validates the write panel inputs for the selected function code
+func BuildWriteRequest(functionCode int, addressText, valueText string, dataType nexus_modbus.DataType,
+	byteOrder nexus_modbus.ByteOrder, andMaskText, orMaskText, readAddressText, readCountText string) (nexus_modbus.WriteRequest, error) {
+	var request nexus_modbus.WriteRequest
+
+	address, err := strconv.Atoi(addressText)
+	if err != nil || address < 0 || address > 65535 {
+		return request, fmt.Errorf("Invalid register address: %s", addressText)
+	}
+
+	switch functionCode {
+	case 5, 15:
+		coils, err := nexus_modbus.ParseCoils(valueText)
+		if err != nil {
+			return request, fmt.Errorf("Invalid value: %v", err)
+		}
+		if functionCode == 5 && len(coils) != 1 {
+			return request, fmt.Errorf("Write Single Coil takes exactly one value, use FC15 for more")
+		}
+		request = nexus_modbus.NewCoilWrite(uint16(address), coils, functionCode == 15)
+	case 6, 16, 23:
+		data, err := nexus_modbus.ParseRegisterValues(valueText, dataType, byteOrder)
+		if err != nil {
+			return request, fmt.Errorf("Invalid value: %v", err)
+		}
+		if functionCode == 6 && len(data) != 2 {
+			return request, fmt.Errorf("Write Single Register takes one 16-bit value, use FC16 for %s", dataType)
+		}
+		request = nexus_modbus.NewRegisterWrite(uint16(address), data, functionCode != 6)
+		request.FunctionCode = functionCode
+
+		if functionCode == 23 {
+			readAddress, err := strconv.Atoi(readAddressText)
+			if err != nil || readAddress < 0 || readAddress > 65535 {
+				return request, fmt.Errorf("Invalid read address: %s", readAddressText)
+			}
+			readCount, err := strconv.Atoi(readCountText)
+			if err != nil || readCount < 1 || readCount > 125 {
+				return request, fmt.Errorf("Invalid read count (1-125): %s", readCountText)
+			}
+			request.ReadAddress = uint16(readAddress)
+			request.ReadQuantity = uint16(readCount)
+		}
+	case 22:
+		andMask, err := nexus_modbus.ParseNumber(andMaskText)
+		if err != nil || andMask < 0 || andMask > 0xFFFF {
+			return request, fmt.Errorf("Invalid AND mask: %s", andMaskText)
+		}
+		orMask, err := nexus_modbus.ParseNumber(orMaskText)
+		if err != nil || orMask < 0 || orMask > 0xFFFF {
+			return request, fmt.Errorf("Invalid OR mask: %s", orMaskText)
+		}
+		request = nexus_modbus.WriteRequest{
+			FunctionCode: 22,
+			Address:      uint16(address),
+			AndMask:      uint16(andMask),
+			OrMask:       uint16(orMask),
+		}
+	default:
+		return request, fmt.Errorf("Invalid write function code %d", functionCode)
+	}
+	if err := request.Validate(); err != nil {
+		return request, fmt.Errorf("Invalid write: %v", err)
+	}
+	return request, nil
+}
+
+// ShowRowWriteDialog asks for a new value of a register table row and writes it with the function
+// code of its table: FC5 for a coil, FC6 for one register and FC16 for longer values. Plain
+// registers are encoded with the data type and byte order they were decoded with.
+func ShowRowWriteDialog(window fyne.Window, row RegisterRow, dataType nexus_modbus.DataType, byteOrder nexus_modbus.ByteOrder,
+	onError func(message string), write WriteFunc) {
+	title := row.AddressText()
+	if row.Name != "" {
+		title = row.Name
+	}
+	valueEntry := widget.NewEntry()
+	valueEntry.SetText(row.Value)
+	items := []*widget.FormItem{widget.NewFormItem("Value", valueEntry)}
+	if row.Unit != "" {
+		items = append(items, widget.NewFormItem("Unit", widget.NewLabel(row.Unit)))
+	}
+
+	dialog.ShowForm("Write "+title, "Write", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		request, err := RowWriteRequest(row, valueEntry.Text, dataType, byteOrder)
+		if err != nil {
+			onError(err.Error())
+			return
+		}
+
+		// The write waits on the poller queue, the next poll shows the new value
+		go write(request, dataType, byteOrder)
+	}, window)
+}
+
+// RowWriteRequest encodes the value typed for a table row. Profile points use their own type,
+// scale and labels, plain registers the data type and byte order they were decoded with.
+func RowWriteRequest(row RegisterRow, text string, dataType nexus_modbus.DataType, byteOrder nexus_modbus.ByteOrder) (nexus_modbus.WriteRequest, error) {
+	if row.Point != nil {
+		request, err := nexus_modbus.EncodePoint(*row.Point, text)
+		if err != nil {
+			return request, fmt.Errorf("Invalid value: %v", err)
+		}
+		return request, nil
+	}
+	if row.FunctionCode == 1 {
+		return BuildWriteRequest(5, strconv.Itoa(row.Address), text, dataType, byteOrder, "", "", "", "")
+	}
+
+	data, err := nexus_modbus.ParseRegisterValues(text, dataType, byteOrder)
+	if err != nil {
+		return nexus_modbus.WriteRequest{}, fmt.Errorf("Invalid value: %v", err)
+	}
+	if dataType == nexus_modbus.TypeString {
+		// Fill the registers the text was read from so no old characters remain
+		if size := len(row.Raw) / 2; len(data) < size {
+			data = append(data, make([]byte, size-len(data))...)
+		}
+	} else if len(data) != 2*dataType.Registers() {
+		return nexus_modbus.WriteRequest{}, fmt.Errorf("Invalid value: enter one %s value", dataType)
+	}
+	return nexus_modbus.NewRegisterWrite(uint16(row.Address), data, false), nil
+}
+
+// WriteResultText reports a successful write, with the registers read back by FC23
+func WriteResultText(request nexus_modbus.WriteRequest, results []byte, dataType nexus_modbus.DataType, byteOrder nexus_modbus.ByteOrder) string {
+	message := fmt.Sprintf("Write successful! (FC%d to address %d)", request.FunctionCode, request.Address)
+	if request.FunctionCode == 23 {
+		var values []string
+		for _, value := range nexus_modbus.Decode(results, dataType, byteOrder) {
+			values = append(values, fmt.Sprintf("%d: %s", int(request.ReadAddress)+value.Offset, value.Text))
+		}
+		message += " Read " + strings.Join(values, ", ")
+	}
+	return message
+}
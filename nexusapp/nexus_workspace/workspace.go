@@ -0,0 +1,261 @@
+package nexus_workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+
+	"nexusapp/nexus_widgets"
+)
+
+// workspaceVersion is written to every workspace file, for files of later versions to be told apart
+const workspaceVersion = 1
+
+// maxRecent is the number of workspace files kept in the recent list
+const maxRecent = 8
+
+// Preference keys of the last session and the recent workspace files
+const (
+	prefLastSession = "workspace.lastSession"
+	prefRecent      = "workspace.recent" // Paths separated by newlines
+)
+
+// WindowLayout is the size of the main window and its selected tab
+type WindowLayout struct {
+	Width  float32 `json:"width"`
+	Height float32 `json:"height"`
+	Tab    string  `json:"tab"`
+}
+
+// Workspace is the saved connection, scan and decode settings of every tab and the window layout
+type Workspace struct {
+	Version int                          `json:"version"`
+	Window  WindowLayout                 `json:"window"`
+	Tabs    map[string]map[string]string `json:"tabs"` // Settings of each tab by tab name
+}
+
+// Parse reads a workspace from JSON
+func Parse(data []byte) (*Workspace, error) {
+	workspace := &Workspace{}
+	if err := json.Unmarshal(data, workspace); err != nil {
+		return nil, err
+	}
+	if workspace.Version > workspaceVersion {
+		return nil, fmt.Errorf("workspace version %d needs a newer Nexus Scanner", workspace.Version)
+	}
+	return workspace, nil
+}
+
+// Load reads a workspace file
+func Load(path string) (*Workspace, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return workspace, nil
+}
+
+// Save writes the workspace to a file
+func (w *Workspace) Save(path string) error {
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Manager saves and restores the workspace of the main window, through the File menu
+// and the last session kept in the app preferences
+type Manager struct {
+	app      fyne.App
+	window   fyne.Window
+	tabs     *container.AppTabs
+	settings map[string]*nexus_widgets.Settings // By tab name
+	path     string                             // File last opened or saved, empty until then
+}
+
+// NewManager creates the workspace manager of a window with the given tabs and their settings
+func NewManager(app fyne.App, window fyne.Window, tabs *container.AppTabs, settings map[string]*nexus_widgets.Settings) *Manager {
+	return &Manager{app: app, window: window, tabs: tabs, settings: settings}
+}
+
+// Capture returns the current workspace
+func (m *Manager) Capture() *Workspace {
+	size := m.window.Canvas().Size()
+	workspace := &Workspace{
+		Version: workspaceVersion,
+		Window:  WindowLayout{Width: size.Width, Height: size.Height},
+		Tabs:    make(map[string]map[string]string),
+	}
+	if selected := m.tabs.Selected(); selected != nil {
+		workspace.Window.Tab = selected.Text
+	}
+	for name, settings := range m.settings {
+		workspace.Tabs[name] = settings.Values()
+	}
+	return workspace
+}
+
+// Apply restores a workspace. Tabs and settings missing from it keep their current values.
+func (m *Manager) Apply(workspace *Workspace) {
+	for name, values := range workspace.Tabs {
+		if settings, ok := m.settings[name]; ok {
+			settings.Restore(values)
+		}
+	}
+	if workspace.Window.Width > 0 && workspace.Window.Height > 0 {
+		m.window.Resize(fyne.NewSize(workspace.Window.Width, workspace.Window.Height))
+	}
+	for _, tab := range m.tabs.Items {
+		if tab.Text == workspace.Window.Tab {
+			m.tabs.Select(tab)
+		}
+	}
+}
+
+// Open restores the workspace saved in a file and adds the file to the recent list
+func (m *Manager) Open(path string) error {
+	workspace, err := Load(path)
+	if err != nil {
+		return err
+	}
+	m.Apply(workspace)
+	m.setPath(path)
+	return nil
+}
+
+// Save writes the current workspace to a file and adds the file to the recent list
+func (m *Manager) Save(path string) error {
+	if err := m.Capture().Save(path); err != nil {
+		return err
+	}
+	m.setPath(path)
+	return nil
+}
+
+// setPath makes path the current workspace file and the first recent one
+func (m *Manager) setPath(path string) {
+	m.path = path
+	m.window.SetTitle("Nexus Scanner - " + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+
+	recent := []string{path}
+	for _, other := range m.Recent() {
+		if other != path && len(recent) < maxRecent {
+			recent = append(recent, other)
+		}
+	}
+	m.app.Preferences().SetString(prefRecent, strings.Join(recent, "\n"))
+	m.window.SetMainMenu(m.MainMenu())
+}
+
+// Recent returns the workspace files last opened or saved, most recent first
+func (m *Manager) Recent() []string {
+	text := m.app.Preferences().String(prefRecent)
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// SaveSession keeps the current workspace in the app preferences, to restore at the next start
+func (m *Manager) SaveSession() {
+	data, err := json.Marshal(m.Capture())
+	if err != nil {
+		return
+	}
+	m.app.Preferences().SetString(prefLastSession, string(data))
+}
+
+// RestoreSession restores the workspace kept by SaveSession, if any
+func (m *Manager) RestoreSession() {
+	data := m.app.Preferences().String(prefLastSession)
+	if data == "" {
+		return
+	}
+	if workspace, err := Parse([]byte(data)); err == nil {
+		m.Apply(workspace)
+	}
+}
+
+// MainMenu builds the File menu with the workspace actions and the recent workspace files
+func (m *Manager) MainMenu() *fyne.MainMenu {
+	openItem := fyne.NewMenuItem("Open Workspace...", m.showOpenDialog)
+	saveItem := fyne.NewMenuItem("Save Workspace", func() {
+		if m.path == "" {
+			m.showSaveDialog()
+			return
+		}
+		if err := m.Save(m.path); err != nil {
+			dialog.ShowError(err, m.window)
+		}
+	})
+	saveAsItem := fyne.NewMenuItem("Save Workspace As...", m.showSaveDialog)
+
+	recentItem := fyne.NewMenuItem("Recent Workspaces", nil)
+	var recentItems []*fyne.MenuItem
+	for _, path := range m.Recent() {
+		path := path
+		recentItems = append(recentItems, fyne.NewMenuItem(path, func() {
+			if err := m.Open(path); err != nil {
+				dialog.ShowError(err, m.window)
+			}
+		}))
+	}
+	if len(recentItems) == 0 {
+		none := fyne.NewMenuItem("No recent workspaces", nil)
+		none.Disabled = true
+		recentItems = append(recentItems, none)
+	}
+	recentItem.ChildMenu = fyne.NewMenu("", recentItems...)
+
+	// Fyne adds Quit to the first menu
+	fileMenu := fyne.NewMenu("File", openItem, recentItem, fyne.NewMenuItemSeparator(), saveItem, saveAsItem)
+	return fyne.NewMainMenu(fileMenu)
+}
+
+func (m *Manager) showOpenDialog() {
+	openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, m.window)
+			return
+		}
+		if reader == nil {
+			return // Cancelled
+		}
+		reader.Close()
+		if err := m.Open(reader.URI().Path()); err != nil {
+			dialog.ShowError(err, m.window)
+		}
+	}, m.window)
+	openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+	openDialog.Show()
+}
+
+func (m *Manager) showSaveDialog() {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, m.window)
+			return
+		}
+		if writer == nil {
+			return // Cancelled
+		}
+		writer.Close()
+		if err := m.Save(writer.URI().Path()); err != nil {
+			dialog.ShowError(fmt.Errorf("Failed to save workspace: %v", err), m.window)
+		}
+	}, m.window)
+	saveDialog.SetFileName("workspace.json")
+	saveDialog.Show()
+}
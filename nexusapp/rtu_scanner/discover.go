@@ -0,0 +1,131 @@
+package modbus_scanner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/goburrow/modbus"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
+)
+
+// discoveredDevice describes a slave that answered a discovery probe
+type discoveredDevice struct {
+	slaveId       byte
+	responseTime  time.Duration
+	exceptionCode byte // 0 when the probe read succeeded
+}
+
+// discoverDevices probes every slave ID from first to last over conn with a single-item read
+// of the function code and register. Every unit that answers, with data or with an exception,
+// is passed to found. The sweep returns early when ctx is cancelled.
+func discoverDevices(ctx context.Context, conn nexus_modbus.Transport, timing nexus_modbus.Timing, functionCode, register, first, last int,
+	found func(discoveredDevice), progress func(done, total int)) error {
+	total := last - first + 1
+	for id := first; id <= last && ctx.Err() == nil; id++ {
+		var start time.Time
+		err := conn.Do(ctx, byte(id), timing, func(handler modbus.ClientHandler) error {
+			start = time.Now()
+			_, err := nexus_modbus.ReadItems(modbus.NewClient(handler), functionCode, uint16(register), 1)
+			return err
+		})
+		elapsed := time.Since(start)
+
+		if _, ok := err.(*nexus_modbus.PortError); ok {
+			return err
+		}
+		if err == nil {
+			found(discoveredDevice{slaveId: byte(id), responseTime: elapsed})
+		} else if mbErr, ok := err.(*modbus.ModbusError); ok {
+			// An exception still proves a device is listening on this ID
+			found(discoveredDevice{slaveId: byte(id), responseTime: elapsed, exceptionCode: mbErr.ExceptionCode})
+		}
+		progress(id-first+1, total)
+	}
+	return nil
+}
+
+// showDiscoverDialog opens the bus discovery window for the selected port. The probe reads the
+// function code and start register of the form.
+func (ms *ModbusRTUScanner) showDiscoverDialog() {
+	firstIdEntry := widget.NewEntry()
+	firstIdEntry.SetText("1")
+	lastIdEntry := widget.NewEntry()
+	lastIdEntry.SetText("247")
+	probeTimeoutEntry := widget.NewEntry()
+	probeTimeoutEntry.SetText("100")
+
+	rangeGrid := container.NewGridWithColumns(3,
+		container.NewVBox(widget.NewLabel("First Slave ID"), firstIdEntry),
+		container.NewVBox(widget.NewLabel("Last Slave ID"), lastIdEntry),
+		container.NewVBox(widget.NewLabel("Probe Timeout (ms)"), probeTimeoutEntry),
+	)
+
+	nexus_widgets.NewSweepDialog(ms.window, nexus_widgets.SweepConfig{
+		Title:     "Discover Devices",
+		Form:      rangeGrid,
+		StartText: "Discover",
+		Columns:   []string{"Slave ID", "Response Time", "Exception"},
+		Widths:    []float32{100, 140, 100},
+		Hint:      "Click a device to load its ID into the scanner",
+		Size:      fyne.NewSize(520, 560),
+		Start: func() (nexus_widgets.SweepFunc, error) {
+			first, err := strconv.Atoi(firstIdEntry.Text)
+			if err != nil || first < 1 || first > 247 {
+				return nil, fmt.Errorf("Invalid first slave ID: %s", firstIdEntry.Text)
+			}
+			last, err := strconv.Atoi(lastIdEntry.Text)
+			if err != nil || last < first || last > 247 {
+				return nil, fmt.Errorf("Invalid last slave ID: %s", lastIdEntry.Text)
+			}
+			timeoutMs, err := strconv.Atoi(probeTimeoutEntry.Text)
+			if err != nil || timeoutMs <= 0 {
+				return nil, fmt.Errorf("Invalid probe timeout: %s", probeTimeoutEntry.Text)
+			}
+
+			// The discovery sweep needs the port to itself
+			ms.stopScan()
+
+			conn := ms.connection()
+			timing := ms.timing
+			timing.Timeout = time.Duration(timeoutMs) * time.Millisecond
+			functionCode, register := ms.read.FunctionCode, ms.read.Address
+
+			return func(ctx context.Context, run *nexus_widgets.SweepRun) string {
+				run.SetStatus(fmt.Sprintf("Probing slave IDs %d-%d on %s...", first, last, conn.Name()))
+				err := discoverDevices(ctx, conn, timing, functionCode, register, first, last,
+					func(device discoveredDevice) { run.Add(device) }, run.Progress)
+				switch {
+				case err != nil:
+					return nexus_modbus.Classify(err).Describe()
+				case ctx.Err() != nil:
+					return fmt.Sprintf("Discovery cancelled, %d device(s) found", run.Count())
+				}
+				return fmt.Sprintf("Discovery finished, %d device(s) found", run.Count())
+			}, nil
+		},
+		Cell: func(row interface{}, col int) string {
+			device := row.(discoveredDevice)
+			switch col {
+			case 0:
+				return strconv.Itoa(int(device.slaveId))
+			case 1:
+				return device.responseTime.Round(time.Millisecond).String()
+			}
+			if device.exceptionCode == 0 {
+				return "-"
+			}
+			return fmt.Sprintf("0x%02X", device.exceptionCode)
+		},
+		OnSelect: func(row interface{}) {
+			// Load the selected ID back into the scanner form
+			ms.slaveIdEntry.SetText(strconv.Itoa(int(row.(discoveredDevice).slaveId)))
+		},
+	}).Show()
+}
@@ -3,61 +3,74 @@ package modbus_scanner
 import (
 	"fmt"
 	"strconv"
-	"time"
+	"strings"
+	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
 )
 
 type ModbusRTUScanner struct {
+	transport          nexus_modbus.TransportKind
+	address            string // host:port of the network transports
 	serialPort         string
 	baudRate           int
 	dataBits           int
 	parity             string
 	stopBits           int
 	slaveId            byte
-	timeout            time.Duration
-	startRegister      int
-	numRegisters       int
-	functionCode       int
+	timing             nexus_modbus.Timing // Poll interval, response timeout, frame delay and retries
 	writeRegisterEntry int
+	read               nexus_widgets.ScanForm // Register range or profile points
+
+	scanner *nexus_widgets.Scanner // Polls, writes and identifies the slave one request at a time
+
+	slaveIdEntry   *widget.Entry // Kept so discovery can load a found ID
+	baudRateSelect *widget.Select
+	paritySelect   *widget.Select
+	stopBitsEntry  *widget.Entry
 
-	resultLabel1 *widget.Label // First result label
-	resultLabel2 *widget.Label // Second result label
-	resultLabel3 *widget.Label // Third result label
-	resultLabel4 *widget.Label
-
-	writeLabel *widget.Label
-	errorLabel *widget.Label // Label for error messages
-	app        fyne.App
-	window     fyne.Window
-	scanning   bool // Flag to control scanning
-	stopChan   chan struct{}
-	spinner    *widget.ProgressBarInfinite
+	app         fyne.App
+	window      fyne.Window
+	pauseButton *widget.Button // Shows Resume while the poller is paused
+
+	history     *nexus_modbus.History // Recent values of every polled point
+	trendWindow fyne.Window
+	recorderMu  sync.Mutex             // Guards recorder, written to by the poller
+	recorder    *nexus_modbus.Recorder // Set while poll results are logged to file
+
+	settings    *nexus_widgets.Settings // Inputs saved with the workspace
+	trendMu     sync.Mutex              // Guards trendPoints, read by the chart's redraw ticker
+	trendPoints []string                // Points shown in the trend window, saved as the watch list
 }
 
 func (ms *ModbusRTUScanner) createUI() fyne.CanvasObject {
-	// List of COM ports from COM1 to COM20
-	comPorts := make([]string, 20)
-	for i := 1; i <= 20; i++ {
-		comPorts[i-1] = fmt.Sprintf("COM%d", i)
-	}
-
-	// COM Port selection dropdown
-	portSelect := widget.NewSelect(comPorts, func(s string) {
-		ms.serialPort = s
+	// Serial ports present on the machine, refreshed as adapters are plugged in
+	portSelect := nexus_widgets.NewPortSelect(func(path string) {
+		ms.serialPort = path
+		ms.formChanged()
 	})
-	portSelect.SetSelected("COM1") // Set default to COM1
+	ms.settings.Add("port", portSelect.Path, portSelect.SetPath)
+
+	baudRates := make([]string, len(nexus_modbus.BaudRates))
+	for i, baudRate := range nexus_modbus.BaudRates {
+		baudRates[i] = strconv.Itoa(baudRate)
+	}
 
-	baudRateSelect := widget.NewSelect([]string{"1200", "2400", "4800", "9600", "19200", "38400", "57600", "115200"}, func(s string) {
+	ms.baudRateSelect = widget.NewSelect(baudRates, func(s string) {
 		baudRate, err := strconv.Atoi(s)
 		if err == nil {
 			ms.baudRate = baudRate
+			ms.formChanged()
 		}
 	})
-	baudRateSelect.SetSelected("9600") // Set default value
+	ms.baudRateSelect.SetSelected("9600") // Set default value
+	ms.settings.Select("baudRate", ms.baudRateSelect)
 
 	dataBitsEntry := widget.NewEntry()
 	dataBitsEntry.SetPlaceHolder("Data Bits (e.g., 8)")
@@ -65,8 +78,10 @@ func (ms *ModbusRTUScanner) createUI() fyne.CanvasObject {
 		dataBits, err := strconv.Atoi(s)
 		if err == nil {
 			ms.dataBits = dataBits
+			ms.formChanged()
 		}
 	}
+	ms.settings.Entry("dataBits", dataBitsEntry)
 	parityOptions := map[string]string{
 		"None": "N",
 		"Even": "E",
@@ -76,77 +91,54 @@ func (ms *ModbusRTUScanner) createUI() fyne.CanvasObject {
 	parityDisplayOptions := []string{"None", "Even", "Odd"}
 
 	// Parity selection dropdown
-	paritySelect := widget.NewSelect(parityDisplayOptions, func(s string) {
+	ms.paritySelect = widget.NewSelect(parityDisplayOptions, func(s string) {
 		// Retrieve the corresponding single-letter value
 		ms.parity = parityOptions[s]
+		ms.formChanged()
 	})
-	paritySelect.SetSelected("Even") // Set default to "Even"
+	ms.paritySelect.SetSelected("Even") // Set default to "Even"
+	ms.settings.Select("parity", ms.paritySelect)
 
-	stopBitsEntry := widget.NewEntry()
-	stopBitsEntry.SetPlaceHolder("Stop Bits (1 or 2)")
-	stopBitsEntry.OnChanged = func(s string) {
+	ms.stopBitsEntry = widget.NewEntry()
+	ms.stopBitsEntry.SetPlaceHolder("Stop Bits (1 or 2)")
+	ms.stopBitsEntry.OnChanged = func(s string) {
 		stopBits, err := strconv.Atoi(s)
 		if err == nil {
 			ms.stopBits = stopBits
+			ms.formChanged()
 		}
 	}
+	ms.settings.Entry("stopBits", ms.stopBitsEntry)
 
-	slaveIdEntry := widget.NewEntry()
-	slaveIdEntry.SetPlaceHolder("Slave ID (e.g., 1)")
-	slaveIdEntry.OnChanged = func(s string) {
+	ms.slaveIdEntry = widget.NewEntry()
+	ms.slaveIdEntry.SetPlaceHolder("Slave ID (e.g., 1)")
+	ms.slaveIdEntry.OnChanged = func(s string) {
 		slaveId, err := strconv.Atoi(s)
 		if err == nil {
 			ms.slaveId = byte(slaveId)
+			ms.formChanged()
 		}
 	}
-
-	timeoutEntry := widget.NewEntry()
-	timeoutEntry.SetPlaceHolder("Timeout (seconds)")
-	timeoutEntry.OnChanged = func(s string) {
-		timeout, err := strconv.Atoi(s)
-		if err == nil {
-			ms.timeout = time.Duration(timeout) * time.Second
-		}
-	}
-
-	startRegisterEntry := widget.NewEntry()
-	startRegisterEntry.SetPlaceHolder("Start Register (e.g., 500)")
-	startRegisterEntry.OnChanged = func(s string) {
-		startRegister, err := strconv.Atoi(s)
-		if err == nil {
-			ms.startRegister = startRegister
-		}
-	}
-
-	numRegistersEntry := widget.NewEntry()
-	numRegistersEntry.SetPlaceHolder("Number of Registers (e.g., 1)")
-	numRegistersEntry.OnChanged = func(s string) {
-		numRegisters, err := strconv.Atoi(s)
-		if err == nil {
-			ms.numRegisters = numRegisters
-		}
-	}
-
-	functionCodeSelect := widget.NewSelect([]string{"1: Read Coils", "2: Read Discrete Inputs", "3: Read Holding Registers", "4: Read Input Registers"}, func(s string) {
-		code, err := strconv.Atoi(s[:1])
-		if err == nil {
-			ms.functionCode = code
+	ms.settings.Entry("slaveId", ms.slaveIdEntry)
+
+	// The watch list is restored before the trend window opens
+	ms.settings.Add("watchList", func() string {
+		return strings.Join(ms.watchedPoints(), "\n")
+	}, func(value string) {
+		var names []string
+		if value != "" {
+			names = strings.Split(value, "\n")
 		}
+		ms.setTrendPoints(names)
 	})
-	functionCodeSelect.SetSelected("3: Read Holding Registers") // Set default value
 
 	// Arrange labels above inputs
-	portContainer := container.NewVBox(widget.NewLabel("COM Port"), portSelect)
-	baudRateContainer := container.NewVBox(widget.NewLabel("Baud Rate"), baudRateSelect)
+	portContainer := container.NewVBox(widget.NewLabel("Serial Port"), portSelect.Select)
+	baudRateContainer := container.NewVBox(widget.NewLabel("Baud Rate"), ms.baudRateSelect)
 	dataBitsContainer := container.NewVBox(widget.NewLabel("Data Bits"), dataBitsEntry)
-	parityContainer := container.NewVBox(widget.NewLabel("Parity"), paritySelect)
-	stopBitsContainer := container.NewVBox(widget.NewLabel("Stop Bits"), stopBitsEntry)
-	slaveIdContainer := container.NewVBox(widget.NewLabel("Slave ID"), slaveIdEntry)
-	timeoutContainer := container.NewVBox(widget.NewLabel("Timeout"), timeoutEntry)
-	startRegisterContainer := container.NewVBox(widget.NewLabel("Start Register"), startRegisterEntry)
-	numRegistersContainer := container.NewVBox(widget.NewLabel("Number of Registers"), numRegistersEntry)
-	functionCodeContainer := container.NewVBox(widget.NewLabel("Function Code"), functionCodeSelect)
-
+	parityContainer := container.NewVBox(widget.NewLabel("Parity"), ms.paritySelect)
+	stopBitsContainer := container.NewVBox(widget.NewLabel("Stop Bits"), ms.stopBitsEntry)
+	slaveIdContainer := container.NewVBox(widget.NewLabel("Slave ID"), ms.slaveIdEntry)
 	// Use Grid layout for better alignment
 	inputGrid := container.NewGridWithColumns(3,
 		portContainer,
@@ -155,116 +147,125 @@ func (ms *ModbusRTUScanner) createUI() fyne.CanvasObject {
 		parityContainer,
 		stopBitsContainer,
 		slaveIdContainer,
-		timeoutContainer,
 	)
 
-	// Use Grid layout for better alignment
-	secondGrid := container.NewGridWithColumns(3,
-		functionCodeContainer,
-		startRegisterContainer,
-		numRegistersContainer,
-	)
+	transportForm := nexus_widgets.NewTransportForm(nexus_modbus.Transports, &ms.transport, &ms.address, ms.settings, ms.formChanged)
+	timingForm := nexus_widgets.NewTimingForm(&ms.timing, true, ms.settings, ms.formChanged)
 
-	ms.resultLabel1 = widget.NewLabel("Result: ")
-	ms.resultLabel2 = widget.NewLabel("")
-	ms.resultLabel3 = widget.NewLabel("")
-	ms.resultLabel4 = widget.NewLabel("")
-	ms.errorLabel = widget.NewLabel("") // Label to display error messages
-	ms.writeLabel = widget.NewLabel("")
-	ms.spinner = widget.NewProgressBarInfinite()
-	ms.spinner.Hide() // Initially hidden until scanning starts
+	readForm := nexus_widgets.NewScanForm(ms.window, &ms.read, "startRegister", "numRegisters", ms.settings, ms.formChanged)
 
 	startButton := widget.NewButtonWithIcon("Start Scan", theme.MediaPlayIcon(), func() {
-		if !ms.scanning {
+		if !ms.scanner.Poller.Running() {
 			ms.startScan()
 		}
 	})
 
 	stopButton := widget.NewButtonWithIcon("Stop Scan", theme.MediaStopIcon(), func() {
-		if ms.scanning {
-			ms.stopScan()
-		}
+		ms.stopScan()
 	})
 
-	// Add new input for writing a register value
-	writeRegisterLabel := widget.NewLabel("Write Register")
-
-	writeRegisterEntry := widget.NewEntry()
-	writeRegisterEntry.SetPlaceHolder("Address")
+	// Pausing keeps the scan settings and the port, resuming polls right away
+	ms.pauseButton = widget.NewButtonWithIcon("Pause", theme.MediaPauseIcon(), func() {
+		switch {
+		case ms.scanner.Poller.Paused():
+			ms.scanner.Poller.Resume()
+			ms.pauseButton.SetText("Pause")
+		case ms.scanner.Poller.Running():
+			ms.scanner.Poller.Pause()
+			ms.pauseButton.SetText("Resume")
+		}
+	})
 
-	writeValueEntry := widget.NewEntry()
-	writeValueEntry.SetPlaceHolder("Value to write (e.g., 1234)")
+	discoverButton := widget.NewButtonWithIcon("Discover Devices", theme.SearchIcon(), func() {
+		ms.showDiscoverDialog()
+	})
 
-	// Button to trigger the write operation
-	writeButton := widget.NewButtonWithIcon("Write Register", theme.ConfirmIcon(), func() {
-		wasScanning := ms.scanning // Store the current scanning state
-		if wasScanning {
-			// Stop the scan temporarily
-			ms.stopScan()
-			time.Sleep(500 * time.Millisecond)
-		}
+	detectButton := widget.NewButtonWithIcon("Detect Settings", theme.SearchIcon(), func() {
+		ms.stopScan()
+		nexus_widgets.ShowSerialDetectDialog(ms.window, ms.serialPort, ms.dataBits, ms.slaveId, ms.applySerialSettings)
+	})
 
-		// Parse the register address
-		register, err := strconv.Atoi(writeRegisterEntry.Text)
-		if err != nil {
-			ms.errorLabel.SetText("Invalid register address: " + writeRegisterEntry.Text)
-			return
-		}
+	mapButton := widget.NewButtonWithIcon("Map Registers", theme.ListIcon(), func() {
+		ms.showRegisterMapDialog()
+	})
 
-		// Parse the value to write
-		value, err := strconv.Atoi(writeValueEntry.Text)
-		if err != nil {
-			ms.errorLabel.SetText("Invalid value: " + writeValueEntry.Text)
-			return
-		}
+	deviceInfoButton := widget.NewButtonWithIcon("Device Info", theme.InfoIcon(), func() {
+		nexus_widgets.ShowDeviceInfoDialog(ms.window, fmt.Sprintf("Device Info (slave %d)", ms.slaveId), ms.scanner.ReadDeviceIdentification)
+	})
 
-		// Call writeRegister with register and value
-		ms.writeRegister(register, value)
+	trendButton := widget.NewButtonWithIcon("Trend", theme.VisibilityIcon(), func() {
+		ms.showTrendWindow()
+	})
 
-		// Restart scanning if it was scanning before
-		if wasScanning {
-			ms.startScan()
-		}
+	statsButton := widget.NewButtonWithIcon("Stats", theme.InfoIcon(), func() {
+		nexus_widgets.ShowStatsDialog(ms.window, "Communication Statistics - RTU Scanner", ms.scanner.Stats)
 	})
 
-	// Use Grid layout for better alignment
-	inputGridWrite := container.NewGridWithColumns(3,
-		writeRegisterEntry,
-		writeValueEntry,
-		writeButton,
-	)
+	// Add new inputs for writing coils and registers
+	writeRegisterLabel := widget.NewLabel("Write")
+	writePanel := nexus_widgets.NewWritePanel(ms.settings, ms.scanner.ShowError, ms.scanner.Write)
 
-	// Container to hold the result labels side by side
-	resultContainer := container.NewHBox(ms.resultLabel1, ms.resultLabel2, ms.resultLabel3, ms.resultLabel4)
+	recordingLabel := widget.NewLabel("Recording")
+	recordingPanel := ms.createRecordingPanel()
 
-	return container.NewVBox(
+	controls := container.NewVBox(
 		widget.NewLabel("Modbus RTU Scanner"),
+		transportForm,
 		inputGrid,
-		secondGrid,
-		container.NewHBox(startButton, stopButton), // Start and Stop buttons side by side
-		writeRegisterLabel,                         // Input for writing value
-		inputGridWrite,                             // Write button
-		ms.spinner,
-		resultContainer,
-		ms.errorLabel, // Display error messages below the valid output
-		ms.writeLabel,
+		readForm,
+		timingForm,
+		container.NewHBox(startButton, stopButton, ms.pauseButton, discoverButton, detectButton, mapButton, deviceInfoButton, trendButton, statsButton), // Scan controls and bus tools side by side
+		writeRegisterLabel, // Input for writing values
+		writePanel,         // Write function, address, values and button
+		recordingLabel,
+		recordingPanel, // Log every poll cycle to rotating CSV or JSONL files
+		ms.scanner.Spinner,
+		ms.scanner.TableButtons(),
 	)
+
+	ms.formChanged()
+
+	// The table takes the space left by the controls and scrolls through long register ranges
+	return container.NewBorder(controls, ms.scanner.Messages(), nil, nil, ms.scanner.Table.Table)
+}
+
+// applySerialSettings loads detected line settings into the form
+func (ms *ModbusRTUScanner) applySerialSettings(settings nexus_modbus.SerialSettings) {
+	ms.baudRateSelect.SetSelected(strconv.Itoa(settings.BaudRate))
+	switch settings.Parity {
+	case "N":
+		ms.paritySelect.SetSelected("None")
+	case "E":
+		ms.paritySelect.SetSelected("Even")
+	case "O":
+		ms.paritySelect.SetSelected("Odd")
+	}
+	ms.stopBitsEntry.SetText(strconv.Itoa(settings.StopBits))
 }
 
-// Show initializes the ModbusRTUScanner and loads its UI into the given window
-func Show(win fyne.Window) fyne.CanvasObject {
+// Show initializes the ModbusRTUScanner and loads its UI into the given window.
+// Its inputs are added to settings.
+func Show(win fyne.Window, settings *nexus_widgets.Settings) fyne.CanvasObject {
 	scanner := &ModbusRTUScanner{
-		window:        win,
-		baudRate:      9600,            // Default Baud Rate
-		dataBits:      8,               // Default Data Bits
-		parity:        "E",             // Default Parity
-		stopBits:      1,               // Default Stop Bits
-		slaveId:       2,               // Default Slave ID
-		timeout:       1 * time.Second, // Default Timeout
-		startRegister: 500,             // Default Start Register
-		numRegisters:  1,               // Default Number of Registers
-		functionCode:  3,               // Default function code (Read Holding Registers)
-		scanning:      false,           // Initial scanning state
+		window:    win,
+		settings:  settings,
+		transport: nexus_modbus.TransportRTU,
+		baudRate:  9600, // Default Baud Rate
+		dataBits:  8,    // Default Data Bits
+		parity:    "E",  // Default Parity
+		stopBits:  1,    // Default Stop Bits
+		slaveId:   2,    // Default Slave ID
+		read: nexus_widgets.ScanForm{
+			FunctionCode: 3,   // Default function code (Read Holding Registers)
+			Address:      500, // Default Start Register
+			Quantity:     1,   // Default Number of Registers
+			DataType:     nexus_modbus.TypeUint16,
+			ByteOrder:    nexus_modbus.OrderABCD,
+		},
+		timing:  nexus_modbus.DefaultTiming(),
+		history: nexus_modbus.NewHistory(historyCapacity(nexus_modbus.DefaultTiming().PollInterval)),
+		scanner: nexus_widgets.NewScanner(win),
 	}
+	scanner.scanner.OnScan = scanner.scanned
 	return scanner.createUI()
 }
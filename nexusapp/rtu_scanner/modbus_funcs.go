@@ -2,154 +2,108 @@ package modbus_scanner
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
-	"github.com/goburrow/modbus"
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
 )
 
-func (ms *ModbusRTUScanner) startScan() {
-	ms.scanning = true
-	ms.stopChan = make(chan struct{})
-	ms.spinner.Show() // Show the spinner when scanning starts
+// formChanged copies the form to the scanner, the inputs call it on the UI thread after every edit
+func (ms *ModbusRTUScanner) formChanged() {
+	transport := ms.transportConfig()
+	ms.scanner.SetTarget(nexus_widgets.ScanTarget{
+		Transport: transport,
+		UnitId:    ms.slaveId,
+		Name:      fmt.Sprintf("%s slave %d", transport.Target(), ms.slaveId),
+		Timing:    ms.timing,
+		Scan:      ms.read.Config(),
+	})
+}
 
-	go func() {
-		for {
-			select {
-			case <-ms.stopChan:
-				ms.scanning = false
-				ms.spinner.Hide() // Hide the spinner when scanning stops
-				return
-			default:
-				ms.scan()
-				time.Sleep(2 * time.Second) // Adjust the scanning interval as needed
-			}
-		}
-	}()
+// startScan starts polling the configured registers until stopScan
+func (ms *ModbusRTUScanner) startScan() {
+	ms.pauseButton.SetText("Pause")
+	ms.scanner.Start()
 }
 
+// stopScan stops polling, abandoning a read in flight
 func (ms *ModbusRTUScanner) stopScan() {
-	if ms.scanning {
-		ms.stopChan <- struct{}{}
-		ms.scanning = false
-	}
+	ms.scanner.Stop()
+	ms.pauseButton.SetText("Pause")
 }
 
-func (ms *ModbusRTUScanner) scan() {
-	handler := modbus.NewRTUClientHandler(ms.serialPort)
-	handler.BaudRate = ms.baudRate
-	handler.DataBits = ms.dataBits
-	handler.Parity = ms.parity
-	handler.StopBits = ms.stopBits
-	handler.SlaveId = ms.slaveId
-	handler.Timeout = ms.timeout
-
-	client := modbus.NewClient(handler)
-	defer handler.Close()
-
-	err := handler.Connect()
-	if err != nil {
-		ms.errorLabel.SetText("Failed to connect: " + err.Error())
-		return
-	}
-
-	var results []byte
-	switch ms.functionCode {
-	case 1:
-		results, err = client.ReadCoils(uint16(ms.startRegister), uint16(ms.numRegisters))
-	case 2:
-		results, err = client.ReadDiscreteInputs(uint16(ms.startRegister), uint16(ms.numRegisters))
-	case 3:
-		results, err = client.ReadHoldingRegisters(uint16(ms.startRegister), uint16(ms.numRegisters))
-	case 4:
-		results, err = client.ReadInputRegisters(uint16(ms.startRegister), uint16(ms.numRegisters))
-	default:
-		ms.errorLabel.SetText("Invalid function code")
-		return
+// newRecord starts a log record for one address of a poll of target
+func newRecord(target nexus_widgets.ScanTarget, t time.Time, address int) nexus_modbus.Record {
+	return nexus_modbus.Record{
+		Time:         t,
+		Port:         target.Transport.Target(),
+		SlaveId:      target.UnitId,
+		FunctionCode: target.Scan.FunctionCode,
+		Address:      address,
 	}
+}
 
+// scanned charts and records the values of every poll, it is called from the poller
+func (ms *ModbusRTUScanner) scanned(target nexus_widgets.ScanTarget, result *nexus_modbus.ScanResult, err error) {
 	if err != nil {
-		ms.errorLabel.SetText("Read error: " + err.Error())
+		// A failed poll cycle matters as much as the values on a flaky bus
+		record := newRecord(target, time.Now(), target.Scan.Address)
+		record.Error = fmt.Sprintf("%v: %v", nexus_modbus.Classify(err), err)
+		ms.record([]nexus_modbus.Record{record})
 		return
 	}
 
-	// Clear the error label on a successful read
-	ms.errorLabel.SetText("")
-
-	const maxPerLabel = 20 // Number of values per result label
-
-	var resultLines []string
-	for i := 0; i < ms.numRegisters; i++ {
-		var line string
-		if ms.functionCode == 1 || ms.functionCode == 2 {
-			if i < len(results) && results[i] == 1 {
-				line = fmt.Sprintf("Register %d: ON", ms.startRegister+i)
-			} else {
-				line = fmt.Sprintf("Register %d: OFF", ms.startRegister+i)
-			}
-		} else {
-			if len(results) >= 2*(i+1) {
-				value := int(results[2*i])<<8 | int(results[2*i+1])
-				line = fmt.Sprintf("Register %d: %d", ms.startRegister+i, value)
-			} else {
-				line = fmt.Sprintf("Register %d: Error", ms.startRegister+i)
-			}
+	// Keep the longest trend window at the current poll interval
+	ms.history.SetCapacity(historyCapacity(target.Timing.PollInterval))
+
+	now := time.Now()
+	var records []nexus_modbus.Record
+	for _, value := range result.Values {
+		record := newRecord(target, now, value.Address)
+		record.FunctionCode = value.FunctionCode
+		if value.Err != nil {
+			record.Error = value.Err.Error()
+			records = append(records, record)
+			continue
 		}
-		resultLines = append(resultLines, line)
-	}
-
-	// Split resultLines into four parts for each label
-	var label1Lines, label2Lines, label3Lines, label4Lines []string
-	for i, line := range resultLines {
-		if i < maxPerLabel {
-			label1Lines = append(label1Lines, line)
-		} else if i < 2*maxPerLabel {
-			label2Lines = append(label2Lines, line)
-		} else if i < 3*maxPerLabel {
-			label3Lines = append(label3Lines, line)
-		} else {
-			label4Lines = append(label4Lines, line)
+		if value.Numeric {
+			ms.history.Add(value.Name(), now, value.Number)
 		}
+		record.Raw, record.Value = value.Raw, value.Text
+		records = append(records, record)
 	}
-
-	// Set the text for each result label
-	ms.resultLabel1.SetText(strings.Join(label1Lines, "\n"))
-	ms.resultLabel2.SetText(strings.Join(label2Lines, "\n"))
-	ms.resultLabel3.SetText(strings.Join(label3Lines, "\n"))
-	ms.resultLabel4.SetText(strings.Join(label4Lines, "\n"))
+	ms.record(records)
 }
 
-func (ms *ModbusRTUScanner) writeRegister(register int, value int) {
-	handler := modbus.NewRTUClientHandler(ms.serialPort)
-	handler.BaudRate = ms.baudRate
-	handler.DataBits = ms.dataBits
-	handler.Parity = ms.parity
-	handler.StopBits = ms.stopBits
-	handler.SlaveId = ms.slaveId
-	handler.Timeout = ms.timeout
-
-	client := modbus.NewClient(handler)
-	defer handler.Close()
+// record appends one poll cycle to the recording file when recording is on
+func (ms *ModbusRTUScanner) record(records []nexus_modbus.Record) {
+	ms.recorderMu.Lock()
+	defer ms.recorderMu.Unlock()
 
-	err := handler.Connect()
-	if err != nil {
-		ms.writeLabel.SetText("Failed to connect: " + err.Error())
+	if ms.recorder == nil {
 		return
 	}
-
-	// Write a single holding register
-	_, err = client.WriteSingleRegister(uint16(register), uint16(value))
-	if err != nil {
-		ms.writeLabel.SetText("Write error: " + err.Error())
-		return
+	if err := ms.recorder.Write(records); err != nil {
+		ms.scanner.ShowError("Recording error: " + err.Error())
 	}
+}
 
-	ms.writeLabel.SetText(fmt.Sprintf("Write successful! (Value %d to register %d)", value, register))
-	go func() {
-		// Wait for 5 seconds before clearing the label
-		time.Sleep(5 * time.Second)
-		// Ensure the UI update happens on the main thread
-		ms.writeLabel.SetText("")
-	}()
+// connection returns the shared transport for the selected port or address and line settings
+func (ms *ModbusRTUScanner) connection() nexus_modbus.Transport {
+	return ms.scanner.Connection()
+}
 
+// transportConfig returns the selected port or address and line settings
+func (ms *ModbusRTUScanner) transportConfig() nexus_modbus.TransportConfig {
+	return nexus_modbus.TransportConfig{
+		Kind: ms.transport,
+		Serial: nexus_modbus.RTUConfig{
+			Port:     ms.serialPort,
+			BaudRate: ms.baudRate,
+			DataBits: ms.dataBits,
+			Parity:   ms.parity,
+			StopBits: ms.stopBits,
+		},
+		Address: ms.address,
+	}
 }
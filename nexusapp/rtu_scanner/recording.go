@@ -0,0 +1,118 @@
+package modbus_scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_modbus"
+)
+
+// defaultRecordDir is where poll logs go until another folder is chosen
+func defaultRecordDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "modbus_logs"
+	}
+	return filepath.Join(home, "modbus_logs")
+}
+
+// createRecordingPanel builds the controls that log every poll cycle to rotating files
+func (ms *ModbusRTUScanner) createRecordingPanel() fyne.CanvasObject {
+	recordDir := defaultRecordDir()
+	folderLabel := widget.NewLabel(recordDir)
+
+	formatSelect := widget.NewSelect([]string{string(nexus_modbus.FormatCSV), string(nexus_modbus.FormatJSONL)}, nil)
+	formatSelect.SetSelected(string(nexus_modbus.FormatCSV))
+
+	maxSizeEntry := widget.NewEntry()
+	maxSizeEntry.SetPlaceHolder("Rotate size (MB)")
+	maxSizeEntry.SetText("10")
+
+	maxAgeEntry := widget.NewEntry()
+	maxAgeEntry.SetPlaceHolder("Rotate interval (min)")
+	maxAgeEntry.SetText("60")
+
+	folderButton := widget.NewButtonWithIcon("Folder", theme.FolderOpenIcon(), func() {
+		dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil || uri == nil {
+				return
+			}
+			recordDir = uri.Path()
+			folderLabel.SetText(recordDir)
+		}, ms.window)
+	})
+
+	ms.settings.Add("recordFolder", func() string { return recordDir }, func(value string) {
+		if value != "" {
+			recordDir = value
+			folderLabel.SetText(recordDir)
+		}
+	})
+	ms.settings.Select("recordFormat", formatSelect)
+	ms.settings.Entry("recordMaxSize", maxSizeEntry)
+	ms.settings.Entry("recordMaxAge", maxAgeEntry)
+
+	var recordCheck *widget.Check
+	recordCheck = widget.NewCheck("Record to file", func(on bool) {
+		if !on {
+			// Waits for a poll cycle being written, so no record is lost or written after Close
+			ms.recorderMu.Lock()
+			if ms.recorder != nil {
+				if err := ms.recorder.Close(); err != nil {
+					ms.scanner.ShowError("Recording error: " + err.Error())
+				}
+				ms.recorder = nil
+			}
+			ms.recorderMu.Unlock()
+			formatSelect.Enable()
+			folderButton.Enable()
+			return
+		}
+
+		// Blank limits disable rotation on that criterion
+		var maxSize float64
+		var maxAge int
+		var err error
+		if text := strings.TrimSpace(maxSizeEntry.Text); text != "" {
+			if maxSize, err = strconv.ParseFloat(text, 64); err != nil || maxSize < 0 {
+				ms.scanner.ShowError("Invalid rotate size")
+				recordCheck.SetChecked(false)
+				return
+			}
+		}
+		if text := strings.TrimSpace(maxAgeEntry.Text); text != "" {
+			if maxAge, err = strconv.Atoi(text); err != nil || maxAge < 0 {
+				ms.scanner.ShowError("Invalid rotate interval")
+				recordCheck.SetChecked(false)
+				return
+			}
+		}
+
+		recorder, err := nexus_modbus.NewRecorder(recordDir, "rtu_scan", nexus_modbus.RecordFormat(formatSelect.Selected),
+			int64(maxSize*1024*1024), time.Duration(maxAge)*time.Minute)
+		if err != nil {
+			ms.scanner.ShowError("Recording error: " + err.Error())
+			recordCheck.SetChecked(false)
+			return
+		}
+		ms.recorderMu.Lock()
+		ms.recorder = recorder
+		ms.recorderMu.Unlock()
+		formatSelect.Disable()
+		folderButton.Disable()
+	})
+
+	return container.NewVBox(
+		container.NewGridWithColumns(4, recordCheck, formatSelect, maxSizeEntry, maxAgeEntry),
+		container.NewBorder(nil, nil, folderButton, nil, folderLabel),
+	)
+}
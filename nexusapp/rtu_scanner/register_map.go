@@ -0,0 +1,160 @@
+package modbus_scanner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/goburrow/modbus"
+
+	"nexusapp/nexus_modbus"
+	"nexusapp/nexus_widgets"
+)
+
+// showRegisterMapDialog opens the register map discovery window for the configured slave
+func (ms *ModbusRTUScanner) showRegisterMapDialog() {
+	defaults := nexus_modbus.DefaultMapOptions()
+
+	functionChecks := []*widget.Check{
+		widget.NewCheck("FC1 Coils", nil),
+		widget.NewCheck("FC2 Discrete Inputs", nil),
+		widget.NewCheck("FC3 Holding Registers", nil),
+		widget.NewCheck("FC4 Input Registers", nil),
+	}
+	for _, check := range functionChecks {
+		check.SetChecked(true)
+	}
+
+	startEntry := widget.NewEntry()
+	startEntry.SetText(strconv.Itoa(defaults.Start))
+	endEntry := widget.NewEntry()
+	endEntry.SetText(strconv.Itoa(defaults.End))
+	blockEntry := widget.NewEntry()
+	blockEntry.SetText(strconv.Itoa(defaults.RegisterBlock))
+	minBlockEntry := widget.NewEntry()
+	minBlockEntry.SetText(strconv.Itoa(defaults.MinBlock))
+	timeoutEntry := widget.NewEntry()
+	timeoutEntry.SetText("300")
+
+	// The map of the last finished sweep, exported from the UI thread
+	var mu sync.Mutex
+	var registerMap *nexus_modbus.RegisterMap
+
+	csvButton := widget.NewButtonWithIcon("Export CSV", theme.DocumentSaveIcon(), func() {
+		mu.Lock()
+		exported := registerMap
+		mu.Unlock()
+		nexus_widgets.SaveToFile(ms.window, "register_map.csv", "register map", exported.WriteCSV)
+	})
+	csvButton.Disable()
+
+	jsonButton := widget.NewButtonWithIcon("Export JSON", theme.DocumentSaveIcon(), func() {
+		mu.Lock()
+		exported := registerMap
+		mu.Unlock()
+		nexus_widgets.SaveToFile(ms.window, "register_map.json", "register map", exported.WriteJSON)
+	})
+	jsonButton.Disable()
+
+	optionsGrid := container.NewGridWithColumns(3,
+		container.NewVBox(widget.NewLabel("Start Address"), startEntry),
+		container.NewVBox(widget.NewLabel("End Address"), endEntry),
+		container.NewVBox(widget.NewLabel("Timeout (ms)"), timeoutEntry),
+		container.NewVBox(widget.NewLabel("Max Block (registers)"), blockEntry),
+		container.NewVBox(widget.NewLabel("Min Block"), minBlockEntry),
+	)
+	form := container.NewVBox(
+		container.NewGridWithColumns(2, functionChecks[0], functionChecks[1], functionChecks[2], functionChecks[3]),
+		optionsGrid,
+	)
+
+	nexus_widgets.NewSweepDialog(ms.window, nexus_widgets.SweepConfig{
+		Title:     "Register Map",
+		Form:      form,
+		StartText: "Map Registers",
+		Buttons:   []fyne.CanvasObject{csvButton, jsonButton},
+		Columns:   []string{"Function", "Start", "End", "Count"},
+		Widths:    []float32{110, 110, 110, 110},
+		Size:      fyne.NewSize(600, 640),
+		Start: func() (nexus_widgets.SweepFunc, error) {
+			options := defaults
+			options.FunctionCodes = nil
+			for i, check := range functionChecks {
+				if check.Checked {
+					options.FunctionCodes = append(options.FunctionCodes, i+1)
+				}
+			}
+			if len(options.FunctionCodes) == 0 {
+				return nil, fmt.Errorf("Select at least one function code")
+			}
+
+			var err error
+			if options.Start, err = strconv.Atoi(startEntry.Text); err != nil || options.Start < 0 || options.Start > 65535 {
+				return nil, fmt.Errorf("Invalid start address: %s", startEntry.Text)
+			}
+			if options.End, err = strconv.Atoi(endEntry.Text); err != nil || options.End < options.Start || options.End > 65535 {
+				return nil, fmt.Errorf("Invalid end address: %s", endEntry.Text)
+			}
+			if options.RegisterBlock, err = strconv.Atoi(blockEntry.Text); err != nil || options.RegisterBlock < 1 || options.RegisterBlock > 125 {
+				return nil, fmt.Errorf("Invalid block size (1-125): %s", blockEntry.Text)
+			}
+			if options.MinBlock, err = strconv.Atoi(minBlockEntry.Text); err != nil || options.MinBlock < 1 {
+				return nil, fmt.Errorf("Invalid minimum block size: %s", minBlockEntry.Text)
+			}
+			timeoutMs, err := strconv.Atoi(timeoutEntry.Text)
+			if err != nil || timeoutMs <= 0 {
+				return nil, fmt.Errorf("Invalid timeout: %s", timeoutEntry.Text)
+			}
+
+			// The sweep needs the port to itself
+			ms.stopScan()
+
+			conn, slaveId := ms.connection(), ms.slaveId
+			timing := ms.timing
+			timing.Timeout = time.Duration(timeoutMs) * time.Millisecond
+			csvButton.Disable()
+			jsonButton.Disable()
+
+			return func(ctx context.Context, run *nexus_widgets.SweepRun) string {
+				run.SetStatus(fmt.Sprintf("Mapping slave %d on %s...", slaveId, conn.Name()))
+				var result *nexus_modbus.RegisterMap
+				err := conn.Do(ctx, slaveId, timing, func(handler modbus.ClientHandler) error {
+					result = nexus_modbus.MapRegisters(ctx, modbus.NewClient(handler), options, run.Progress)
+					return nil
+				})
+				if err != nil {
+					return nexus_modbus.Classify(err).Describe()
+				}
+
+				for _, r := range result.Ranges {
+					run.Add(r)
+				}
+				mu.Lock()
+				registerMap = result
+				mu.Unlock()
+				csvButton.Enable()
+				jsonButton.Enable()
+				return fmt.Sprintf("%d range(s) found, %d failed block(s), unsupported functions: %v",
+					len(result.Ranges), len(result.Failures), result.UnsupportedFunctions)
+			}, nil
+		},
+		Cell: func(row interface{}, col int) string {
+			r := row.(nexus_modbus.RegisterRange)
+			switch col {
+			case 0:
+				return fmt.Sprintf("FC%d", r.FunctionCode)
+			case 1:
+				return strconv.Itoa(r.Start)
+			case 2:
+				return strconv.Itoa(r.End())
+			}
+			return strconv.Itoa(r.Count)
+		},
+	}).Show()
+}
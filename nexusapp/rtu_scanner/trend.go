@@ -0,0 +1,150 @@
+package modbus_scanner
+
+import (
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"nexusapp/nexus_widgets"
+)
+
+// maxTrendWindow is the longest window the chart offers, the history covers it at any poll interval
+const maxTrendWindow = 60 * time.Minute
+
+// maxHistoryCapacity bounds the samples kept per point, the longest window at a 100 ms poll interval
+const maxHistoryCapacity = 36000
+
+// historyCapacity returns the samples per point needed to fill the longest window at the poll interval
+func historyCapacity(pollInterval time.Duration) int {
+	if pollInterval <= 0 || maxTrendWindow/pollInterval >= maxHistoryCapacity {
+		return maxHistoryCapacity
+	}
+	return int(maxTrendWindow/pollInterval) + 1
+}
+
+// trendWindows maps the window choices to their duration
+var trendWindows = map[string]time.Duration{
+	"1 min":  time.Minute,
+	"5 min":  5 * time.Minute,
+	"10 min": 10 * time.Minute,
+	"30 min": 30 * time.Minute,
+	"60 min": maxTrendWindow,
+}
+
+// showTrendWindow opens the trend chart of the polled values, or focuses it when already open
+func (ms *ModbusRTUScanner) showTrendWindow() {
+	if ms.trendWindow != nil {
+		ms.trendWindow.RequestFocus()
+		return
+	}
+
+	win := fyne.CurrentApp().NewWindow("Trend - RTU Scanner")
+	ms.trendWindow = win
+
+	chart := nexus_widgets.NewTrendChart()
+	readout := widget.NewLabel("")
+	chart.OnCursor = readout.SetText
+	legend := container.NewHBox()
+
+	// The controls set window and paused, the refresh loop reads them
+	var mu sync.Mutex
+	window := 10 * time.Minute
+	paused := false
+
+	windowSelect := widget.NewSelect([]string{"1 min", "5 min", "10 min", "30 min", "60 min"}, func(s string) {
+		mu.Lock()
+		window = trendWindows[s]
+		mu.Unlock()
+	})
+	windowSelect.SetSelected("10 min")
+
+	// Points of the watch list are checked as soon as they are polled
+	pointsGroup := widget.NewCheckGroup(nil, ms.setTrendPoints)
+	pointsGroup.Selected = ms.watchedPoints()
+
+	var pauseButton *widget.Button
+	pauseButton = widget.NewButtonWithIcon("Pause", theme.MediaPauseIcon(), func() {
+		mu.Lock()
+		paused = !paused
+		pausing := paused
+		mu.Unlock()
+		if pausing {
+			pauseButton.SetText("Resume")
+			pauseButton.SetIcon(theme.MediaPlayIcon())
+		} else {
+			pauseButton.SetText("Pause")
+			pauseButton.SetIcon(theme.MediaPauseIcon())
+		}
+	})
+
+	clearButton := widget.NewButtonWithIcon("Clear", theme.DeleteIcon(), func() {
+		ms.history.Clear()
+	})
+
+	redraw := func() {
+		// Offer every point that has been polled so far
+		names := ms.history.Names()
+		if len(names) != len(pointsGroup.Options) {
+			pointsGroup.Options = names
+			pointsGroup.Refresh()
+		}
+		mu.Lock()
+		isPaused, span := paused, window
+		mu.Unlock()
+		if isPaused {
+			return
+		}
+
+		end := time.Now()
+		start := end.Add(-span)
+		var series []nexus_widgets.TrendSeries
+		var labels []fyne.CanvasObject
+		for i, name := range ms.watchedPoints() {
+			series = append(series, nexus_widgets.TrendSeries{Name: name, Samples: ms.history.Samples(name, start)})
+			labels = append(labels, canvas.NewText(name, nexus_widgets.SeriesColor(i)))
+		}
+		legend.Objects = labels
+		legend.Refresh()
+		chart.SetData(series, start, end)
+	}
+
+	stop := make(chan struct{})
+	go nexus_widgets.RefreshEvery(time.Second, stop, redraw)
+
+	win.SetOnClosed(func() {
+		close(stop)
+		ms.trendWindow = nil
+	})
+
+	controls := container.NewVBox(
+		widget.NewLabel("Window"),
+		windowSelect,
+		container.NewGridWithColumns(2, pauseButton, clearButton),
+		widget.NewLabel("Points"),
+	)
+	sidebar := container.NewBorder(controls, nil, nil, nil, container.NewVScroll(pointsGroup))
+
+	win.SetContent(container.NewBorder(legend, readout, sidebar, nil, chart))
+	win.Resize(fyne.NewSize(900, 500))
+	win.Show()
+	redraw()
+}
+
+// watchedPoints returns the points shown in the trend window
+func (ms *ModbusRTUScanner) watchedPoints() []string {
+	ms.trendMu.Lock()
+	defer ms.trendMu.Unlock()
+	return append([]string(nil), ms.trendPoints...)
+}
+
+// setTrendPoints changes the points shown in the trend window, the chart redraws them on its next tick
+func (ms *ModbusRTUScanner) setTrendPoints(names []string) {
+	ms.trendMu.Lock()
+	ms.trendPoints = names
+	ms.trendMu.Unlock()
+}